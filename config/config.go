@@ -4,6 +4,7 @@ import (
 	"bulk-email-mailgun/models"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -20,10 +21,53 @@ func Init() {
 	AppConfig.Provider = getEnv("EMAIL_PROVIDER", "mailgun")
 	AppConfig.MailgunDomain = getEnv("MAILGUN_DOMAIN", "")
 	AppConfig.MailgunAPIKey = getEnv("MAILGUN_API_KEY", "")
+	AppConfig.MailgunAPIBase = getEnv("MAILGUN_API_BASE", "")
 
 	// ✅ Ajout Resend
 	AppConfig.ResendAPIKey = getEnv("RESEND_API_KEY", "")
 	AppConfig.ResendFromEmail = getEnv("RESEND_FROM_EMAIL", "")
+
+	// Webhooks de délivrabilité (livré, rebond, plainte)
+	AppConfig.MailgunWebhookKey = getEnv("MAILGUN_WEBHOOK_SIGNING_KEY", "")
+	AppConfig.ResendWebhookSecret = getEnv("RESEND_WEBHOOK_SECRET", "")
+
+	// Suivi des clics : URL publique utilisée pour les liens de redirection
+	AppConfig.PublicBaseURL = getEnv("PUBLIC_BASE_URL", "http://localhost:8080")
+	AppConfig.TrackingSecret = getEnv("TRACKING_SECRET", "")
+
+	AppConfig.AttachmentsDir = getEnv("ATTACHMENTS_DIR", "./data/attachments")
+	AppConfig.ImportsDir = getEnv("IMPORTS_DIR", "./data/imports")
+
+	// Inscription publique : SUBSCRIBE_LISTS="3,5" ouvre les listes 3 et 5
+	AppConfig.SubscribeLists = nil
+	for _, id := range strings.Split(getEnv("SUBSCRIBE_LISTS", ""), ",") {
+		if listID, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64); err == nil {
+			AppConfig.SubscribeLists = append(AppConfig.SubscribeLists, listID)
+		}
+	}
+	AppConfig.SubscribeOrigins = strings.Fields(strings.ReplaceAll(getEnv("SUBSCRIBE_ORIGINS", "https://www.axsender.com"), ",", " "))
+	AppConfig.SubscribeSenderName = getEnv("SUBSCRIBE_SENDER_NAME", "Axsender")
+
+	// Conservation : 0 jour = conserver indéfiniment
+	AppConfig.RetentionSendsDays, _ = strconv.Atoi(getEnv("RETENTION_SENDS_DAYS", "0"))
+	AppConfig.RetentionEventsDays, _ = strconv.Atoi(getEnv("RETENTION_EVENTS_DAYS", "0"))
+	AppConfig.RetentionIntervalHours, _ = strconv.Atoi(getEnv("RETENTION_INTERVAL_HOURS", "24"))
+
+	// Jeton attendu par /metrics (Authorization: Bearer) ; vide = accès libre,
+	// la route devant alors rester inaccessible depuis l'extérieur (cf. nginx)
+	AppConfig.MetricsToken = getEnv("METRICS_TOKEN", "")
+
+	// Logs structurés : LOG_LEVEL=debug|info|warn|error, LOG_FORMAT=json|text
+	AppConfig.LogLevel = getEnv("LOG_LEVEL", "info")
+	AppConfig.LogFormat = getEnv("LOG_FORMAT", "json")
+
+	// Traces : OTEL_TRACES_EXPORTER=none|stdout|otlp ; l'exporteur OTLP lit
+	// OTEL_EXPORTER_OTLP_ENDPOINT et les autres variables standard
+	AppConfig.TracesExporter = getEnv("OTEL_TRACES_EXPORTER", "none")
+	AppConfig.ServiceName = getEnv("OTEL_SERVICE_NAME", "axsender")
+
+	// Arrêt progressif : secondes de retrait du trafic avant la fermeture du serveur
+	AppConfig.ShutdownDrainSeconds, _ = strconv.Atoi(getEnv("SHUTDOWN_DRAIN_SECONDS", "5"))
 }
 
 func getEnv(key, defaultValue string) string {
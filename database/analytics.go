@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// analyticsWindow est la période recalculée à chaque rafraîchissement : les
+// événements reçus plus tard (ouverture tardive) ne modifient plus les agrégats
+const analyticsWindow = "-30 days"
+
+// AnalyticsQuery décrit une série demandée au tableau de bord
+type AnalyticsQuery struct {
+	Period     string // "hour", "day" ou "week"
+	GroupBy    string // "", "provider", "domain" ou "campaign"
+	CampaignID int64
+	Provider   string
+	Domain     string
+	From       *time.Time // inclus
+	To         *time.Time // exclu
+}
+
+// AnalyticsPoint agrège les envois d'une période. Les événements sont comptés
+// une fois par envoi et rattachés à la période de l'envoi ; les taux sont des
+// pourcentages des envois acceptés par le provider (sent).
+type AnalyticsPoint struct {
+	Period          string  `json:"period,omitempty"`
+	Key             string  `json:"key,omitempty"`
+	Sent            int64   `json:"sent"`
+	Failed          int64   `json:"failed"`
+	Delivered       int64   `json:"delivered"`
+	Bounced         int64   `json:"bounced"`
+	Complained      int64   `json:"complained"`
+	Opened          int64   `json:"opened"`
+	Clicked         int64   `json:"clicked"`
+	Unsubscribed    int64   `json:"unsubscribed"`
+	DeliveryRate    float64 `json:"delivery_rate"`
+	BounceRate      float64 `json:"bounce_rate"`
+	ComplaintRate   float64 `json:"complaint_rate"`
+	OpenRate        float64 `json:"open_rate"`
+	ClickRate       float64 `json:"click_rate"`
+	UnsubscribeRate float64 `json:"unsubscribe_rate"`
+	ClickToOpenRate float64 `json:"click_to_open_rate"`
+}
+
+var analyticsPeriods = map[string]string{
+	"hour": "bucket",
+	"day":  "substr(bucket, 1, 10)",
+	"week": "date(bucket, '-6 days', 'weekday 1')", // lundi de la semaine
+}
+
+var analyticsGroups = map[string]string{
+	"":         "''",
+	"provider": "provider",
+	"domain":   "domain",
+	"campaign": "CAST(campaign_id AS TEXT)",
+}
+
+// ValidAnalyticsQuery vérifie la période et le regroupement demandés
+func ValidAnalyticsQuery(q AnalyticsQuery) error {
+	if _, ok := analyticsPeriods[q.Period]; !ok {
+		return fmt.Errorf("période invalide (hour, day ou week)")
+	}
+	if _, ok := analyticsGroups[q.GroupBy]; !ok {
+		return fmt.Errorf("regroupement invalide (provider, domain ou campaign)")
+	}
+	return nil
+}
+
+// RefreshAnalytics recalcule les agrégats horaires (analytics_rollup) des envois
+// récents, sauf si le dernier calcul date de moins de maxAge. Les agrégats plus
+// anciens sont conservés, y compris après la purge des envois par la rétention :
+// seules les heures postérieures à la plus courte durée de conservation de
+// policy sont recalculées, leurs envois et événements étant encore complets.
+func RefreshAnalytics(ctx context.Context, maxAge time.Duration, policy RetentionPolicy) error {
+	ctx, span := startSpan(ctx, "RefreshAnalytics")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fresh bool
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM analytics_state WHERE id = 1 AND refreshed_at >= datetime('now', ?)`,
+		fmt.Sprintf("-%d seconds", int(maxAge.Seconds()))).Scan(&fresh)
+	if err != nil || fresh {
+		return err
+	}
+
+	// Début de la première heure à recalculer : fenêtre avant le dernier calcul, ou tout l'historique
+	var cutoff string
+	query := `
+		SELECT COALESCE(
+			(SELECT strftime('%Y-%m-%d %H:00:00', refreshed_at, ?) FROM analytics_state WHERE id = 1),
+			'0000-00-00 00:00:00')
+	`
+	if err := tx.QueryRowContext(ctx, query, analyticsWindow).Scan(&cutoff); err != nil {
+		return err
+	}
+
+	// Après un premier calcul, ne pas reconstruire une heure dont la purge a pu
+	// retirer des envois ou des événements : première heure entière après la limite
+	if days := shortestRetention(policy); days > 0 && !strings.HasPrefix(cutoff, "0000") {
+		var retained string
+		query = `SELECT strftime('%Y-%m-%d %H:00:00', 'now', ?, '+1 hour')`
+		if err := tx.QueryRowContext(ctx, query, fmt.Sprintf("-%d days", days)).Scan(&retained); err != nil {
+			return err
+		}
+		if retained > cutoff {
+			cutoff = retained
+		}
+	}
+
+	query = `
+		DELETE FROM analytics_rollup WHERE bucket IN (
+			SELECT DISTINCT strftime('%Y-%m-%d %H:00:00', sent_at) FROM email_sends WHERE sent_at >= ?
+		)
+	`
+	if _, err := tx.ExecContext(ctx, query, cutoff); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO analytics_rollup (bucket, campaign_id, provider, domain,
+			sent, failed, delivered, bounced, complained, opened, clicked, unsubscribed)
+		SELECT strftime('%Y-%m-%d %H:00:00', es.sent_at), COALESCE(ec.campaign_id, 0), COALESCE(es.provider, ''),
+			lower(substr(r.email, instr(r.email, '@') + 1)),
+			SUM(es.status = 'sent'), SUM(es.status = 'failed'),
+			SUM(EXISTS (SELECT 1 FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'delivered')),
+			SUM(EXISTS (SELECT 1 FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'bounced')),
+			SUM(EXISTS (SELECT 1 FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'complained')),
+			SUM(EXISTS (SELECT 1 FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'open')),
+			SUM(EXISTS (SELECT 1 FROM email_clicks cl WHERE cl.send_id = es.id)),
+			SUM(EXISTS (SELECT 1 FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'unsubscribed'))
+		FROM email_sends es
+		JOIN email_contents ec ON ec.id = es.content_id
+		JOIN recipients r ON r.id = es.recipient_id
+		WHERE es.sent_at >= ?
+		GROUP BY 1, 2, 3, 4
+	`
+	if _, err := tx.ExecContext(ctx, query, cutoff); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO analytics_state (id, refreshed_at) VALUES (1, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET refreshed_at = excluded.refreshed_at
+	`
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// shortestRetention retourne la plus courte durée de conservation active (0 si aucune)
+func shortestRetention(p RetentionPolicy) int {
+	days := p.SendsDays
+	if p.EventsDays > 0 && (days == 0 || p.EventsDays < days) {
+		days = p.EventsDays
+	}
+	return days
+}
+
+// GetAnalytics retourne la série demandée et ses totaux, à partir des agrégats horaires
+func GetAnalytics(ctx context.Context, q AnalyticsQuery) ([]AnalyticsPoint, *AnalyticsPoint, error) {
+	ctx, span := startSpan(ctx, "GetAnalytics")
+	defer span.End()
+
+	if err := ValidAnalyticsQuery(q); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if q.CampaignID != 0 {
+		conditions = append(conditions, "campaign_id = ?")
+		args = append(args, q.CampaignID)
+	}
+	if q.Provider != "" {
+		conditions = append(conditions, "provider = ?")
+		args = append(args, q.Provider)
+	}
+	if q.Domain != "" {
+		conditions = append(conditions, "domain = ?")
+		args = append(args, strings.ToLower(q.Domain))
+	}
+	if q.From != nil {
+		conditions = append(conditions, "bucket >= ?")
+		args = append(args, q.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if q.To != nil {
+		conditions = append(conditions, "bucket < ?")
+		args = append(args, q.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := `
+		SELECT ` + analyticsPeriods[q.Period] + ` AS period, ` + analyticsGroups[q.GroupBy] + ` AS key,
+			SUM(sent), SUM(failed), SUM(delivered), SUM(bounced), SUM(complained), SUM(opened), SUM(clicked), SUM(unsubscribed)
+		FROM analytics_rollup
+		` + where + `
+		GROUP BY period, key
+		ORDER BY period, key
+	`
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	points := []AnalyticsPoint{}
+	totals := &AnalyticsPoint{}
+	for rows.Next() {
+		var p AnalyticsPoint
+		err := rows.Scan(&p.Period, &p.Key, &p.Sent, &p.Failed, &p.Delivered, &p.Bounced, &p.Complained,
+			&p.Opened, &p.Clicked, &p.Unsubscribed)
+		if err != nil {
+			return nil, nil, err
+		}
+		totals.add(p)
+		points = append(points, p.withRates())
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	*totals = totals.withRates()
+	return points, totals, nil
+}
+
+func (p *AnalyticsPoint) add(o AnalyticsPoint) {
+	p.Sent += o.Sent
+	p.Failed += o.Failed
+	p.Delivered += o.Delivered
+	p.Bounced += o.Bounced
+	p.Complained += o.Complained
+	p.Opened += o.Opened
+	p.Clicked += o.Clicked
+	p.Unsubscribed += o.Unsubscribed
+}
+
+func (p AnalyticsPoint) withRates() AnalyticsPoint {
+	p.DeliveryRate = percent(p.Delivered, p.Sent)
+	p.BounceRate = percent(p.Bounced, p.Sent)
+	p.ComplaintRate = percent(p.Complained, p.Sent)
+	p.OpenRate = percent(p.Opened, p.Sent)
+	p.ClickRate = percent(p.Clicked, p.Sent)
+	p.UnsubscribeRate = percent(p.Unsubscribed, p.Sent)
+	p.ClickToOpenRate = percent(p.Clicked, p.Opened)
+	return p
+}
+
+// percent retourne part/total en pourcentage arrondi à 0,01
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(int64(float64(part)*10000/float64(total)+0.5)) / 100
+}
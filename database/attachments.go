@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Attachment représente une pièce jointe stockée sur disque
+type Attachment struct {
+	ID          int64     `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Path        string    `json:"-"`
+	Inline      bool      `json:"inline"`
+	ContentID   string    `json:"cid,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// InsertAttachment enregistre les métadonnées d'une pièce jointe
+func InsertAttachment(ctx context.Context, a *Attachment) (int64, error) {
+	ctx, span := startSpan(ctx, "InsertAttachment")
+	defer span.End()
+
+	query := `
+		INSERT INTO attachments (filename, content_type, size, path, inline, cid)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := DB.ExecContext(ctx, query, a.Filename, a.ContentType, a.Size, a.Path, a.Inline, a.ContentID)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetAttachments récupère les pièces jointes demandées, dans l'ordre des IDs
+func GetAttachments(ctx context.Context, ids []int64) ([]Attachment, error) {
+	ctx, span := startSpan(ctx, "GetAttachments")
+	defer span.End()
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	query := `
+		SELECT id, filename, content_type, size, path, inline, COALESCE(cid, ''), created_at
+		FROM attachments WHERE id IN (` + placeholders + `)
+	`
+	byID, err := queryAttachments(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[int64]Attachment, len(byID))
+	for _, a := range byID {
+		index[a.ID] = a
+	}
+
+	attachments := make([]Attachment, 0, len(ids))
+	for _, id := range ids {
+		if a, ok := index[id]; ok {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments, nil
+}
+
+// GetAllAttachments liste toutes les pièces jointes
+func GetAllAttachments(ctx context.Context) ([]Attachment, error) {
+	ctx, span := startSpan(ctx, "GetAllAttachments")
+	defer span.End()
+
+	query := `
+		SELECT id, filename, content_type, size, path, inline, COALESCE(cid, ''), created_at
+		FROM attachments ORDER BY created_at DESC
+	`
+	return queryAttachments(ctx, query)
+}
+
+func queryAttachments(ctx context.Context, query string, args ...interface{}) ([]Attachment, error) {
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		err := rows.Scan(&a.ID, &a.Filename, &a.ContentType, &a.Size, &a.Path, &a.Inline, &a.ContentID, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, rows.Err()
+}
+
+// DeleteAttachment supprime une pièce jointe et retourne son chemin sur disque
+func DeleteAttachment(ctx context.Context, id int64) (string, error) {
+	ctx, span := startSpan(ctx, "DeleteAttachment")
+	defer span.End()
+
+	var path string
+	if err := DB.QueryRowContext(ctx, `SELECT path FROM attachments WHERE id = ?`, id).Scan(&path); err != nil {
+		return "", err
+	}
+
+	if _, err := DB.ExecContext(ctx, `DELETE FROM content_attachments WHERE attachment_id = ?`, id); err != nil {
+		return "", err
+	}
+	if _, err := DB.ExecContext(ctx, `DELETE FROM attachments WHERE id = ?`, id); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// LinkContentAttachments associe des pièces jointes au contenu d'une campagne
+func LinkContentAttachments(ctx context.Context, contentID int64, attachmentIDs []int64) error {
+	ctx, span := startSpan(ctx, "LinkContentAttachments")
+	defer span.End()
+
+	for _, id := range attachmentIDs {
+		query := `INSERT OR IGNORE INTO content_attachments (content_id, attachment_id) VALUES (?, ?)`
+		if _, err := DB.ExecContext(ctx, query, contentID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// Campaign représente une campagne : le contenu et les réglages d'envoi,
+// préparés en brouillon puis lancés vers une liste de destinataires
+type Campaign struct {
+	ID                int64      `json:"id"`
+	Name              string     `json:"name"`
+	Subject           string     `json:"subject"`
+	Body              string     `json:"body"`
+	TextBody          string     `json:"text_body,omitempty"`
+	Provider          string     `json:"provider"`
+	SenderName        string     `json:"sender_name"`
+	TrackClicks       bool       `json:"track_clicks"`
+	TrackOpens        bool       `json:"track_opens"`
+	TemplateVersionID int64      `json:"template_version_id,omitempty"`
+	AttachmentIDs     []int64    `json:"attachment_ids,omitempty"`
+	ListIDs           []int64    `json:"list_ids,omitempty"`    // listes ciblées
+	SegmentIDs        []int64    `json:"segment_ids,omitempty"` // segments évalués au lancement
+	ClickTags         []string   `json:"click_tags,omitempty"`  // tags posés sur les destinataires qui cliquent
+	TopicID           int64      `json:"topic_id,omitempty"`    // thème, pour respecter les préférences
+	Status            string     `json:"status"`                // "draft", "sending", "sent", "interrupted"
+	CreatedBy         string     `json:"created_by"`
+	CreatedAt         time.Time  `json:"created_at"`
+	LaunchedAt        *time.Time `json:"launched_at,omitempty"`
+}
+
+// TestSend représente un envoi de test, séparé de l'historique réel
+type TestSend struct {
+	ID           int64     `json:"id"`
+	CampaignID   int64     `json:"campaign_id"`
+	Email        string    `json:"email"`
+	Provider     string    `json:"provider"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+const campaignColumns = `
+	id, name, subject, body, COALESCE(text_body, ''), provider, COALESCE(sender_name, ''),
+	track_clicks, track_opens, COALESCE(template_version_id, 0), COALESCE(attachment_ids, '[]'),
+	COALESCE(list_ids, '[]'), COALESCE(segment_ids, '[]'), COALESCE(click_tags, '[]'),
+	COALESCE(topic_id, 0), status,
+	COALESCE(created_by, ''), created_at, launched_at
+`
+
+// CreateCampaign enregistre une nouvelle campagne et retourne son ID
+func CreateCampaign(ctx context.Context, c *Campaign) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateCampaign")
+	defer span.End()
+
+	attachmentIDs, listIDs, segmentIDs := encodeIDs(c.AttachmentIDs), encodeIDs(c.ListIDs), encodeIDs(c.SegmentIDs)
+	clickTags, err := json.Marshal(c.ClickTags)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `
+		INSERT INTO campaigns (name, subject, body, text_body, provider, sender_name, track_clicks, track_opens,
+			template_version_id, attachment_ids, list_ids, segment_ids, click_tags, topic_id, status, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, NULLIF(?, 0), ?, ?)
+	`
+	result, err := DB.ExecContext(ctx, query, c.Name, c.Subject, c.Body, c.TextBody, c.Provider, c.SenderName, c.TrackClicks,
+		c.TrackOpens, c.TemplateVersionID, attachmentIDs, listIDs, segmentIDs, string(clickTags), c.TopicID, c.Status, c.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateCampaign met à jour le contenu et les réglages d'une campagne
+func UpdateCampaign(ctx context.Context, c *Campaign) error {
+	ctx, span := startSpan(ctx, "UpdateCampaign")
+	defer span.End()
+
+	attachmentIDs, listIDs, segmentIDs := encodeIDs(c.AttachmentIDs), encodeIDs(c.ListIDs), encodeIDs(c.SegmentIDs)
+	clickTags, err := json.Marshal(c.ClickTags)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE campaigns SET name = ?, subject = ?, body = ?, text_body = ?, provider = ?, sender_name = ?,
+			track_clicks = ?, track_opens = ?, template_version_id = NULLIF(?, 0), attachment_ids = ?, list_ids = ?, segment_ids = ?,
+			click_tags = ?, topic_id = NULLIF(?, 0)
+		WHERE id = ?
+	`
+	_, err = DB.ExecContext(ctx, query, c.Name, c.Subject, c.Body, c.TextBody, c.Provider, c.SenderName,
+		c.TrackClicks, c.TrackOpens, c.TemplateVersionID, attachmentIDs, listIDs, segmentIDs, string(clickTags), c.TopicID, c.ID)
+	return err
+}
+
+// SetCampaignStatus change le statut d'une campagne ("sending" renseigne la date de lancement)
+func SetCampaignStatus(ctx context.Context, id int64, status string) error {
+	ctx, span := startSpan(ctx, "SetCampaignStatus")
+	defer span.End()
+
+	query := `
+		UPDATE campaigns
+		SET status = ?, launched_at = CASE WHEN ? = 'sending' THEN CURRENT_TIMESTAMP ELSE launched_at END
+		WHERE id = ?
+	`
+	_, err := DB.ExecContext(ctx, query, status, status, id)
+	return err
+}
+
+// StartCampaign passe atomiquement une campagne brouillon ou interrompue à
+// l'état "sending" ; retourne false si elle a déjà été lancée (double clic,
+// nouvelle tentative)
+func StartCampaign(ctx context.Context, id int64) (bool, error) {
+	ctx, span := startSpan(ctx, "StartCampaign")
+	defer span.End()
+
+	query := `
+		UPDATE campaigns SET status = 'sending', launched_at = COALESCE(launched_at, CURRENT_TIMESTAMP)
+		WHERE id = ? AND status IN ('draft', 'interrupted')
+	`
+	result, err := DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// recoverSendingCampaigns passe à l'état "interrupted" les campagnes restées en
+// "sending" : au démarrage, aucun envoi n'est en cours, elles viennent donc d'un
+// processus arrêté brutalement et pourront être relancées
+func recoverSendingCampaigns() error {
+	result, err := DB.Exec(`UPDATE campaigns SET status = 'interrupted' WHERE status = 'sending'`)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		slog.Warn("campagnes interrompues par un arrêt brutal", "count", n)
+	}
+	return nil
+}
+
+// CampaignSentTo indique si la campagne a déjà été envoyée avec succès au destinataire
+func CampaignSentTo(ctx context.Context, campaignID, recipientID int64) (bool, error) {
+	ctx, span := startSpan(ctx, "CampaignSentTo")
+	defer span.End()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM email_sends es
+			JOIN email_contents ec ON ec.id = es.content_id
+			WHERE ec.campaign_id = ? AND es.recipient_id = ? AND es.status = 'sent'
+		)
+	`
+	var sent bool
+	err := DB.QueryRowContext(ctx, query, campaignID, recipientID).Scan(&sent)
+	return sent, err
+}
+
+// GetCampaign récupère une campagne par son ID
+func GetCampaign(ctx context.Context, id int64) (*Campaign, error) {
+	ctx, span := startSpan(ctx, "GetCampaign")
+	defer span.End()
+
+	c, err := scanCampaign(DB.QueryRowContext(ctx, `SELECT `+campaignColumns+` FROM campaigns WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetAllCampaigns liste les campagnes, la plus récente en premier
+func GetAllCampaigns(ctx context.Context) ([]Campaign, error) {
+	ctx, span := startSpan(ctx, "GetAllCampaigns")
+	defer span.End()
+
+	rows, err := DB.QueryContext(ctx, `SELECT `+campaignColumns+` FROM campaigns ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+
+	return campaigns, rows.Err()
+}
+
+// scanCampaign lit une campagne depuis un *sql.Row ou un *sql.Rows
+func scanCampaign(row interface{ Scan(...interface{}) error }) (Campaign, error) {
+	var (
+		c             Campaign
+		attachmentIDs string
+		listIDs       string
+		segmentIDs    string
+		clickTags     string
+	)
+	err := row.Scan(&c.ID, &c.Name, &c.Subject, &c.Body, &c.TextBody, &c.Provider, &c.SenderName,
+		&c.TrackClicks, &c.TrackOpens, &c.TemplateVersionID, &attachmentIDs, &listIDs, &segmentIDs, &clickTags, &c.TopicID, &c.Status,
+		&c.CreatedBy, &c.CreatedAt, &c.LaunchedAt)
+	if err != nil {
+		return c, err
+	}
+	json.Unmarshal([]byte(attachmentIDs), &c.AttachmentIDs)
+	json.Unmarshal([]byte(listIDs), &c.ListIDs)
+	json.Unmarshal([]byte(segmentIDs), &c.SegmentIDs)
+	json.Unmarshal([]byte(clickTags), &c.ClickTags)
+	return c, nil
+}
+
+// encodeIDs sérialise une liste d'IDs en tableau JSON ("[]" si vide)
+func encodeIDs(ids []int64) string {
+	if len(ids) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(ids)
+	return string(data)
+}
+
+// InsertTestSend enregistre un envoi de test
+func InsertTestSend(ctx context.Context, campaignID int64, email, provider, status, errorMessage string) error {
+	ctx, span := startSpan(ctx, "InsertTestSend")
+	defer span.End()
+
+	query := `
+		INSERT INTO test_sends (campaign_id, email, provider, status, error_message)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := DB.ExecContext(ctx, query, campaignID, email, provider, status, errorMessage)
+	return err
+}
+
+// GetTestSends liste les envois de test d'une campagne
+func GetTestSends(ctx context.Context, campaignID int64) ([]TestSend, error) {
+	ctx, span := startSpan(ctx, "GetTestSends")
+	defer span.End()
+
+	query := `
+		SELECT id, campaign_id, email, provider, status, COALESCE(error_message, ''), sent_at
+		FROM test_sends WHERE campaign_id = ? ORDER BY sent_at DESC, id DESC
+	`
+	rows, err := DB.QueryContext(ctx, query, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sends []TestSend
+	for rows.Next() {
+		var t TestSend
+		if err := rows.Scan(&t.ID, &t.CampaignID, &t.Email, &t.Provider, &t.Status, &t.ErrorMessage, &t.SentAt); err != nil {
+			return nil, err
+		}
+		sends = append(sends, t)
+	}
+
+	return sends, rows.Err()
+}
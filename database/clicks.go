@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// InsertClick enregistre un clic sur un lien suivi.
+// L'envoi correspondant est retrouvé à partir du contenu et du destinataire.
+func InsertClick(ctx context.Context, contentID, recipientID int64, linkIndex int, url, userAgent string) error {
+	ctx, span := startSpan(ctx, "InsertClick")
+	defer span.End()
+
+	query := `
+		INSERT INTO email_clicks (send_id, content_id, recipient_id, link_index, url, user_agent)
+		VALUES (
+			(SELECT id FROM email_sends WHERE content_id = ? AND recipient_id = ? ORDER BY id DESC LIMIT 1),
+			?, ?, ?, ?, ?
+		)
+	`
+	_, err := DB.ExecContext(ctx, query, contentID, recipientID, contentID, recipientID, linkIndex, url, userAgent)
+	return err
+}
+
+// TagOnClick pose sur le destinataire les tags de clic de la campagne du contenu
+func TagOnClick(ctx context.Context, contentID, recipientID int64) error {
+	ctx, span := startSpan(ctx, "TagOnClick")
+	defer span.End()
+
+	var raw string
+	query := `
+		SELECT COALESCE(c.click_tags, '[]')
+		FROM email_contents ec
+		JOIN campaigns c ON c.id = ec.campaign_id
+		WHERE ec.id = ?
+	`
+	err := DB.QueryRowContext(ctx, query, contentID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var tags []string
+	json.Unmarshal([]byte(raw), &tags)
+	return AddRecipientTags(ctx, recipientID, tags)
+}
+
+// GetClickStats retourne le nombre de clics par lien pour un contenu donné
+func GetClickStats(ctx context.Context, contentID int64) ([]map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "GetClickStats")
+	defer span.End()
+
+	query := `
+		SELECT link_index, url, COUNT(*) as clicks, COUNT(DISTINCT recipient_id) as unique_clicks
+		FROM email_clicks
+		WHERE content_id = ?
+		GROUP BY link_index, url
+		ORDER BY link_index
+	`
+
+	rows, err := DB.QueryContext(ctx, query, contentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []map[string]interface{}
+	for rows.Next() {
+		var (
+			linkIndex, clicks, uniqueClicks int
+			url                             string
+		)
+		if err := rows.Scan(&linkIndex, &url, &clicks, &uniqueClicks); err != nil {
+			return nil, err
+		}
+		results = append(results, map[string]interface{}{
+			"link_index":    linkIndex,
+			"url":           url,
+			"clicks":        clicks,
+			"unique_clicks": uniqueClicks,
+		})
+	}
+
+	return results, rows.Err()
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Consent est la preuve d'inscription (double opt-in) d'un destinataire
+type Consent struct {
+	RecipientID int64      `json:"recipient_id"`
+	Email       string     `json:"email"`
+	Source      string     `json:"source,omitempty"`
+	IP          string     `json:"ip,omitempty"`
+	RequestedAt *time.Time `json:"requested_at,omitempty"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+}
+
+// CreateSignupRecipient retourne le destinataire d'une inscription publique.
+// Une nouvelle adresse est créée avec ses attributs et reste écartée des envois
+// jusqu'à sa confirmation ; un destinataire existant n'est pas modifié, une
+// requête anonyme ne devant pas changer ce qu'on lui envoie.
+func CreateSignupRecipient(ctx context.Context, email string, attributes map[string]string) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateSignupRecipient")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, created, err := upsertRecipient(ctx, tx, email, nil)
+	if err != nil || !created {
+		return id, err
+	}
+
+	encoded, err := encodeAttributes(attributes)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE recipients SET attributes = ?, signup_pending = 1 WHERE id = ?`, encoded, id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// RequestConsent enregistre une demande d'inscription. La preuve d'un
+// destinataire déjà confirmé n'est pas écrasée.
+func RequestConsent(ctx context.Context, recipientID int64, source, ip string) error {
+	ctx, span := startSpan(ctx, "RequestConsent")
+	defer span.End()
+
+	query := `
+		UPDATE recipients SET consent_source = ?, consent_ip = ?, consent_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND confirmed_at IS NULL
+	`
+	_, err := DB.ExecContext(ctx, query, source, ip, recipientID)
+	return err
+}
+
+// ReserveConfirmation indique si un email de confirmation peut être envoyé :
+// au plus un envoi par destinataire pendant la période donnée
+func ReserveConfirmation(ctx context.Context, recipientID int64, cooldown time.Duration) (bool, error) {
+	ctx, span := startSpan(ctx, "ReserveConfirmation")
+	defer span.End()
+
+	query := `
+		UPDATE recipients SET confirmation_sent_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND (confirmation_sent_at IS NULL OR confirmation_sent_at < datetime('now', ?))
+	`
+	result, err := DB.ExecContext(ctx, query, recipientID, fmt.Sprintf("-%d seconds", int(cooldown.Seconds())))
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// ReleaseConfirmation annule la réservation après un échec d'envoi
+func ReleaseConfirmation(ctx context.Context, recipientID int64) error {
+	ctx, span := startSpan(ctx, "ReleaseConfirmation")
+	defer span.End()
+
+	_, err := DB.ExecContext(ctx, `UPDATE recipients SET confirmation_sent_at = NULL WHERE id = ?`, recipientID)
+	return err
+}
+
+// ConfirmConsent enregistre la confirmation (la première date est conservée)
+// et ajoute le destinataire à la liste demandée
+func ConfirmConsent(ctx context.Context, recipientID, listID int64) error {
+	ctx, span := startSpan(ctx, "ConfirmConsent")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE recipients SET confirmed_at = COALESCE(confirmed_at, CURRENT_TIMESTAMP), signup_pending = 0 WHERE id = ?`, recipientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if listID != 0 {
+		if _, err := addListMembers(ctx, tx, listID, []int64{recipientID}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetConsent récupère la preuve d'inscription d'un destinataire
+func GetConsent(ctx context.Context, recipientID int64) (*Consent, error) {
+	ctx, span := startSpan(ctx, "GetConsent")
+	defer span.End()
+
+	query := `
+		SELECT id, email, COALESCE(consent_source, ''), COALESCE(consent_ip, ''), consent_at, confirmed_at
+		FROM recipients WHERE id = ?
+	`
+	var c Consent
+	err := DB.QueryRowContext(ctx, query, recipientID).Scan(&c.RecipientID, &c.Email, &c.Source, &c.IP, &c.RequestedAt, &c.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// DomainCheck est le résultat mis en cache de la vérification DNS d'un domaine
+type DomainCheck struct {
+	Domain    string
+	Status    string
+	Detail    string
+	CheckedAt time.Time
+}
+
+// GetDomainCheck retourne la vérification en cache d'un domaine si elle est plus récente que maxAge
+func GetDomainCheck(ctx context.Context, domain string, maxAge time.Duration) (*DomainCheck, error) {
+	ctx, span := startSpan(ctx, "GetDomainCheck")
+	defer span.End()
+
+	var c DomainCheck
+	query := `
+		SELECT domain, status, COALESCE(detail, ''), checked_at
+		FROM domain_checks WHERE domain = ? AND checked_at >= ?
+	`
+	err := DB.QueryRowContext(ctx, query, domain, time.Now().UTC().Add(-maxAge)).Scan(&c.Domain, &c.Status, &c.Detail, &c.CheckedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// SaveDomainCheck enregistre (ou remplace) la vérification d'un domaine
+func SaveDomainCheck(ctx context.Context, domain, status, detail string) error {
+	ctx, span := startSpan(ctx, "SaveDomainCheck")
+	defer span.End()
+
+	query := `
+		INSERT INTO domain_checks (domain, status, detail, checked_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(domain) DO UPDATE SET status = excluded.status, detail = excluded.detail, checked_at = excluded.checked_at
+	`
+	_, err := DB.ExecContext(ctx, query, domain, status, detail, time.Now().UTC())
+	return err
+}
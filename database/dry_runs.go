@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// DryRunMessage représente un message qui aurait été envoyé (ou un destinataire écarté)
+type DryRunMessage struct {
+	ID          int64     `json:"id"`
+	CampaignID  int64     `json:"campaign_id"`
+	ContentID   int64     `json:"content_id"`
+	Email       string    `json:"email"`
+	SenderEmail string    `json:"sender_email,omitempty"`
+	Subject     string    `json:"subject,omitempty"`
+	HTML        string    `json:"html,omitempty"`
+	Text        string    `json:"text,omitempty"`
+	Status      string    `json:"status"` // "rendered" ou "skipped"
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const dryRunColumns = `
+	id, COALESCE(campaign_id, 0), content_id, email, COALESCE(sender_email, ''), COALESCE(subject, ''),
+	COALESCE(html, ''), COALESCE(text, ''), status, COALESCE(reason, ''), created_at
+`
+
+// InsertDryRunMessage enregistre le résultat d'une simulation pour un destinataire
+func InsertDryRunMessage(ctx context.Context, campaignID, contentID int64, email, senderEmail, subject, html, text, status, reason string) error {
+	ctx, span := startSpan(ctx, "InsertDryRunMessage")
+	defer span.End()
+
+	query := `
+		INSERT INTO dry_run_messages (campaign_id, content_id, email, sender_email, subject, html, text, status, reason)
+		VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := DB.ExecContext(ctx, query, campaignID, contentID, email, senderEmail, subject, html, text, status, reason)
+	return err
+}
+
+// GetLastDryRun récupère les messages de la dernière simulation d'une campagne
+func GetLastDryRun(ctx context.Context, campaignID int64) ([]DryRunMessage, error) {
+	ctx, span := startSpan(ctx, "GetLastDryRun")
+	defer span.End()
+
+	query := `
+		SELECT ` + dryRunColumns + `
+		FROM dry_run_messages
+		WHERE content_id = (SELECT MAX(content_id) FROM dry_run_messages WHERE campaign_id = ?)
+		ORDER BY id
+	`
+
+	rows, err := DB.QueryContext(ctx, query, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []DryRunMessage
+	for rows.Next() {
+		m, err := scanDryRunMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+func scanDryRunMessage(row interface{ Scan(...interface{}) error }) (DryRunMessage, error) {
+	var m DryRunMessage
+	err := row.Scan(&m.ID, &m.CampaignID, &m.ContentID, &m.Email, &m.SenderEmail, &m.Subject,
+		&m.HTML, &m.Text, &m.Status, &m.Reason, &m.CreatedAt)
+	return m, err
+}
@@ -0,0 +1,52 @@
+package database
+
+import "context"
+
+// Types d'événements de suivi enregistrés dans email_events : ouvertures
+// (pixel de suivi), désinscriptions et retours de délivrabilité des providers
+const (
+	EventOpen         = "open"
+	EventDelivered    = "delivered"
+	EventBounced      = "bounced"
+	EventComplained   = "complained"
+	EventUnsubscribed = "unsubscribed"
+)
+
+// InsertEvent enregistre un événement de suivi pour un destinataire.
+// L'envoi correspondant est retrouvé à partir du contenu et du destinataire.
+func InsertEvent(ctx context.Context, contentID, recipientID int64, eventType, detail string) error {
+	ctx, span := startSpan(ctx, "InsertEvent")
+	defer span.End()
+
+	query := `
+		INSERT INTO email_events (send_id, content_id, recipient_id, type, detail)
+		VALUES (
+			(SELECT id FROM email_sends WHERE content_id = ? AND recipient_id = ? ORDER BY id DESC LIMIT 1),
+			?, ?, ?, NULLIF(?, '')
+		)
+	`
+	_, err := DB.ExecContext(ctx, query, contentID, recipientID, contentID, recipientID, eventType, detail)
+	return err
+}
+
+// insertRecipientEvent rattache un événement au dernier envoi reçu par le
+// destinataire (désinscription depuis le centre de préférences) ; sans envoi,
+// rien n'est enregistré
+func insertRecipientEvent(ctx context.Context, q execQuerier, recipientID int64, eventType string) error {
+	query := `
+		INSERT INTO email_events (send_id, content_id, recipient_id, type)
+		SELECT id, content_id, recipient_id, ? FROM email_sends WHERE recipient_id = ? ORDER BY id DESC LIMIT 1
+	`
+	_, err := q.ExecContext(ctx, query, eventType, recipientID)
+	return err
+}
+
+// MarkUnsubscribed désinscrit un destinataire de tous les envois (plainte ou
+// désinscription signalée par le provider)
+func MarkUnsubscribed(ctx context.Context, recipientID int64) error {
+	ctx, span := startSpan(ctx, "MarkUnsubscribed")
+	defer span.End()
+
+	_, err := DB.ExecContext(ctx, `UPDATE recipients SET unsubscribed_at = COALESCE(unsubscribed_at, CURRENT_TIMESTAMP) WHERE id = ?`, recipientID)
+	return err
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHistoryLimit et MaxHistoryLimit bornent la taille d'une page d'historique
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 500
+)
+
+// HistoryFilter filtre l'historique des envois. Les pages sont parcourues du
+// plus récent au plus ancien : Cursor est l'ID du dernier envoi de la page
+// précédente (0 pour la première page).
+type HistoryFilter struct {
+	Status      string
+	CampaignID  int64
+	RecipientID int64
+	Recipient   string // adresse du destinataire
+	Sender      string // adresse de l'expéditeur
+	Provider    string
+	From        *time.Time // inclus
+	To          *time.Time // exclu
+	Cursor      int64
+	Limit       int
+}
+
+// HistoryEntry est un envoi de l'historique, sans le contenu HTML (voir GetEmailContent)
+type HistoryEntry struct {
+	ID             int64     `json:"id"`
+	ContentID      int64     `json:"content_id"`
+	CampaignID     int64     `json:"campaign_id,omitempty"`
+	RecipientID    int64     `json:"recipient_id"`
+	SenderEmail    string    `json:"sender_email"`
+	SenderName     string    `json:"sender_name"`
+	RecipientEmail string    `json:"recipient_email"`
+	Subject        string    `json:"subject"`
+	Provider       string    `json:"provider,omitempty"`
+	Status         string    `json:"status"`
+	ErrorMessage   string    `json:"error_message"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+// HistoryPage est une page d'historique ; NextCursor vaut 0 sur la dernière page
+type HistoryPage struct {
+	Entries    []HistoryEntry `json:"history"`
+	NextCursor int64          `json:"next_cursor,omitempty"`
+}
+
+// GetEmailSends récupère une page de l'historique des envois
+func GetEmailSends(ctx context.Context, filter HistoryFilter) (*HistoryPage, error) {
+	ctx, span := startSpan(ctx, "GetEmailSends")
+	defer span.End()
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultHistoryLimit
+	}
+	if filter.Limit > MaxHistoryLimit {
+		filter.Limit = MaxHistoryLimit
+	}
+
+	where, args := filter.where()
+
+	// Une ligne de plus que la page pour savoir s'il en reste
+	query := `
+		SELECT es.id, es.content_id, COALESCE(ec.campaign_id, 0), es.recipient_id,
+			s.email, COALESCE(s.display_name, ''), r.email, ec.subject,
+			COALESCE(es.provider, ''), es.status, COALESCE(es.error_message, ''), es.sent_at
+		FROM email_sends es
+		JOIN email_contents ec ON es.content_id = ec.id
+		JOIN senders s ON es.sender_id = s.id
+		JOIN recipients r ON es.recipient_id = r.id
+		` + where + `
+		ORDER BY es.id DESC
+		LIMIT ?
+	`
+	rows, err := DB.QueryContext(ctx, query, append(args, filter.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := &HistoryPage{Entries: []HistoryEntry{}}
+	for rows.Next() {
+		var e HistoryEntry
+		err := rows.Scan(&e.ID, &e.ContentID, &e.CampaignID, &e.RecipientID, &e.SenderEmail, &e.SenderName,
+			&e.RecipientEmail, &e.Subject, &e.Provider, &e.Status, &e.ErrorMessage, &e.SentAt)
+		if err != nil {
+			return nil, err
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Entries) > filter.Limit {
+		page.Entries = page.Entries[:filter.Limit]
+		page.NextCursor = page.Entries[filter.Limit-1].ID
+	}
+	return page, nil
+}
+
+// where construit la clause WHERE du filtre, sur les alias es (email_sends) et ec (email_contents)
+func (f HistoryFilter) where() (string, []interface{}) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if f.Cursor > 0 {
+		conditions = append(conditions, "es.id < ?")
+		args = append(args, f.Cursor)
+	}
+	if f.Status != "" {
+		conditions = append(conditions, "es.status = ?")
+		args = append(args, f.Status)
+	}
+	if f.CampaignID != 0 {
+		conditions = append(conditions, "ec.campaign_id = ?")
+		args = append(args, f.CampaignID)
+	}
+	if f.RecipientID != 0 {
+		conditions = append(conditions, "es.recipient_id = ?")
+		args = append(args, f.RecipientID)
+	}
+	if f.Recipient != "" {
+		conditions = append(conditions, "es.recipient_id IN (SELECT id FROM recipients WHERE email = ? COLLATE NOCASE)")
+		args = append(args, f.Recipient)
+	}
+	if f.Sender != "" {
+		conditions = append(conditions, "es.sender_id IN (SELECT id FROM senders WHERE email = ? COLLATE NOCASE)")
+		args = append(args, f.Sender)
+	}
+	if f.Provider != "" {
+		conditions = append(conditions, "es.provider = ?")
+		args = append(args, f.Provider)
+	}
+	// sent_at est stocké en UTC au format de CURRENT_TIMESTAMP : la comparaison de textes suit l'ordre chronologique
+	if f.From != nil {
+		conditions = append(conditions, "es.sent_at >= ?")
+		args = append(args, f.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if f.To != nil {
+		conditions = append(conditions, "es.sent_at < ?")
+		args = append(args, f.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// ImportJob représente un import de fichier de destinataires traité en arrière-plan
+type ImportJob struct {
+	ID         int64      `json:"id"`
+	Filename   string     `json:"filename"`
+	Format     string     `json:"format,omitempty"`
+	Path       string     `json:"-"`
+	Status     string     `json:"status"` // "pending", "running", "done", "failed"
+	Processed  int        `json:"processed"`
+	Inserted   int        `json:"inserted"`
+	Updated    int        `json:"updated"`
+	Rejected   int        `json:"rejected"`
+	Flagged    int        `json:"flagged"`
+	Error      string     `json:"error,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ImportRow est une ligne valide prête à être enregistrée
+type ImportRow struct {
+	Line       int
+	Email      string
+	Attributes map[string]string
+	Tags       []string
+}
+
+// ImportIssue est une ligne rejetée ("rejected") ou signalée ("flagged") lors d'un import
+type ImportIssue struct {
+	Line       int    `json:"line"`
+	Email      string `json:"email"`
+	Kind       string `json:"kind"`
+	Status     string `json:"status,omitempty"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+const importJobColumns = `
+	id, filename, COALESCE(format, ''), COALESCE(path, ''), status, processed, inserted, updated, rejected, flagged, COALESCE(error, ''),
+	COALESCE(created_by, ''), created_at, finished_at
+`
+
+// CreateImportJob enregistre un fichier en attente d'import et retourne son ID
+func CreateImportJob(ctx context.Context, filename, format, path, createdBy string) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateImportJob")
+	defer span.End()
+
+	query := `INSERT INTO import_jobs (filename, format, path, status, created_by) VALUES (?, ?, ?, 'pending', ?)`
+	result, err := DB.ExecContext(ctx, query, filename, format, path, createdBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// StartImportJob passe un import en attente à l'état "running" ; retourne false
+// s'il a déjà été lancé
+func StartImportJob(ctx context.Context, id int64, format string) (bool, error) {
+	ctx, span := startSpan(ctx, "StartImportJob")
+	defer span.End()
+
+	result, err := DB.ExecContext(ctx, `UPDATE import_jobs SET status = 'running', format = ? WHERE id = ? AND status = 'pending'`, format, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// ImportBatch enregistre dans une même transaction un lot de destinataires et
+// d'anomalies, et met à jour les compteurs de l'import ; les destinataires
+// reçoivent leurs tags et sont ajoutés à la liste listID si elle est renseignée
+func ImportBatch(ctx context.Context, job *ImportJob, listID int64, rows []ImportRow, issues []ImportIssue) error {
+	ctx, span := startSpan(ctx, "ImportBatch")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		id, created, err := upsertRecipient(ctx, tx, row.Email, row.Attributes)
+		if err == ErrSuppressed {
+			issues = append(issues, ImportIssue{Line: row.Line, Email: row.Email, Kind: "rejected", Reason: err.Error()})
+			job.Rejected++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO import_recipients (import_id, recipient_id) VALUES (?, ?)`, job.ID, id); err != nil {
+			return err
+		}
+		if err := addRecipientTags(ctx, tx, id, row.Tags); err != nil {
+			return err
+		}
+		if listID != 0 {
+			if _, err := addListMembers(ctx, tx, listID, []int64{id}); err != nil {
+				return err
+			}
+		}
+		if created {
+			job.Inserted++
+		} else {
+			job.Updated++
+		}
+	}
+
+	for _, issue := range issues {
+		query := `
+			INSERT INTO import_issues (import_id, line, email, kind, status, suggestion, reason)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`
+		if _, err := tx.ExecContext(ctx, query, job.ID, issue.Line, issue.Email, issue.Kind, issue.Status, issue.Suggestion, issue.Reason); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE import_jobs SET processed = ?, inserted = ?, updated = ?, rejected = ?, flagged = ?
+		WHERE id = ?
+	`
+	if _, err := tx.ExecContext(ctx, query, job.Processed, job.Inserted, job.Updated, job.Rejected, job.Flagged, job.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// FinishImportJob marque un import comme terminé ("done") ou en échec ("failed")
+func FinishImportJob(ctx context.Context, id int64, status, errorMessage string) error {
+	ctx, span := startSpan(ctx, "FinishImportJob")
+	defer span.End()
+
+	_, err := DB.ExecContext(ctx, `UPDATE import_jobs SET status = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		status, errorMessage, id)
+	return err
+}
+
+// GetImportJob récupère un import par son ID
+func GetImportJob(ctx context.Context, id int64) (*ImportJob, error) {
+	ctx, span := startSpan(ctx, "GetImportJob")
+	defer span.End()
+
+	job, err := scanImportJob(DB.QueryRowContext(ctx, `SELECT `+importJobColumns+` FROM import_jobs WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetAllImportJobs liste les imports, le plus récent en premier
+func GetAllImportJobs(ctx context.Context) ([]ImportJob, error) {
+	ctx, span := startSpan(ctx, "GetAllImportJobs")
+	defer span.End()
+
+	rows, err := DB.QueryContext(ctx, `SELECT `+importJobColumns+` FROM import_jobs ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []ImportJob
+	for rows.Next() {
+		job, err := scanImportJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func scanImportJob(row interface{ Scan(...interface{}) error }) (ImportJob, error) {
+	var j ImportJob
+	err := row.Scan(&j.ID, &j.Filename, &j.Format, &j.Path, &j.Status, &j.Processed, &j.Inserted, &j.Updated, &j.Rejected, &j.Flagged,
+		&j.Error, &j.CreatedBy, &j.CreatedAt, &j.FinishedAt)
+	return j, err
+}
+
+// GetImportIssues liste les anomalies d'un import par numéro de ligne
+func GetImportIssues(ctx context.Context, importID int64, limit int) ([]ImportIssue, error) {
+	ctx, span := startSpan(ctx, "GetImportIssues")
+	defer span.End()
+
+	query := `
+		SELECT line, email, kind, COALESCE(status, ''), COALESCE(suggestion, ''), reason
+		FROM import_issues WHERE import_id = ? ORDER BY line LIMIT ?
+	`
+	rows, err := DB.QueryContext(ctx, query, importID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issues []ImportIssue
+	for rows.Next() {
+		var i ImportIssue
+		if err := rows.Scan(&i.Line, &i.Email, &i.Kind, &i.Status, &i.Suggestion, &i.Reason); err != nil {
+			return nil, err
+		}
+		issues = append(issues, i)
+	}
+
+	return issues, rows.Err()
+}
+
+// GetImportRecipients récupère les destinataires enregistrés par un import
+func GetImportRecipients(ctx context.Context, importID int64) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "GetImportRecipients")
+	defer span.End()
+
+	query := `
+		SELECT r.id, r.email, r.attributes, r.created_at
+		FROM import_recipients ir
+		JOIN recipients r ON r.id = ir.recipient_id
+		WHERE ir.import_id = ?
+		ORDER BY r.id
+	`
+	return queryRecipients(ctx, query, importID)
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// RecipientList est une liste nommée de destinataires
+type RecipientList struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Members     int       `json:"members"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateList crée une liste et retourne son ID
+func CreateList(ctx context.Context, name, description, createdBy string) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateList")
+	defer span.End()
+
+	result, err := DB.ExecContext(ctx, `INSERT INTO lists (name, description, created_by) VALUES (?, ?, ?)`, name, description, createdBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetList récupère une liste et son nombre de membres
+func GetList(ctx context.Context, id int64) (*RecipientList, error) {
+	ctx, span := startSpan(ctx, "GetList")
+	defer span.End()
+
+	query := `
+		SELECT l.id, l.name, COALESCE(l.description, ''), COUNT(m.recipient_id), COALESCE(l.created_by, ''), l.created_at
+		FROM lists l
+		LEFT JOIN list_members m ON m.list_id = l.id
+		WHERE l.id = ?
+		GROUP BY l.id
+	`
+	var l RecipientList
+	err := DB.QueryRowContext(ctx, query, id).Scan(&l.ID, &l.Name, &l.Description, &l.Members, &l.CreatedBy, &l.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// GetAllLists liste les listes par nom
+func GetAllLists(ctx context.Context) ([]RecipientList, error) {
+	ctx, span := startSpan(ctx, "GetAllLists")
+	defer span.End()
+
+	query := `
+		SELECT l.id, l.name, COALESCE(l.description, ''), COUNT(m.recipient_id), COALESCE(l.created_by, ''), l.created_at
+		FROM lists l
+		LEFT JOIN list_members m ON m.list_id = l.id
+		GROUP BY l.id
+		ORDER BY l.name
+	`
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []RecipientList
+	for rows.Next() {
+		var l RecipientList
+		if err := rows.Scan(&l.ID, &l.Name, &l.Description, &l.Members, &l.CreatedBy, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+
+	return lists, rows.Err()
+}
+
+// DeleteList supprime une liste et ses adhésions (les destinataires sont conservés)
+func DeleteList(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "DeleteList")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM list_members WHERE list_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM lists WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// AddListMembers ajoute des destinataires à une liste et retourne le nombre d'ajouts
+func AddListMembers(ctx context.Context, listID int64, recipientIDs []int64) (int, error) {
+	ctx, span := startSpan(ctx, "AddListMembers")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	added, err := addListMembers(ctx, tx, listID, recipientIDs)
+	if err != nil {
+		return 0, err
+	}
+	return added, tx.Commit()
+}
+
+func addListMembers(ctx context.Context, q execQuerier, listID int64, recipientIDs []int64) (int, error) {
+	added := 0
+	for _, id := range recipientIDs {
+		result, err := q.ExecContext(ctx, `INSERT OR IGNORE INTO list_members (list_id, recipient_id) VALUES (?, ?)`, listID, id)
+		if err != nil {
+			return added, err
+		}
+		n, _ := result.RowsAffected()
+		added += int(n)
+	}
+	return added, nil
+}
+
+// RemoveListMembers retire des destinataires d'une liste
+func RemoveListMembers(ctx context.Context, listID int64, recipientIDs []int64) (int, error) {
+	ctx, span := startSpan(ctx, "RemoveListMembers")
+	defer span.End()
+
+	if len(recipientIDs) == 0 {
+		return 0, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(recipientIDs)), ",")
+	query := `DELETE FROM list_members WHERE list_id = ? AND recipient_id IN (` + placeholders + `)`
+	args := []interface{}{listID}
+	for _, id := range recipientIDs {
+		args = append(args, id)
+	}
+
+	result, err := DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// GetListMembers récupère les membres d'une liste
+func GetListMembers(ctx context.Context, listID int64, limit, offset int) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "GetListMembers")
+	defer span.End()
+
+	query := `
+		SELECT r.id, r.email, r.attributes, r.created_at
+		FROM list_members m
+		JOIN recipients r ON r.id = m.recipient_id
+		WHERE m.list_id = ?
+		ORDER BY r.id
+		LIMIT ? OFFSET ?
+	`
+	return queryRecipients(ctx, query, listID, limit, offset)
+}
+
+// queryRecipients exécute une requête retournant (id, email, attributes, created_at)
+func queryRecipients(ctx context.Context, query string, args ...interface{}) ([]Recipient, error) {
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []Recipient
+	for rows.Next() {
+		var (
+			r       Recipient
+			rawAttr string
+		)
+		if err := rows.Scan(&r.ID, &r.Email, &rawAttr, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		r.Attributes = decodeAttributes(rawAttr)
+		recipients = append(recipients, r)
+	}
+
+	return recipients, rows.Err()
+}
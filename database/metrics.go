@@ -0,0 +1,89 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// driverName est le driver SQLite instrumenté utilisé par Init
+const driverName = "sqlite3_instrumented"
+
+// queryDuration mesure la durée des requêtes SQL, lecture des lignes comprise
+var queryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "axsender_db_query_duration_seconds",
+	Help:    "Durée des requêtes SQLite, par type d'opération.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"operation"})
+
+func init() {
+	sql.Register(driverName, &instrumentedDriver{&sqlite3.SQLiteDriver{}})
+}
+
+// instrumentedDriver enveloppe le driver go-sqlite3 pour chronométrer chaque
+// requête sans modifier les appels du package
+type instrumentedDriver struct {
+	*sqlite3.SQLiteDriver
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn.(*sqlite3.SQLiteConn)}, nil
+}
+
+type instrumentedConn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.SQLiteConn.ExecContext(ctx, query, args)
+	queryDuration.WithLabelValues(operation(query)).Observe(time.Since(start).Seconds())
+	return result, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.SQLiteConn.QueryContext(ctx, query, args)
+	if err != nil {
+		queryDuration.WithLabelValues(operation(query)).Observe(time.Since(start).Seconds())
+		return nil, err
+	}
+	// SQLite exécute la requête au fil de la lecture : la mesure s'arrête à la fermeture
+	return &instrumentedRows{SQLiteRows: rows.(*sqlite3.SQLiteRows), start: start, operation: operation(query)}, nil
+}
+
+type instrumentedRows struct {
+	*sqlite3.SQLiteRows
+	start     time.Time
+	operation string
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.SQLiteRows.Close()
+	queryDuration.WithLabelValues(r.operation).Observe(time.Since(r.start).Seconds())
+	return err
+}
+
+// operation retourne le premier mot-clé de la requête (select, insert, ...)
+func operation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "with", "create", "alter", "drop", "pragma":
+		return op
+	default:
+		return "other"
+	}
+}
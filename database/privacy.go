@@ -0,0 +1,363 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSuppressed est retourné quand une adresse effacée à la demande de la personne
+// est de nouveau importée ou ciblée
+var ErrSuppressed = errors.New("adresse effacée à la demande de la personne (RGPD)")
+
+// DataExport rassemble tout ce qui est conservé pour une adresse
+type DataExport struct {
+	Email        string              `json:"email"`
+	ExportedAt   time.Time           `json:"exported_at"`
+	Recipient    *RecipientExport    `json:"recipient,omitempty"`
+	Lists        []string            `json:"lists"`
+	Preferences  *Preferences        `json:"preferences,omitempty"`
+	Sends        []SendExport        `json:"sends"`
+	Clicks       []ClickExport       `json:"clicks"`
+	Events       []EventExport       `json:"events"`
+	TestSends    []TestSend          `json:"test_sends"`
+	DryRuns      []DryRunMessage     `json:"dry_runs"`
+	ImportIssues []ImportIssueExport `json:"import_issues"`
+	Suppressed   bool                `json:"suppressed"`
+}
+
+// RecipientExport est la fiche destinataire avec sa preuve de consentement
+type RecipientExport struct {
+	ID             int64             `json:"id"`
+	Email          string            `json:"email"`
+	Attributes     map[string]string `json:"attributes"`
+	Tags           []string          `json:"tags"`
+	Consent        *Consent          `json:"consent"`
+	UnsubscribedAt *time.Time        `json:"unsubscribed_at,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+}
+
+// SendExport est un envoi avec le contenu transmis
+type SendExport struct {
+	ID           int64     `json:"id"`
+	CampaignID   int64     `json:"campaign_id,omitempty"`
+	SenderEmail  string    `json:"sender_email"`
+	Subject      string    `json:"subject"`
+	Body         string    `json:"body"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+// ClickExport est un clic enregistré sur un lien suivi
+type ClickExport struct {
+	SendID    *int64    `json:"send_id,omitempty"`
+	URL       string    `json:"url"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ClickedAt time.Time `json:"clicked_at"`
+}
+
+// EventExport est un événement de suivi (ouverture)
+type EventExport struct {
+	SendID     *int64    `json:"send_id,omitempty"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// ImportIssueExport est une ligne d'import rejetée ou signalée pour l'adresse
+type ImportIssueExport struct {
+	ImportID int64 `json:"import_id"`
+	ImportIssue
+}
+
+// ErasureReport résume un effacement
+type ErasureReport struct {
+	Email         string `json:"email"`
+	RecipientID   int64  `json:"recipient_id,omitempty"`
+	Hash          string `json:"suppression_hash"`
+	Deleted       int64  `json:"deleted_rows"`
+	Pseudonymised int64  `json:"pseudonymised_rows"`
+}
+
+// SuppressionHash retourne l'empreinte SHA-256 de l'adresse en minuscules,
+// seule trace conservée après un effacement
+func SuppressionHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsSuppressed indique si l'adresse a été effacée et ne doit plus être contactée
+func IsSuppressed(ctx context.Context, email string) (bool, error) {
+	ctx, span := startSpan(ctx, "IsSuppressed")
+	defer span.End()
+
+	return isSuppressed(ctx, DB, email)
+}
+
+func isSuppressed(ctx context.Context, q execQuerier, email string) (bool, error) {
+	var count int
+	err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM suppressions WHERE hash = ?`, SuppressionHash(email)).Scan(&count)
+	return count > 0, err
+}
+
+// ExportRecipientData rassemble les données conservées pour une adresse
+// (recherche insensible à la casse)
+func ExportRecipientData(ctx context.Context, email string) (*DataExport, error) {
+	ctx, span := startSpan(ctx, "ExportRecipientData")
+	defer span.End()
+
+	export := &DataExport{
+		Email:        email,
+		ExportedAt:   time.Now().UTC(),
+		Lists:        []string{},
+		Sends:        []SendExport{},
+		Clicks:       []ClickExport{},
+		Events:       []EventExport{},
+		TestSends:    []TestSend{},
+		DryRuns:      []DryRunMessage{},
+		ImportIssues: []ImportIssueExport{},
+	}
+
+	var err error
+	if export.Suppressed, err = IsSuppressed(ctx, email); err != nil {
+		return nil, err
+	}
+
+	if recipient, err := FindRecipient(ctx, email); err == nil {
+		if err := exportRecipient(ctx, export, int64(recipient.ID)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Envois de test, simulations et imports sont rattachés à l'adresse seule
+	rows, err := DB.QueryContext(ctx, `
+		SELECT id, campaign_id, email, provider, status, COALESCE(error_message, ''), sent_at
+		FROM test_sends WHERE email = ? COLLATE NOCASE ORDER BY id`, email)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t TestSend
+		if err := rows.Scan(&t.ID, &t.CampaignID, &t.Email, &t.Provider, &t.Status, &t.ErrorMessage, &t.SentAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.TestSends = append(export.TestSends, t)
+	}
+	rows.Close()
+
+	rows, err = DB.QueryContext(ctx, `SELECT `+dryRunColumns+` FROM dry_run_messages WHERE email = ? COLLATE NOCASE ORDER BY id`, email)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		m, err := scanDryRunMessage(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.DryRuns = append(export.DryRuns, m)
+	}
+	rows.Close()
+
+	rows, err = DB.QueryContext(ctx, `
+		SELECT import_id, line, email, kind, COALESCE(status, ''), COALESCE(suggestion, ''), reason
+		FROM import_issues WHERE email = ? COLLATE NOCASE ORDER BY import_id, line`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i ImportIssueExport
+		if err := rows.Scan(&i.ImportID, &i.Line, &i.Email, &i.Kind, &i.Status, &i.Suggestion, &i.Reason); err != nil {
+			return nil, err
+		}
+		export.ImportIssues = append(export.ImportIssues, i)
+	}
+
+	return export, rows.Err()
+}
+
+// exportRecipient ajoute la fiche, les listes, préférences, envois, clics et événements d'un destinataire
+func exportRecipient(ctx context.Context, export *DataExport, recipientID int64) error {
+	r := &RecipientExport{ID: recipientID}
+	var rawAttr string
+	err := DB.QueryRowContext(ctx, `SELECT email, attributes, unsubscribed_at, created_at FROM recipients WHERE id = ?`, recipientID).
+		Scan(&r.Email, &rawAttr, &r.UnsubscribedAt, &r.CreatedAt)
+	if err != nil {
+		return err
+	}
+	r.Attributes = decodeAttributes(rawAttr)
+
+	recipients := []Recipient{{ID: int(recipientID)}}
+	if err := attachTags(ctx, recipients); err != nil {
+		return err
+	}
+	r.Tags = recipients[0].Tags
+	if r.Consent, err = GetConsent(ctx, recipientID); err != nil {
+		return err
+	}
+	export.Recipient = r
+
+	if export.Preferences, err = GetPreferences(ctx, recipientID); err != nil {
+		return err
+	}
+
+	rows, err := DB.QueryContext(ctx, `
+		SELECT l.name FROM list_members m JOIN lists l ON l.id = m.list_id
+		WHERE m.recipient_id = ? ORDER BY l.name`, recipientID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		export.Lists = append(export.Lists, name)
+	}
+	rows.Close()
+
+	rows, err = DB.QueryContext(ctx, `
+		SELECT es.id, COALESCE(ec.campaign_id, 0), COALESCE(s.email, ''), ec.subject, ec.body,
+			es.status, COALESCE(es.error_message, ''), es.sent_at
+		FROM email_sends es
+		JOIN email_contents ec ON ec.id = es.content_id
+		LEFT JOIN senders s ON s.id = es.sender_id
+		WHERE es.recipient_id = ?
+		ORDER BY es.id`, recipientID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var s SendExport
+		if err := rows.Scan(&s.ID, &s.CampaignID, &s.SenderEmail, &s.Subject, &s.Body, &s.Status, &s.ErrorMessage, &s.SentAt); err != nil {
+			rows.Close()
+			return err
+		}
+		export.Sends = append(export.Sends, s)
+	}
+	rows.Close()
+
+	rows, err = DB.QueryContext(ctx, `
+		SELECT send_id, url, COALESCE(user_agent, ''), clicked_at
+		FROM email_clicks WHERE recipient_id = ? ORDER BY id`, recipientID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var c ClickExport
+		if err := rows.Scan(&c.SendID, &c.URL, &c.UserAgent, &c.ClickedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		export.Clicks = append(export.Clicks, c)
+	}
+	rows.Close()
+
+	rows, err = DB.QueryContext(ctx, `SELECT send_id, type, occurred_at FROM email_events WHERE recipient_id = ? ORDER BY id`, recipientID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e EventExport
+		if err := rows.Scan(&e.SendID, &e.Type, &e.OccurredAt); err != nil {
+			return err
+		}
+		export.Events = append(export.Events, e)
+	}
+
+	return rows.Err()
+}
+
+// EraseRecipient efface une adresse de toutes les tables. La fiche destinataire
+// et ses envois sont pseudonymisés pour garder les statistiques ; les données
+// personnelles (attributs, tags, listes, consentement, messages rendus) sont
+// supprimées. Une empreinte de l'adresse est ajoutée aux suppressions.
+func EraseRecipient(ctx context.Context, email, erasedBy string) (*ErasureReport, error) {
+	ctx, span := startSpan(ctx, "EraseRecipient")
+	defer span.End()
+
+	report := &ErasureReport{Email: email, Hash: SuppressionHash(email)}
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	exec := func(counter *int64, query string, args ...interface{}) error {
+		result, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		n, _ := result.RowsAffected()
+		*counter += n
+		return nil
+	}
+
+	// Données rattachées à l'adresse seule
+	for _, table := range []string{"test_sends", "dry_run_messages", "import_issues"} {
+		if err := exec(&report.Deleted, `DELETE FROM `+table+` WHERE email = ? COLLATE NOCASE`, email); err != nil {
+			return nil, err
+		}
+	}
+
+	// Toutes les fiches de l'adresse (d'éventuels doublons de casse compris)
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM recipients WHERE email = ? COLLATE NOCASE`, email)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		report.RecipientID = id
+		for _, table := range []string{"recipient_tags", "recipient_topics", "list_members", "import_recipients"} {
+			if err := exec(&report.Deleted, `DELETE FROM `+table+` WHERE recipient_id = ?`, id); err != nil {
+				return nil, err
+			}
+		}
+		if err := exec(&report.Pseudonymised, `UPDATE email_clicks SET user_agent = NULL WHERE recipient_id = ?`, id); err != nil {
+			return nil, err
+		}
+		if err := exec(&report.Pseudonymised, `UPDATE email_sends SET error_message = NULL WHERE recipient_id = ? AND error_message IS NOT NULL`, id); err != nil {
+			return nil, err
+		}
+		// Les messages de rebond et de plainte des providers citent souvent l'adresse
+		if err := exec(&report.Pseudonymised, `UPDATE email_events SET detail = NULL WHERE recipient_id = ? AND detail IS NOT NULL`, id); err != nil {
+			return nil, err
+		}
+
+		// La fiche reste pour les statistiques, sans donnée personnelle et bloquée à l'envoi
+		query := `
+			UPDATE recipients SET email = ?, attributes = '{}', consent_source = NULL, consent_ip = NULL,
+				consent_at = NULL, confirmed_at = NULL, confirmation_sent_at = NULL,
+				unsubscribed_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`
+		if err := exec(&report.Pseudonymised, query, fmt.Sprintf("erased-%d@erased.invalid", id), id); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO suppressions (hash, reason, created_by) VALUES (?, 'erasure', ?)`, report.Hash, erasedBy); err != nil {
+		return nil, err
+	}
+
+	return report, tx.Commit()
+}
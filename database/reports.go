@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SendReportRow est une ligne d'export : un envoi avec ses ouvertures et ses clics
+type SendReportRow struct {
+	SendID         int64
+	SentAt         time.Time
+	CampaignID     int64
+	CampaignName   string
+	SenderEmail    string
+	RecipientEmail string
+	Subject        string
+	Provider       string
+	Status         string
+	ErrorMessage   string
+	Opens          int
+	FirstOpenedAt  string
+	Clicks         int
+	FirstClickedAt string
+	ClickedURLs    string // URLs distinctes séparées par des espaces
+}
+
+// SendReportSummary totalise les lignes d'un export
+type SendReportSummary struct {
+	Total   int
+	Sent    int
+	Failed  int
+	Opened  int // envois ouverts au moins une fois
+	Clicked int // envois cliqués au moins une fois
+	Opens   int
+	Clicks  int
+}
+
+// Add ajoute une ligne aux totaux
+func (s *SendReportSummary) Add(row SendReportRow) {
+	s.Total++
+	switch row.Status {
+	case "sent":
+		s.Sent++
+	case "failed":
+		s.Failed++
+	}
+	if row.Opens > 0 {
+		s.Opened++
+	}
+	if row.Clicks > 0 {
+		s.Clicked++
+	}
+	s.Opens += row.Opens
+	s.Clicks += row.Clicks
+}
+
+// StreamSendReport parcourt les envois filtrés du plus ancien au plus récent et
+// appelle fn pour chacun, sans charger l'ensemble en mémoire. Cursor et Limit
+// du filtre sont ignorés.
+func StreamSendReport(ctx context.Context, filter HistoryFilter, fn func(SendReportRow) error) error {
+	ctx, span := startSpan(ctx, "StreamSendReport")
+	defer span.End()
+
+	filter.Cursor = 0
+	where, args := filter.where()
+
+	query := `
+		SELECT es.id, es.sent_at, COALESCE(ec.campaign_id, 0), COALESCE(cp.name, ''),
+			s.email, r.email, ec.subject, COALESCE(es.provider, ''), es.status, COALESCE(es.error_message, ''),
+			(SELECT COUNT(*) FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'open'),
+			COALESCE((SELECT MIN(ev.occurred_at) FROM email_events ev WHERE ev.send_id = es.id AND ev.type = 'open'), ''),
+			(SELECT COUNT(*) FROM email_clicks cl WHERE cl.send_id = es.id),
+			COALESCE((SELECT MIN(cl.clicked_at) FROM email_clicks cl WHERE cl.send_id = es.id), ''),
+			COALESCE((SELECT GROUP_CONCAT(url, ' ') FROM (SELECT DISTINCT cl.url FROM email_clicks cl WHERE cl.send_id = es.id)), '')
+		FROM email_sends es
+		JOIN email_contents ec ON es.content_id = ec.id
+		JOIN senders s ON es.sender_id = s.id
+		JOIN recipients r ON es.recipient_id = r.id
+		LEFT JOIN campaigns cp ON cp.id = ec.campaign_id
+		` + where + `
+		ORDER BY es.id
+	`
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row SendReportRow
+		err := rows.Scan(&row.SendID, &row.SentAt, &row.CampaignID, &row.CampaignName, &row.SenderEmail, &row.RecipientEmail,
+			&row.Subject, &row.Provider, &row.Status, &row.ErrorMessage, &row.Opens, &row.FirstOpenedAt,
+			&row.Clicks, &row.FirstClickedAt, &row.ClickedURLs)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RetentionPolicy définit combien de temps les données d'envoi sont conservées.
+// Une durée à 0 désactive la purge correspondante.
+type RetentionPolicy struct {
+	SendsDays           int        `json:"sends_days"`            // lignes email_sends
+	EventsDays          int        `json:"events_days"`           // clics et ouvertures enregistrés
+	PurgeOrphanContents bool       `json:"purge_orphan_contents"` // contenus plus référencés par aucun envoi
+	IntervalHours       int        `json:"interval_hours"`        // fréquence de la purge automatique
+	UpdatedBy           string     `json:"updated_by,omitempty"`
+	UpdatedAt           *time.Time `json:"updated_at,omitempty"`
+}
+
+// RetentionRun est le compte rendu d'une purge
+type RetentionRun struct {
+	ID              int64      `json:"id"`
+	Trigger         string     `json:"trigger"` // "schedule" ou "manual"
+	SendsDeleted    int64      `json:"sends_deleted"`
+	EventsDeleted   int64      `json:"events_deleted"`
+	ContentsDeleted int64      `json:"contents_deleted"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+}
+
+// orphanContentGrace protège les contenus tout juste créés dont les envois sont en cours
+const orphanContentGrace = "-1 day"
+
+// GetRetentionPolicy récupère les règles enregistrées, ou defaults si elles
+// n'ont jamais été modifiées
+func GetRetentionPolicy(ctx context.Context, defaults RetentionPolicy) (RetentionPolicy, error) {
+	ctx, span := startSpan(ctx, "GetRetentionPolicy")
+	defer span.End()
+
+	p := RetentionPolicy{}
+	query := `
+		SELECT sends_days, events_days, purge_orphan_contents, interval_hours, COALESCE(updated_by, ''), updated_at
+		FROM retention_policy WHERE id = 1
+	`
+	err := DB.QueryRowContext(ctx, query).Scan(&p.SendsDays, &p.EventsDays, &p.PurgeOrphanContents, &p.IntervalHours, &p.UpdatedBy, &p.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return defaults, nil
+	}
+	return p, err
+}
+
+// SaveRetentionPolicy enregistre les règles de conservation
+func SaveRetentionPolicy(ctx context.Context, p RetentionPolicy) error {
+	ctx, span := startSpan(ctx, "SaveRetentionPolicy")
+	defer span.End()
+
+	query := `
+		INSERT INTO retention_policy (id, sends_days, events_days, purge_orphan_contents, interval_hours, updated_by, updated_at)
+		VALUES (1, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(id) DO UPDATE SET
+			sends_days = excluded.sends_days, events_days = excluded.events_days,
+			purge_orphan_contents = excluded.purge_orphan_contents, interval_hours = excluded.interval_hours,
+			updated_by = excluded.updated_by, updated_at = excluded.updated_at
+	`
+	_, err := DB.ExecContext(ctx, query, p.SendsDays, p.EventsDays, p.PurgeOrphanContents, p.IntervalHours, p.UpdatedBy)
+	return err
+}
+
+// DeleteOldEvents supprime les clics et ouvertures plus vieux que X jours
+func DeleteOldEvents(ctx context.Context, days int) (int64, error) {
+	ctx, span := startSpan(ctx, "DeleteOldEvents")
+	defer span.End()
+
+	result, err := DB.ExecContext(ctx, `DELETE FROM email_clicks WHERE clicked_at < datetime('now', '-' || ? || ' days')`, days)
+	if err != nil {
+		return 0, err
+	}
+	clicks, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = DB.ExecContext(ctx, `DELETE FROM email_events WHERE occurred_at < datetime('now', '-' || ? || ' days')`, days)
+	if err != nil {
+		return 0, err
+	}
+	events, err := result.RowsAffected()
+	return clicks + events, err
+}
+
+// DeleteOrphanContents supprime les contenus (et leurs liens aux pièces jointes)
+// qui ne sont plus référencés par aucun envoi, clic, événement ou simulation
+func DeleteOrphanContents(ctx context.Context) (int64, error) {
+	ctx, span := startSpan(ctx, "DeleteOrphanContents")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	orphans := `
+		SELECT ec.id FROM email_contents ec
+		WHERE ec.created_at < datetime('now', ?)
+			AND NOT EXISTS (SELECT 1 FROM email_sends es WHERE es.content_id = ec.id)
+			AND NOT EXISTS (SELECT 1 FROM email_clicks cl WHERE cl.content_id = ec.id)
+			AND NOT EXISTS (SELECT 1 FROM email_events ev WHERE ev.content_id = ec.id)
+			AND NOT EXISTS (SELECT 1 FROM dry_run_messages dr WHERE dr.content_id = ec.id)
+	`
+	if _, err := tx.ExecContext(ctx, `DELETE FROM content_attachments WHERE content_id IN (`+orphans+`)`, orphanContentGrace); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM email_contents WHERE id IN (`+orphans+`)`, orphanContentGrace)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// CreateRetentionRun enregistre le compte rendu d'une purge terminée
+func CreateRetentionRun(ctx context.Context, run *RetentionRun) error {
+	ctx, span := startSpan(ctx, "CreateRetentionRun")
+	defer span.End()
+
+	query := `
+		INSERT INTO retention_runs (trigger, sends_deleted, events_deleted, contents_deleted, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	result, err := DB.ExecContext(ctx, query, run.Trigger, run.SendsDeleted, run.EventsDeleted, run.ContentsDeleted, run.Error,
+		run.StartedAt.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return err
+	}
+	run.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetRetentionRuns liste les dernières purges, la plus récente en premier
+func GetRetentionRuns(ctx context.Context, limit int) ([]RetentionRun, error) {
+	ctx, span := startSpan(ctx, "GetRetentionRuns")
+	defer span.End()
+
+	query := `
+		SELECT id, trigger, sends_deleted, events_deleted, contents_deleted, COALESCE(error, ''), started_at, finished_at
+		FROM retention_runs ORDER BY id DESC LIMIT ?
+	`
+	rows, err := DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []RetentionRun{}
+	for rows.Next() {
+		var r RetentionRun
+		if err := rows.Scan(&r.ID, &r.Trigger, &r.SendsDeleted, &r.EventsDeleted, &r.ContentsDeleted, &r.Error, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
@@ -0,0 +1,333 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Segment est une sélection dynamique de destinataires, recalculée à chaque utilisation
+type Segment struct {
+	ID        int64         `json:"id"`
+	Name      string        `json:"name"`
+	Match     string        `json:"match"` // "all" (toutes les règles) ou "any" (au moins une)
+	Rules     []SegmentRule `json:"rules"`
+	CreatedBy string        `json:"created_by"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// SegmentRule est une condition sur un destinataire :
+//
+//	attribute : Attribute + Operator "eq", "neq", "contains", "exists", "not_exists"
+//	email     : Operator "eq", "contains", "ends_with" (ex. "@gmail.com")
+//	list      : Operator "in", "not_in" ; Value = ID de la liste
+//	tag       : Operator "has", "not_has" ; Value = tag
+//	sent      : Operator "within", "not_within" ; Days = période (email reçu)
+//	opened    : Operator "within", "not_within" ; Days = période (email ouvert)
+//	clicked   : Operator "within", "not_within" ; Days = période (lien cliqué)
+//	created   : Operator "within", "not_within" ; Days = période (date d'ajout)
+type SegmentRule struct {
+	Type      string `json:"type"`
+	Attribute string `json:"attribute,omitempty"`
+	Operator  string `json:"operator"`
+	Value     string `json:"value,omitempty"`
+	Days      int    `json:"days,omitempty"`
+}
+
+// CreateSegment enregistre un segment après validation de ses règles
+func CreateSegment(ctx context.Context, s *Segment) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateSegment")
+	defer span.End()
+
+	if s.Match == "" {
+		s.Match = "all"
+	}
+	if _, _, err := segmentWhere(s.Match, s.Rules); err != nil {
+		return 0, err
+	}
+	rules, err := json.Marshal(s.Rules)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := DB.ExecContext(ctx, `INSERT INTO segments (name, match, rules, created_by) VALUES (?, ?, ?, ?)`,
+		s.Name, s.Match, string(rules), s.CreatedBy)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateSegment remplace le nom et les règles d'un segment
+func UpdateSegment(ctx context.Context, s *Segment) error {
+	ctx, span := startSpan(ctx, "UpdateSegment")
+	defer span.End()
+
+	if s.Match == "" {
+		s.Match = "all"
+	}
+	if _, _, err := segmentWhere(s.Match, s.Rules); err != nil {
+		return err
+	}
+	rules, err := json.Marshal(s.Rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = DB.ExecContext(ctx, `UPDATE segments SET name = ?, match = ?, rules = ? WHERE id = ?`, s.Name, s.Match, string(rules), s.ID)
+	return err
+}
+
+// DeleteSegment supprime un segment
+func DeleteSegment(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "DeleteSegment")
+	defer span.End()
+
+	_, err := DB.ExecContext(ctx, `DELETE FROM segments WHERE id = ?`, id)
+	return err
+}
+
+// GetSegment récupère un segment par son ID
+func GetSegment(ctx context.Context, id int64) (*Segment, error) {
+	ctx, span := startSpan(ctx, "GetSegment")
+	defer span.End()
+
+	s, err := scanSegment(DB.QueryRowContext(ctx, `SELECT id, name, match, rules, COALESCE(created_by, ''), created_at FROM segments WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetAllSegments liste les segments par nom
+func GetAllSegments(ctx context.Context) ([]Segment, error) {
+	ctx, span := startSpan(ctx, "GetAllSegments")
+	defer span.End()
+
+	rows, err := DB.QueryContext(ctx, `SELECT id, name, match, rules, COALESCE(created_by, ''), created_at FROM segments ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []Segment
+	for rows.Next() {
+		s, err := scanSegment(rows)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+
+	return segments, rows.Err()
+}
+
+func scanSegment(row interface{ Scan(...interface{}) error }) (Segment, error) {
+	var (
+		s     Segment
+		rules string
+	)
+	if err := row.Scan(&s.ID, &s.Name, &s.Match, &rules, &s.CreatedBy, &s.CreatedAt); err != nil {
+		return s, err
+	}
+	json.Unmarshal([]byte(rules), &s.Rules)
+	return s, nil
+}
+
+// GetSegmentRecipients évalue un segment ; limit <= 0 retourne tous les destinataires
+func GetSegmentRecipients(ctx context.Context, s *Segment, limit int) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "GetSegmentRecipients")
+	defer span.End()
+
+	where, args, err := segmentWhere(s.Match, s.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT r.id, r.email, r.attributes, r.created_at FROM recipients r WHERE ` + where + ` ORDER BY r.id`
+	if limit > 0 {
+		query += ` LIMIT ` + strconv.Itoa(limit)
+	}
+	return queryRecipients(ctx, query, args...)
+}
+
+// CountSegmentRecipients compte les destinataires d'un segment
+func CountSegmentRecipients(ctx context.Context, s *Segment) (int, error) {
+	ctx, span := startSpan(ctx, "CountSegmentRecipients")
+	defer span.End()
+
+	where, args, err := segmentWhere(s.Match, s.Rules)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	err = DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM recipients r WHERE `+where, args...).Scan(&count)
+	return count, err
+}
+
+// ResolveAudience retourne, sans doublon, les destinataires des listes et segments donnés
+func ResolveAudience(ctx context.Context, listIDs, segmentIDs []int64) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "ResolveAudience")
+	defer span.End()
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	for _, id := range listIDs {
+		if _, err := GetList(ctx, id); err != nil {
+			return nil, fmt.Errorf("liste %d introuvable", id)
+		}
+		conditions = append(conditions, `r.id IN (SELECT recipient_id FROM list_members WHERE list_id = ?)`)
+		args = append(args, id)
+	}
+
+	for _, id := range segmentIDs {
+		segment, err := GetSegment(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d introuvable", id)
+		}
+		where, segmentArgs, err := segmentWhere(segment.Match, segment.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("segment %q: %v", segment.Name, err)
+		}
+		conditions = append(conditions, "("+where+")")
+		args = append(args, segmentArgs...)
+	}
+
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT r.id, r.email, r.attributes, r.created_at FROM recipients r WHERE ` +
+		strings.Join(conditions, " OR ") + ` ORDER BY r.id`
+	return queryRecipients(ctx, query, args...)
+}
+
+// pendingConsent désigne un destinataire créé par l'inscription publique
+// (double opt-in) qui n'a pas encore confirmé
+const pendingConsent = `r.signup_pending = 1`
+
+// segmentWhere traduit les règles d'un segment en clause WHERE sur recipients r ;
+// les inscriptions non confirmées sont toujours exclues
+func segmentWhere(match string, rules []SegmentRule) (string, []interface{}, error) {
+	if len(rules) == 0 {
+		return "", nil, fmt.Errorf("segment sans règle")
+	}
+
+	joiner := " AND "
+	switch match {
+	case "", "all":
+	case "any":
+		joiner = " OR "
+	default:
+		return "", nil, fmt.Errorf("match invalide: %s", match)
+	}
+
+	var (
+		clauses []string
+		args    []interface{}
+	)
+	for i, rule := range rules {
+		clause, ruleArgs, err := ruleWhere(rule)
+		if err != nil {
+			return "", nil, fmt.Errorf("règle %d: %v", i+1, err)
+		}
+		clauses = append(clauses, "("+clause+")")
+		args = append(args, ruleArgs...)
+	}
+
+	return "(" + strings.Join(clauses, joiner) + ") AND NOT (" + pendingConsent + ")", args, nil
+}
+
+func ruleWhere(rule SegmentRule) (string, []interface{}, error) {
+	switch rule.Type {
+	case "attribute":
+		if rule.Attribute == "" {
+			return "", nil, fmt.Errorf("attribut requis")
+		}
+		path := `$."` + strings.ReplaceAll(rule.Attribute, `"`, `\"`) + `"`
+		switch rule.Operator {
+		case "eq":
+			return `json_extract(r.attributes, ?) = ?`, []interface{}{path, rule.Value}, nil
+		case "neq":
+			return `COALESCE(json_extract(r.attributes, ?), '') != ?`, []interface{}{path, rule.Value}, nil
+		case "contains":
+			return `instr(lower(json_extract(r.attributes, ?)), lower(?)) > 0`, []interface{}{path, rule.Value}, nil
+		case "exists":
+			return `COALESCE(json_extract(r.attributes, ?), '') != ''`, []interface{}{path}, nil
+		case "not_exists":
+			return `COALESCE(json_extract(r.attributes, ?), '') = ''`, []interface{}{path}, nil
+		}
+
+	case "email":
+		switch rule.Operator {
+		case "eq":
+			return `r.email = ? COLLATE NOCASE`, []interface{}{rule.Value}, nil
+		case "contains":
+			return `instr(lower(r.email), lower(?)) > 0`, []interface{}{rule.Value}, nil
+		case "ends_with":
+			return `lower(r.email) LIKE '%' || lower(?)`, []interface{}{rule.Value}, nil
+		}
+
+	case "list":
+		listID, err := strconv.ParseInt(rule.Value, 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("ID de liste invalide")
+		}
+		clause := `r.id IN (SELECT recipient_id FROM list_members WHERE list_id = ?)`
+		switch rule.Operator {
+		case "in":
+			return clause, []interface{}{listID}, nil
+		case "not_in":
+			return `NOT ` + clause, []interface{}{listID}, nil
+		}
+
+	case "tag":
+		if rule.Value == "" {
+			return "", nil, fmt.Errorf("tag requis")
+		}
+		clause := `EXISTS (SELECT 1 FROM recipient_tags t WHERE t.recipient_id = r.id AND t.tag = ?)`
+		tag := strings.ToLower(strings.TrimSpace(rule.Value))
+		switch rule.Operator {
+		case "has":
+			return clause, []interface{}{tag}, nil
+		case "not_has":
+			return `NOT ` + clause, []interface{}{tag}, nil
+		}
+
+	case "sent", "opened", "clicked", "created":
+		if rule.Days <= 0 {
+			return "", nil, fmt.Errorf("nombre de jours requis")
+		}
+		since := fmt.Sprintf("-%d days", rule.Days)
+
+		var clause string
+		switch rule.Type {
+		case "sent":
+			clause = `EXISTS (SELECT 1 FROM email_sends s WHERE s.recipient_id = r.id AND s.status = 'sent' AND s.sent_at >= datetime('now', ?))`
+		case "opened":
+			clause = `EXISTS (SELECT 1 FROM email_events e WHERE e.recipient_id = r.id AND e.type = 'open' AND e.occurred_at >= datetime('now', ?))`
+		case "clicked":
+			clause = `EXISTS (SELECT 1 FROM email_clicks c WHERE c.recipient_id = r.id AND c.clicked_at >= datetime('now', ?))`
+		case "created":
+			clause = `r.created_at >= datetime('now', ?)`
+		}
+		switch rule.Operator {
+		case "within":
+			return clause, []interface{}{since}, nil
+		case "not_within":
+			return `NOT ` + clause, []interface{}{since}, nil
+		}
+
+	default:
+		return "", nil, fmt.Errorf("type de règle inconnu: %s", rule.Type)
+	}
+
+	return "", nil, fmt.Errorf("opérateur %q invalide pour %s", rule.Operator, rule.Type)
+}
@@ -1,12 +1,12 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var DB *sql.DB
@@ -29,9 +29,11 @@ type Sender struct {
 
 // Recipient représente un destinataire (importé depuis CSV)
 type Recipient struct {
-	ID        int
-	Email     string
-	CreatedAt time.Time
+	ID         int
+	Email      string
+	Attributes map[string]string
+	Tags       []string
+	CreatedAt  time.Time
 }
 
 // EmailSend représente un envoi d'email (historique)
@@ -50,7 +52,7 @@ func Init() error {
 	var err error
 
 	// Créer/ouvrir la base de données
-	DB, err = sql.Open("sqlite3", "./emails.db")
+	DB, err = sql.Open(driverName, "./emails.db")
 	if err != nil {
 		return fmt.Errorf("erreur ouverture DB: %v", err)
 	}
@@ -65,7 +67,17 @@ func Init() error {
 		return fmt.Errorf("erreur création tables: %v", err)
 	}
 
-	log.Println("✅ SQLite initialisé avec succès")
+	// Mettre à jour les tables existantes
+	if err = migrateTables(); err != nil {
+		return fmt.Errorf("erreur migration tables: %v", err)
+	}
+
+	// Reprendre les campagnes laissées en cours par un arrêt brutal
+	if err = recoverSendingCampaigns(); err != nil {
+		return fmt.Errorf("erreur reprise campagnes: %v", err)
+	}
+
+	slog.Info("SQLite initialisé")
 	return nil
 }
 
@@ -77,6 +89,8 @@ func createTables() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		subject TEXT NOT NULL,
 		body TEXT NOT NULL,
+		template_version_id INTEGER,
+		campaign_id INTEGER,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -92,6 +106,14 @@ func createTables() error {
 	CREATE TABLE IF NOT EXISTS recipients (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		email TEXT UNIQUE NOT NULL,
+		attributes TEXT NOT NULL DEFAULT '{}',
+		consent_source TEXT,
+		consent_ip TEXT,
+		consent_at DATETIME,
+		confirmed_at DATETIME,
+		confirmation_sent_at DATETIME,
+		signup_pending BOOLEAN NOT NULL DEFAULT 0,
+		unsubscribed_at DATETIME,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 
@@ -101,6 +123,7 @@ func createTables() error {
 		content_id INTEGER NOT NULL,
 		sender_id INTEGER NOT NULL,
 		recipient_id INTEGER NOT NULL,
+		provider TEXT,
 		status TEXT NOT NULL,
 		error_message TEXT,
 		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
@@ -109,6 +132,288 @@ func createTables() error {
 		FOREIGN KEY (recipient_id) REFERENCES recipients(id)
 	);
 
+	-- Table des clics sur les liens suivis
+	CREATE TABLE IF NOT EXISTS email_clicks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		send_id INTEGER,
+		content_id INTEGER NOT NULL,
+		recipient_id INTEGER NOT NULL,
+		link_index INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		user_agent TEXT,
+		clicked_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (send_id) REFERENCES email_sends(id),
+		FOREIGN KEY (content_id) REFERENCES email_contents(id),
+		FOREIGN KEY (recipient_id) REFERENCES recipients(id)
+	);
+
+	-- Événements de suivi par envoi (ouvertures, délivrabilité, désinscriptions)
+	CREATE TABLE IF NOT EXISTS email_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		send_id INTEGER,
+		content_id INTEGER NOT NULL,
+		recipient_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		detail TEXT,
+		occurred_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (send_id) REFERENCES email_sends(id),
+		FOREIGN KEY (content_id) REFERENCES email_contents(id),
+		FOREIGN KEY (recipient_id) REFERENCES recipients(id)
+	);
+
+	-- Bibliothèque de templates
+	CREATE TABLE IF NOT EXISTS email_templates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Versions des templates (jamais modifiées une fois créées)
+	CREATE TABLE IF NOT EXISTS template_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		template_id INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		preview_text TEXT,
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (template_id, version),
+		FOREIGN KEY (template_id) REFERENCES email_templates(id)
+	);
+
+	-- Pièces jointes (fichiers stockés sur disque)
+	CREATE TABLE IF NOT EXISTS attachments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		path TEXT NOT NULL,
+		inline BOOLEAN NOT NULL DEFAULT 0,
+		cid TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Pièces jointes envoyées avec chaque contenu
+	CREATE TABLE IF NOT EXISTS content_attachments (
+		content_id INTEGER NOT NULL,
+		attachment_id INTEGER NOT NULL,
+		PRIMARY KEY (content_id, attachment_id),
+		FOREIGN KEY (content_id) REFERENCES email_contents(id),
+		FOREIGN KEY (attachment_id) REFERENCES attachments(id)
+	);
+
+	-- Campagnes (brouillons puis envois)
+	CREATE TABLE IF NOT EXISTS campaigns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		body TEXT NOT NULL,
+		text_body TEXT,
+		provider TEXT NOT NULL,
+		sender_name TEXT,
+		track_clicks BOOLEAN NOT NULL DEFAULT 0,
+		track_opens BOOLEAN NOT NULL DEFAULT 0,
+		template_version_id INTEGER,
+		attachment_ids TEXT,
+		list_ids TEXT,
+		segment_ids TEXT,
+		click_tags TEXT,
+		topic_id INTEGER,
+		status TEXT NOT NULL DEFAULT 'draft',
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		launched_at DATETIME,
+		FOREIGN KEY (template_version_id) REFERENCES template_versions(id)
+	);
+
+	-- Envois de test (hors historique réel)
+	CREATE TABLE IF NOT EXISTS test_sends (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		email TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error_message TEXT,
+		sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);
+
+	-- Messages rendus lors des simulations (dry run)
+	CREATE TABLE IF NOT EXISTS dry_run_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER,
+		content_id INTEGER NOT NULL,
+		email TEXT NOT NULL,
+		sender_email TEXT,
+		subject TEXT,
+		html TEXT,
+		text TEXT,
+		status TEXT NOT NULL,
+		reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id),
+		FOREIGN KEY (content_id) REFERENCES email_contents(id)
+	);
+
+	-- Cache des vérifications DNS (MX/A) des domaines destinataires
+	CREATE TABLE IF NOT EXISTS domain_checks (
+		domain TEXT PRIMARY KEY,
+		status TEXT NOT NULL,
+		detail TEXT,
+		checked_at DATETIME NOT NULL
+	);
+
+	-- Imports de fichiers de destinataires en arrière-plan
+	CREATE TABLE IF NOT EXISTS import_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		filename TEXT NOT NULL,
+		format TEXT,
+		path TEXT,
+		status TEXT NOT NULL,
+		processed INTEGER NOT NULL DEFAULT 0,
+		inserted INTEGER NOT NULL DEFAULT 0,
+		updated INTEGER NOT NULL DEFAULT 0,
+		rejected INTEGER NOT NULL DEFAULT 0,
+		flagged INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS import_recipients (
+		import_id INTEGER NOT NULL,
+		recipient_id INTEGER NOT NULL,
+		PRIMARY KEY (import_id, recipient_id),
+		FOREIGN KEY (import_id) REFERENCES import_jobs(id),
+		FOREIGN KEY (recipient_id) REFERENCES recipients(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS import_issues (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		import_id INTEGER NOT NULL,
+		line INTEGER NOT NULL,
+		email TEXT,
+		kind TEXT NOT NULL,
+		status TEXT,
+		suggestion TEXT,
+		reason TEXT NOT NULL,
+		FOREIGN KEY (import_id) REFERENCES import_jobs(id)
+	);
+
+	-- Tags libres posés sur les destinataires (en minuscules)
+	CREATE TABLE IF NOT EXISTS recipient_tags (
+		recipient_id INTEGER NOT NULL,
+		tag TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (recipient_id, tag),
+		FOREIGN KEY (recipient_id) REFERENCES recipients(id)
+	);
+
+	-- Thèmes de communication et choix des destinataires (centre de préférences)
+	CREATE TABLE IF NOT EXISTS topics (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		key TEXT UNIQUE NOT NULL,
+		name TEXT NOT NULL,
+		description TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS recipient_topics (
+		recipient_id INTEGER NOT NULL,
+		topic_id INTEGER NOT NULL,
+		subscribed BOOLEAN NOT NULL DEFAULT 1,
+		frequency TEXT NOT NULL DEFAULT 'all',
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (recipient_id, topic_id),
+		FOREIGN KEY (recipient_id) REFERENCES recipients(id),
+		FOREIGN KEY (topic_id) REFERENCES topics(id)
+	);
+
+	-- Empreintes des adresses effacées (RGPD), à ne plus jamais contacter
+	CREATE TABLE IF NOT EXISTS suppressions (
+		hash TEXT PRIMARY KEY,
+		reason TEXT NOT NULL,
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Listes nommées de destinataires
+	CREATE TABLE IF NOT EXISTS lists (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		description TEXT,
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS list_members (
+		list_id INTEGER NOT NULL,
+		recipient_id INTEGER NOT NULL,
+		added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (list_id, recipient_id),
+		FOREIGN KEY (list_id) REFERENCES lists(id),
+		FOREIGN KEY (recipient_id) REFERENCES recipients(id)
+	);
+
+	-- Segments : règles sur les attributs et l'engagement, évaluées à l'envoi
+	CREATE TABLE IF NOT EXISTS segments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT UNIQUE NOT NULL,
+		match TEXT NOT NULL DEFAULT 'all',
+		rules TEXT NOT NULL,
+		created_by TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Règles de conservation des données (une seule ligne, id = 1)
+	CREATE TABLE IF NOT EXISTS retention_policy (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		sends_days INTEGER NOT NULL DEFAULT 0,
+		events_days INTEGER NOT NULL DEFAULT 0,
+		purge_orphan_contents INTEGER NOT NULL DEFAULT 1,
+		interval_hours INTEGER NOT NULL DEFAULT 24,
+		updated_by TEXT,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Historique des purges de conservation
+	CREATE TABLE IF NOT EXISTS retention_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		trigger TEXT NOT NULL,
+		sends_deleted INTEGER NOT NULL DEFAULT 0,
+		events_deleted INTEGER NOT NULL DEFAULT 0,
+		contents_deleted INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);
+
+	-- Agrégats horaires pour les tableaux de bord (conservés après la purge des envois)
+	CREATE TABLE IF NOT EXISTS analytics_rollup (
+		bucket TEXT NOT NULL,
+		campaign_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		domain TEXT NOT NULL,
+		sent INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		delivered INTEGER NOT NULL DEFAULT 0,
+		bounced INTEGER NOT NULL DEFAULT 0,
+		complained INTEGER NOT NULL DEFAULT 0,
+		opened INTEGER NOT NULL DEFAULT 0,
+		clicked INTEGER NOT NULL DEFAULT 0,
+		unsubscribed INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (bucket, campaign_id, provider, domain)
+	);
+
+	CREATE TABLE IF NOT EXISTS analytics_state (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		refreshed_at DATETIME
+	);
+
 	-- Index pour performances
 	CREATE INDEX IF NOT EXISTS idx_content_id ON email_sends(content_id);
 	CREATE INDEX IF NOT EXISTS idx_sender_id ON email_sends(sender_id);
@@ -116,17 +421,101 @@ func createTables() error {
 	CREATE INDEX IF NOT EXISTS idx_status ON email_sends(status);
 	CREATE INDEX IF NOT EXISTS idx_sent_at ON email_sends(sent_at);
 	CREATE INDEX IF NOT EXISTS idx_recipient_email ON recipients(email);
+	CREATE INDEX IF NOT EXISTS idx_recipient_email_nocase ON recipients(email COLLATE NOCASE);
 	CREATE INDEX IF NOT EXISTS idx_sender_email ON senders(email);
+	CREATE INDEX IF NOT EXISTS idx_click_send_id ON email_clicks(send_id);
+	CREATE INDEX IF NOT EXISTS idx_click_content_id ON email_clicks(content_id);
+	CREATE INDEX IF NOT EXISTS idx_recipient_tags_tag ON recipient_tags(tag);
+	CREATE INDEX IF NOT EXISTS idx_list_members_recipient ON list_members(recipient_id);
+	CREATE INDEX IF NOT EXISTS idx_click_recipient_id ON email_clicks(recipient_id);
+	CREATE INDEX IF NOT EXISTS idx_import_issues ON import_issues(import_id, line);
+	CREATE INDEX IF NOT EXISTS idx_dry_run_campaign ON dry_run_messages(campaign_id, content_id);
+	CREATE INDEX IF NOT EXISTS idx_click_clicked_at ON email_clicks(clicked_at);
+	CREATE INDEX IF NOT EXISTS idx_event_send_id ON email_events(send_id, type);
+	CREATE INDEX IF NOT EXISTS idx_event_occurred_at ON email_events(occurred_at);
+	CREATE INDEX IF NOT EXISTS idx_event_recipient ON email_events(recipient_id, type);
+	CREATE INDEX IF NOT EXISTS idx_rollup_campaign ON analytics_rollup(campaign_id, bucket);
 	`
 
 	_, err := DB.Exec(schema)
 	return err
 }
 
-// InsertEmailContent insère un contenu d'email et retourne son ID
-func InsertEmailContent(subject, body string) (int64, error) {
-	query := `INSERT INTO email_contents (subject, body) VALUES (?, ?)`
-	result, err := DB.Exec(query, subject, body)
+// migrateTables ajoute les colonnes apparues après la création initiale des tables
+func migrateTables() error {
+	migrations := []struct{ table, column, definition string }{
+		{"recipients", "attributes", "TEXT NOT NULL DEFAULT '{}'"},
+		{"email_contents", "template_version_id", "INTEGER"},
+		{"email_contents", "campaign_id", "INTEGER"},
+		{"import_jobs", "format", "TEXT"},
+		{"import_jobs", "path", "TEXT"},
+		{"campaigns", "list_ids", "TEXT"},
+		{"campaigns", "segment_ids", "TEXT"},
+		{"campaigns", "click_tags", "TEXT"},
+		{"recipients", "consent_source", "TEXT"},
+		{"recipients", "consent_ip", "TEXT"},
+		{"recipients", "consent_at", "DATETIME"},
+		{"recipients", "confirmed_at", "DATETIME"},
+		{"recipients", "confirmation_sent_at", "DATETIME"},
+		{"recipients", "unsubscribed_at", "DATETIME"},
+		{"campaigns", "topic_id", "INTEGER"},
+		{"email_sends", "provider", "TEXT"},
+		{"campaigns", "track_opens", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"recipients", "signup_pending", "BOOLEAN NOT NULL DEFAULT 0"},
+	}
+
+	for _, m := range migrations {
+		if err := addColumnIfMissing(m.table, m.column, m.definition); err != nil {
+			return err
+		}
+	}
+
+	// Index sur des colonnes ajoutées par migration
+	_, err := DB.Exec(`CREATE INDEX IF NOT EXISTS idx_content_campaign ON email_contents(campaign_id)`)
+	return err
+}
+
+// addColumnIfMissing ajoute une colonne à une table si elle n'existe pas encore
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, colType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// InsertEmailContent insère un contenu d'email et retourne son ID.
+// templateVersionID et campaignID valent 0 quand ils ne s'appliquent pas.
+func InsertEmailContent(ctx context.Context, subject, body string, templateVersionID, campaignID int64) (int64, error) {
+	ctx, span := startSpan(ctx, "InsertEmailContent")
+	defer span.End()
+
+	query := `
+		INSERT INTO email_contents (subject, body, template_version_id, campaign_id)
+		VALUES (?, ?, NULLIF(?, 0), NULLIF(?, 0))
+	`
+	result, err := DB.ExecContext(ctx, query, subject, body, templateVersionID, campaignID)
 	if err != nil {
 		return 0, err
 	}
@@ -134,16 +523,19 @@ func InsertEmailContent(subject, body string) (int64, error) {
 }
 
 // InsertOrGetSender insère un sender ou retourne son ID s'il existe
-func InsertOrGetSender(email, displayName string) (int64, error) {
+func InsertOrGetSender(ctx context.Context, email, displayName string) (int64, error) {
+	ctx, span := startSpan(ctx, "InsertOrGetSender")
+	defer span.End()
+
 	// Vérifier si le sender existe déjà
 	var id int64
 	query := `SELECT id FROM senders WHERE email = ?`
-	err := DB.QueryRow(query, email).Scan(&id)
+	err := DB.QueryRowContext(ctx, query, email).Scan(&id)
 
 	if err == sql.ErrNoRows {
 		// Insérer le nouveau sender
 		insertQuery := `INSERT INTO senders (email, display_name) VALUES (?, ?)`
-		result, err := DB.Exec(insertQuery, email, displayName)
+		result, err := DB.ExecContext(ctx, insertQuery, email, displayName)
 		if err != nil {
 			return 0, err
 		}
@@ -154,92 +546,124 @@ func InsertOrGetSender(email, displayName string) (int64, error) {
 }
 
 // InsertOrGetRecipient insère un recipient ou retourne son ID s'il existe
-func InsertOrGetRecipient(email string) (int64, error) {
+func InsertOrGetRecipient(ctx context.Context, email string) (int64, error) {
+	ctx, span := startSpan(ctx, "InsertOrGetRecipient")
+	defer span.End()
+
+	return UpsertRecipient(ctx, email, nil)
+}
+
+// UpsertRecipient insère un recipient ou fusionne ses attributs avec ceux existants
+func UpsertRecipient(ctx context.Context, email string, attributes map[string]string) (int64, error) {
+	ctx, span := startSpan(ctx, "UpsertRecipient")
+	defer span.End()
+
+	id, _, err := upsertRecipient(ctx, DB, email, attributes)
+	return id, err
+}
+
+// execQuerier est implémenté par *sql.DB et *sql.Tx
+type execQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// upsertRecipient retourne aussi si le recipient vient d'être créé ; une adresse
+// ne différant que par la casse d'un recipient existant met à jour ce dernier
+func upsertRecipient(ctx context.Context, q execQuerier, email string, attributes map[string]string) (int64, bool, error) {
 	// Vérifier si le recipient existe déjà
-	var id int64
-	query := `SELECT id FROM recipients WHERE email = ?`
-	err := DB.QueryRow(query, email).Scan(&id)
+	var (
+		id      int64
+		rawAttr string
+	)
+	query := `SELECT id, attributes FROM recipients WHERE email = ? COLLATE NOCASE ORDER BY id LIMIT 1`
+	err := q.QueryRowContext(ctx, query, email).Scan(&id, &rawAttr)
 
 	if err == sql.ErrNoRows {
+		// Une adresse effacée (RGPD) ne doit pas être recréée
+		if suppressed, err := isSuppressed(ctx, q, email); err != nil || suppressed {
+			if err == nil {
+				err = ErrSuppressed
+			}
+			return 0, false, err
+		}
+
 		// Insérer le nouveau recipient
-		insertQuery := `INSERT INTO recipients (email) VALUES (?)`
-		result, err := DB.Exec(insertQuery, email)
+		encoded, err := encodeAttributes(attributes)
 		if err != nil {
-			return 0, err
+			return 0, false, err
 		}
-		return result.LastInsertId()
+		insertQuery := `INSERT INTO recipients (email, attributes) VALUES (?, ?)`
+		result, err := q.ExecContext(ctx, insertQuery, email, encoded)
+		if err != nil {
+			return 0, false, err
+		}
+		id, err := result.LastInsertId()
+		return id, true, err
+	}
+	if err != nil || len(attributes) == 0 {
+		return id, false, err
 	}
 
-	return id, err
+	// Fusionner les nouveaux attributs avec les anciens
+	merged := decodeAttributes(rawAttr)
+	for key, value := range attributes {
+		merged[key] = value
+	}
+	encoded, err := encodeAttributes(merged)
+	if err != nil {
+		return 0, false, err
+	}
+	_, err = q.ExecContext(ctx, `UPDATE recipients SET attributes = ? WHERE id = ?`, encoded, id)
+	return id, false, err
+}
+
+func encodeAttributes(attributes map[string]string) (string, error) {
+	if len(attributes) == 0 {
+		return "{}", nil
+	}
+	data, err := json.Marshal(attributes)
+	return string(data), err
+}
+
+func decodeAttributes(raw string) map[string]string {
+	attributes := map[string]string{}
+	json.Unmarshal([]byte(raw), &attributes)
+	return attributes
 }
 
 // InsertEmailSend enregistre un envoi d'email
-func InsertEmailSend(contentID, senderID, recipientID int64, status, errorMessage string) error {
+func InsertEmailSend(ctx context.Context, contentID, senderID, recipientID int64, provider, status, errorMessage string) error {
+	ctx, span := startSpan(ctx, "InsertEmailSend")
+	defer span.End()
+
 	query := `
-		INSERT INTO email_sends (content_id, sender_id, recipient_id, status, error_message)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO email_sends (content_id, sender_id, recipient_id, provider, status, error_message)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
-	_, err := DB.Exec(query, contentID, senderID, recipientID, status, errorMessage)
+	_, err := DB.ExecContext(ctx, query, contentID, senderID, recipientID, provider, status, errorMessage)
 	return err
 }
 
-// GetAllEmailSends récupère tous les envois avec leurs détails
-func GetAllEmailSends() ([]map[string]interface{}, error) {
-	query := `
-		SELECT 
-			es.id,
-			s.email as sender_email,
-			s.display_name as sender_name,
-			r.email as recipient_email,
-			ec.subject,
-			ec.body,
-			es.status,
-			es.error_message,
-			es.sent_at
-		FROM email_sends es
-		JOIN email_contents ec ON es.content_id = ec.id
-		JOIN senders s ON es.sender_id = s.id
-		JOIN recipients r ON es.recipient_id = r.id
-		ORDER BY es.sent_at DESC
-	`
+// GetEmailContent récupère un contenu envoyé par son ID
+func GetEmailContent(ctx context.Context, id int64) (*EmailContent, error) {
+	ctx, span := startSpan(ctx, "GetEmailContent")
+	defer span.End()
 
-	rows, err := DB.Query(query)
+	var c EmailContent
+	err := DB.QueryRowContext(ctx, `SELECT id, subject, body, created_at FROM email_contents WHERE id = ?`, id).
+		Scan(&c.ID, &c.Subject, &c.Body, &c.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	var results []map[string]interface{}
-	for rows.Next() {
-		var (
-			id, senderEmail, senderName, recipientEmail string
-			subject, body, status, errorMessage, sentAt string
-		)
-
-		err := rows.Scan(&id, &senderEmail, &senderName, &recipientEmail,
-			&subject, &body, &status, &errorMessage, &sentAt)
-		if err != nil {
-			return nil, err
-		}
-
-		results = append(results, map[string]interface{}{
-			"id":              id,
-			"sender_email":    senderEmail,
-			"sender_name":     senderName,
-			"recipient_email": recipientEmail,
-			"subject":         subject,
-			"body":            body,
-			"status":          status,
-			"error_message":   errorMessage,
-			"sent_at":         sentAt,
-		})
-	}
-
-	return results, nil
+	return &c, nil
 }
 
 // GetStats récupère les statistiques globales
-func GetStats() (map[string]interface{}, error) {
+func GetStats(ctx context.Context) (map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "GetStats")
+	defer span.End()
+
 	query := `
 		SELECT 
 			COUNT(*) as total,
@@ -249,15 +673,15 @@ func GetStats() (map[string]interface{}, error) {
 	`
 
 	var total, sent, failed int
-	err := DB.QueryRow(query).Scan(&total, &sent, &failed)
+	err := DB.QueryRowContext(ctx, query).Scan(&total, &sent, &failed)
 	if err != nil {
 		return nil, err
 	}
 
 	// Compter les recipients et senders
 	var recipientCount, senderCount int
-	DB.QueryRow("SELECT COUNT(*) FROM recipients").Scan(&recipientCount)
-	DB.QueryRow("SELECT COUNT(*) FROM senders").Scan(&senderCount)
+	DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM recipients").Scan(&recipientCount)
+	DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM senders").Scan(&senderCount)
 
 	return map[string]interface{}{
 		"total_sends":      total,
@@ -268,32 +692,49 @@ func GetStats() (map[string]interface{}, error) {
 	}, nil
 }
 
-// GetRecipientsByEmail recherche des recipients par email
-func GetRecipientsByEmail(email string) ([]Recipient, error) {
-	query := `SELECT id, email, created_at FROM recipients WHERE email LIKE ?`
-	rows, err := DB.Query(query, "%"+email+"%")
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// GetRecipientsByEmail recherche des recipients par email, restreints par tags
+func GetRecipientsByEmail(ctx context.Context, email string, tags TagFilter) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "GetRecipientsByEmail")
+	defer span.End()
 
-	var recipients []Recipient
-	for rows.Next() {
-		var r Recipient
-		err := rows.Scan(&r.ID, &r.Email, &r.CreatedAt)
-		if err != nil {
-			return nil, err
-		}
-		recipients = append(recipients, r)
-	}
+	return SearchRecipients(ctx, RecipientFilter{TagFilter: tags, Email: email})
+}
+
+// GetRecipient récupère un recipient par son ID
+func GetRecipient(ctx context.Context, id int64) (*Recipient, error) {
+	ctx, span := startSpan(ctx, "GetRecipient")
+	defer span.End()
+
+	return getRecipient(ctx, `SELECT id, email, attributes, created_at FROM recipients WHERE id = ?`, id)
+}
+
+// FindRecipient récupère un recipient par son adresse, sans tenir compte de la casse
+func FindRecipient(ctx context.Context, email string) (*Recipient, error) {
+	ctx, span := startSpan(ctx, "FindRecipient")
+	defer span.End()
+
+	return getRecipient(ctx, `SELECT id, email, attributes, created_at FROM recipients WHERE email = ? COLLATE NOCASE ORDER BY id LIMIT 1`, email)
+}
 
-	return recipients, nil
+func getRecipient(ctx context.Context, query string, arg interface{}) (*Recipient, error) {
+	var (
+		r       Recipient
+		rawAttr string
+	)
+	if err := DB.QueryRowContext(ctx, query, arg).Scan(&r.ID, &r.Email, &rawAttr, &r.CreatedAt); err != nil {
+		return nil, err
+	}
+	r.Attributes = decodeAttributes(rawAttr)
+	return &r, nil
 }
 
 // GetAllRecipients récupère tous les recipients
-func GetAllRecipients() ([]Recipient, error) {
-	query := `SELECT id, email, created_at FROM recipients ORDER BY created_at DESC`
-	rows, err := DB.Query(query)
+func GetAllRecipients(ctx context.Context) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "GetAllRecipients")
+	defer span.End()
+
+	query := `SELECT id, email, attributes, created_at FROM recipients ORDER BY created_at DESC`
+	rows, err := DB.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -301,78 +742,175 @@ func GetAllRecipients() ([]Recipient, error) {
 
 	var recipients []Recipient
 	for rows.Next() {
-		var r Recipient
-		err := rows.Scan(&r.ID, &r.Email, &r.CreatedAt)
+		var (
+			r       Recipient
+			rawAttr string
+		)
+		err := rows.Scan(&r.ID, &r.Email, &rawAttr, &r.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
+		r.Attributes = decodeAttributes(rawAttr)
 		recipients = append(recipients, r)
 	}
 
-	return recipients, nil
+	return recipients, attachTags(ctx, recipients)
 }
 
-// DeleteOldSends supprime les envois plus vieux que X jours
-func DeleteOldSends(days int) (int64, error) {
-	query := `DELETE FROM email_sends WHERE sent_at < datetime('now', '-' || ? || ' days')`
-	result, err := DB.Exec(query, days)
+// DeleteOldSends supprime les envois plus vieux que X jours. Les clics et
+// événements conservés sont détachés des envois supprimés (send_id à NULL).
+func DeleteOldSends(ctx context.Context, days int) (int64, error) {
+	ctx, span := startSpan(ctx, "DeleteOldSends")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, err
 	}
-	return result.RowsAffected()
+	defer tx.Rollback()
+
+	query := `
+		UPDATE email_clicks SET send_id = NULL
+		WHERE send_id IN (SELECT id FROM email_sends WHERE sent_at < datetime('now', '-' || ? || ' days'))
+	`
+	if _, err := tx.ExecContext(ctx, query, days); err != nil {
+		return 0, err
+	}
+	query = `
+		UPDATE email_events SET send_id = NULL
+		WHERE send_id IN (SELECT id FROM email_sends WHERE sent_at < datetime('now', '-' || ? || ' days'))
+	`
+	if _, err := tx.ExecContext(ctx, query, days); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM email_sends WHERE sent_at < datetime('now', '-' || ? || ' days')`, days)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
 }
 
 // TruncateAllTables vide toutes les tables (garde la structure)
-func TruncateAllTables() error {
+func TruncateAllTables(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "TruncateAllTables")
+	defer span.End()
+
 	queries := []string{
+		"DELETE FROM email_clicks",
+		"DELETE FROM email_events",
 		"DELETE FROM email_sends",
+		"DELETE FROM dry_run_messages",
+		"DELETE FROM domain_checks",
+		"DELETE FROM import_issues",
+		"DELETE FROM import_recipients",
+		"DELETE FROM import_jobs",
+		"DELETE FROM recipient_tags",
+		"DELETE FROM recipient_topics",
+		"DELETE FROM topics",
+		"DELETE FROM list_members",
+		"DELETE FROM lists",
+		"DELETE FROM segments",
+		"DELETE FROM test_sends",
+		"DELETE FROM retention_runs",
+		"DELETE FROM analytics_rollup",
+		"DELETE FROM analytics_state",
+		"DELETE FROM campaigns",
+		"DELETE FROM content_attachments",
+		"DELETE FROM attachments",
 		"DELETE FROM email_contents",
+		"DELETE FROM template_versions",
+		"DELETE FROM email_templates",
 		"DELETE FROM senders",
 		"DELETE FROM recipients",
 		"DELETE FROM sqlite_sequence", // Reset auto-increment
+		// Les suppressions RGPD sont conservées : une adresse effacée ne doit jamais être réimportée
+		// Les règles de conservation (retention_policy) sont de la configuration : conservées aussi
 	}
 
 	for _, query := range queries {
-		if _, err := DB.Exec(query); err != nil {
+		if _, err := DB.ExecContext(ctx, query); err != nil {
 			return fmt.Errorf("erreur truncate: %v", err)
 		}
 	}
 
-	log.Println("✅ Toutes les tables ont été vidées")
+	slog.Info("toutes les tables ont été vidées")
 	return nil
 }
 
 // DropAllTables supprime toutes les tables
-func DropAllTables() error {
+func DropAllTables(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "DropAllTables")
+	defer span.End()
+
 	queries := []string{
+		"DROP TABLE IF EXISTS email_clicks",
+		"DROP TABLE IF EXISTS email_events",
 		"DROP TABLE IF EXISTS email_sends",
+		"DROP TABLE IF EXISTS dry_run_messages",
+		"DROP TABLE IF EXISTS domain_checks",
+		"DROP TABLE IF EXISTS import_issues",
+		"DROP TABLE IF EXISTS import_recipients",
+		"DROP TABLE IF EXISTS import_jobs",
+		"DROP TABLE IF EXISTS recipient_tags",
+		"DROP TABLE IF EXISTS suppressions",
+		"DROP TABLE IF EXISTS recipient_topics",
+		"DROP TABLE IF EXISTS topics",
+		"DROP TABLE IF EXISTS list_members",
+		"DROP TABLE IF EXISTS lists",
+		"DROP TABLE IF EXISTS segments",
+		"DROP TABLE IF EXISTS test_sends",
+		"DROP TABLE IF EXISTS retention_runs",
+		"DROP TABLE IF EXISTS analytics_rollup",
+		"DROP TABLE IF EXISTS analytics_state",
+		"DROP TABLE IF EXISTS retention_policy",
+		"DROP TABLE IF EXISTS campaigns",
+		"DROP TABLE IF EXISTS content_attachments",
+		"DROP TABLE IF EXISTS attachments",
 		"DROP TABLE IF EXISTS email_contents",
+		"DROP TABLE IF EXISTS template_versions",
+		"DROP TABLE IF EXISTS email_templates",
 		"DROP TABLE IF EXISTS senders",
 		"DROP TABLE IF EXISTS recipients",
 	}
 
 	for _, query := range queries {
-		if _, err := DB.Exec(query); err != nil {
+		if _, err := DB.ExecContext(ctx, query); err != nil {
 			return fmt.Errorf("erreur drop: %v", err)
 		}
 	}
 
-	log.Println("Toutes les tables ont été supprimées")
+	slog.Info("toutes les tables ont été supprimées")
 	return nil
 }
 
 // ResetDatabase supprime et recrée toutes les tables
-func ResetDatabase() error {
-	if err := DropAllTables(); err != nil {
+func ResetDatabase(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "ResetDatabase")
+	defer span.End()
+
+	if err := DropAllTables(ctx); err != nil {
 		return err
 	}
 	if err := createTables(); err != nil {
 		return err
 	}
-	log.Println("Base de données réinitialisée")
+	slog.Info("base de données réinitialisée")
 	return nil
 }
 
+// Ping vérifie que la base répond
+func Ping(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "Ping")
+	defer span.End()
+
+	return DB.PingContext(ctx)
+}
+
 // Close ferme la connexion à la base de données
 func Close() error {
 	if DB != nil {
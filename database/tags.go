@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// maxTagLength limite la longueur d'un tag
+const maxTagLength = 64
+
+// TagFilter restreint une recherche de destinataires selon leurs tags
+type TagFilter struct {
+	Tags        []string `json:"tags,omitempty"`         // tous ces tags
+	AnyTags     []string `json:"any_tags,omitempty"`     // au moins un de ces tags
+	ExcludeTags []string `json:"exclude_tags,omitempty"` // aucun de ces tags
+}
+
+// RecipientFilter sélectionne des destinataires pour la recherche et les opérations groupées
+type RecipientFilter struct {
+	TagFilter
+	Email        string  `json:"email,omitempty"` // partie de l'adresse
+	ListID       int64   `json:"list_id,omitempty"`
+	SegmentID    int64   `json:"segment_id,omitempty"`
+	RecipientIDs []int64 `json:"recipient_ids,omitempty"`
+}
+
+// IsEmpty indique si le filtre sélectionne tous les destinataires
+func (f RecipientFilter) IsEmpty() bool {
+	return f.Email == "" && f.ListID == 0 && f.SegmentID == 0 && len(f.RecipientIDs) == 0 &&
+		len(f.Tags) == 0 && len(f.AnyTags) == 0 && len(f.ExcludeTags) == 0
+}
+
+// NormalizeTags met les tags en minuscules, retire les vides et les doublons
+func NormalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag trop long: %s", tag)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized, nil
+}
+
+// SearchRecipients retourne les destinataires correspondant au filtre, avec leurs tags
+func SearchRecipients(ctx context.Context, filter RecipientFilter) ([]Recipient, error) {
+	ctx, span := startSpan(ctx, "SearchRecipients")
+	defer span.End()
+
+	where, args, err := filter.where(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := queryRecipients(ctx, `SELECT r.id, r.email, r.attributes, r.created_at FROM recipients r WHERE `+where+` ORDER BY r.created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return recipients, attachTags(ctx, recipients)
+}
+
+// TagRecipients ajoute (add = true) ou retire des tags aux destinataires du filtre
+// et retourne le nombre d'associations modifiées
+func TagRecipients(ctx context.Context, filter RecipientFilter, tags []string, add bool) (int64, error) {
+	ctx, span := startSpan(ctx, "TagRecipients")
+	defer span.End()
+
+	where, args, err := filter.where(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var changed int64
+	for _, tag := range tags {
+		query := `INSERT OR IGNORE INTO recipient_tags (recipient_id, tag) SELECT r.id, ? FROM recipients r WHERE ` + where
+		if !add {
+			query = `DELETE FROM recipient_tags WHERE tag = ? AND recipient_id IN (SELECT r.id FROM recipients r WHERE ` + where + `)`
+		}
+		result, err := tx.ExecContext(ctx, query, append([]interface{}{tag}, args...)...)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		changed += n
+	}
+
+	return changed, tx.Commit()
+}
+
+// AddRecipientTags ajoute des tags à un destinataire
+func AddRecipientTags(ctx context.Context, recipientID int64, tags []string) error {
+	ctx, span := startSpan(ctx, "AddRecipientTags")
+	defer span.End()
+
+	return addRecipientTags(ctx, DB, recipientID, tags)
+}
+
+func addRecipientTags(ctx context.Context, q execQuerier, recipientID int64, tags []string) error {
+	for _, tag := range tags {
+		if _, err := q.ExecContext(ctx, `INSERT OR IGNORE INTO recipient_tags (recipient_id, tag) VALUES (?, ?)`, recipientID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllTags retourne chaque tag avec son nombre de destinataires
+func GetAllTags(ctx context.Context) (map[string]int, error) {
+	ctx, span := startSpan(ctx, "GetAllTags")
+	defer span.End()
+
+	rows, err := DB.QueryContext(ctx, `SELECT tag, COUNT(*) FROM recipient_tags GROUP BY tag ORDER BY tag`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[string]int{}
+	for rows.Next() {
+		var (
+			tag   string
+			count int
+		)
+		if err := rows.Scan(&tag, &count); err != nil {
+			return nil, err
+		}
+		tags[tag] = count
+	}
+
+	return tags, rows.Err()
+}
+
+// attachTags renseigne les tags des destinataires, par paquets de 500 IDs
+func attachTags(ctx context.Context, recipients []Recipient) error {
+	index := make(map[int]int, len(recipients))
+	for i := range recipients {
+		index[recipients[i].ID] = i
+		recipients[i].Tags = []string{}
+	}
+
+	for start := 0; start < len(recipients); start += 500 {
+		end := min(start+500, len(recipients))
+		args := make([]interface{}, 0, end-start)
+		for _, r := range recipients[start:end] {
+			args = append(args, r.ID)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+		rows, err := DB.QueryContext(ctx, `SELECT recipient_id, tag FROM recipient_tags WHERE recipient_id IN (`+placeholders+`) ORDER BY tag`, args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var (
+				id  int
+				tag string
+			)
+			if err := rows.Scan(&id, &tag); err != nil {
+				rows.Close()
+				return err
+			}
+			if i, ok := index[id]; ok {
+				recipients[i].Tags = append(recipients[i].Tags, tag)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// where traduit le filtre en clause WHERE sur recipients r
+func (f RecipientFilter) where(ctx context.Context) (string, []interface{}, error) {
+	clauses := []string{"1 = 1"}
+	var args []interface{}
+
+	if f.Email != "" {
+		clauses = append(clauses, `r.email LIKE ?`)
+		args = append(args, "%"+f.Email+"%")
+	}
+	if f.ListID != 0 {
+		clauses = append(clauses, `r.id IN (SELECT recipient_id FROM list_members WHERE list_id = ?)`)
+		args = append(args, f.ListID)
+	}
+	if f.SegmentID != 0 {
+		segment, err := GetSegment(ctx, f.SegmentID)
+		if err != nil {
+			return "", nil, fmt.Errorf("segment %d introuvable", f.SegmentID)
+		}
+		where, segmentArgs, err := segmentWhere(segment.Match, segment.Rules)
+		if err != nil {
+			return "", nil, err
+		}
+		clauses = append(clauses, "("+where+")")
+		args = append(args, segmentArgs...)
+	}
+	if len(f.RecipientIDs) > 0 {
+		clauses = append(clauses, `r.id IN (`+strings.TrimSuffix(strings.Repeat("?,", len(f.RecipientIDs)), ",")+`)`)
+		for _, id := range f.RecipientIDs {
+			args = append(args, id)
+		}
+	}
+
+	tagClause := `EXISTS (SELECT 1 FROM recipient_tags t WHERE t.recipient_id = r.id AND t.tag IN (%s))`
+	inTags := func(tags []string) string {
+		for _, tag := range tags {
+			args = append(args, strings.ToLower(strings.TrimSpace(tag)))
+		}
+		return fmt.Sprintf(tagClause, strings.TrimSuffix(strings.Repeat("?,", len(tags)), ","))
+	}
+	for _, tag := range f.Tags {
+		clauses = append(clauses, inTags([]string{tag}))
+	}
+	if len(f.AnyTags) > 0 {
+		clauses = append(clauses, inTags(f.AnyTags))
+	}
+	if len(f.ExcludeTags) > 0 {
+		clauses = append(clauses, "NOT "+inTags(f.ExcludeTags))
+	}
+
+	return strings.Join(clauses, " AND "), args, nil
+}
@@ -0,0 +1,225 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// EmailTemplate représente un template de la bibliothèque
+type EmailTemplate struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	CreatedBy     string    `json:"created_by"`
+	LatestVersion int       `json:"latest_version"`
+	PreviewText   string    `json:"preview_text"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TemplateVersion représente une version figée d'un template
+type TemplateVersion struct {
+	ID          int64     `json:"id"`
+	TemplateID  int64     `json:"template_id"`
+	Version     int       `json:"version"`
+	Subject     string    `json:"subject"`
+	Body        string    `json:"body"`
+	PreviewText string    `json:"preview_text"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateTemplate crée un template et sa version 1
+func CreateTemplate(ctx context.Context, name, subject, body, previewText, createdBy string) (*TemplateVersion, error) {
+	ctx, span := startSpan(ctx, "CreateTemplate")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO email_templates (name, created_by) VALUES (?, ?)`, name, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	templateID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := insertTemplateVersion(ctx, tx, templateID, subject, body, previewText, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return version, tx.Commit()
+}
+
+// AddTemplateVersion enregistre une nouvelle version d'un template existant
+func AddTemplateVersion(ctx context.Context, templateID int64, subject, body, previewText, createdBy string) (*TemplateVersion, error) {
+	ctx, span := startSpan(ctx, "AddTemplateVersion")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	version, err := insertTemplateVersion(ctx, tx, templateID, subject, body, previewText, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE email_templates SET updated_at = CURRENT_TIMESTAMP WHERE id = ?`, templateID); err != nil {
+		return nil, err
+	}
+
+	return version, tx.Commit()
+}
+
+func insertTemplateVersion(ctx context.Context, tx *sql.Tx, templateID int64, subject, body, previewText, createdBy string) (*TemplateVersion, error) {
+	var next int
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) + 1 FROM template_versions WHERE template_id = ?`, templateID).Scan(&next)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO template_versions (template_id, version, subject, body, preview_text, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.ExecContext(ctx, query, templateID, next, subject, body, previewText, createdBy)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateVersion{
+		ID:          id,
+		TemplateID:  templateID,
+		Version:     next,
+		Subject:     subject,
+		Body:        body,
+		PreviewText: previewText,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// GetAllTemplates liste les templates avec leur dernière version
+func GetAllTemplates(ctx context.Context) ([]EmailTemplate, error) {
+	ctx, span := startSpan(ctx, "GetAllTemplates")
+	defer span.End()
+
+	query := `
+		SELECT t.id, t.name, COALESCE(t.created_by, ''), v.version, COALESCE(v.preview_text, ''), t.created_at, t.updated_at
+		FROM email_templates t
+		JOIN template_versions v ON v.template_id = t.id
+		WHERE v.version = (SELECT MAX(version) FROM template_versions WHERE template_id = t.id)
+		ORDER BY t.updated_at DESC
+	`
+
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var templates []EmailTemplate
+	for rows.Next() {
+		var t EmailTemplate
+		err := rows.Scan(&t.ID, &t.Name, &t.CreatedBy, &t.LatestVersion, &t.PreviewText, &t.CreatedAt, &t.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+// GetTemplateName retourne le nom d'un template
+func GetTemplateName(ctx context.Context, templateID int64) (string, error) {
+	ctx, span := startSpan(ctx, "GetTemplateName")
+	defer span.End()
+
+	var name string
+	err := DB.QueryRowContext(ctx, `SELECT name FROM email_templates WHERE id = ?`, templateID).Scan(&name)
+	return name, err
+}
+
+// GetTemplateVersions liste toutes les versions d'un template, la plus récente en premier
+func GetTemplateVersions(ctx context.Context, templateID int64) ([]TemplateVersion, error) {
+	ctx, span := startSpan(ctx, "GetTemplateVersions")
+	defer span.End()
+
+	query := `
+		SELECT id, template_id, version, subject, body, COALESCE(preview_text, ''), COALESCE(created_by, ''), created_at
+		FROM template_versions
+		WHERE template_id = ?
+		ORDER BY version DESC
+	`
+
+	rows, err := DB.QueryContext(ctx, query, templateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []TemplateVersion
+	for rows.Next() {
+		var v TemplateVersion
+		err := rows.Scan(&v.ID, &v.TemplateID, &v.Version, &v.Subject, &v.Body, &v.PreviewText, &v.CreatedBy, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// GetTemplateVersion récupère une version précise d'un template
+func GetTemplateVersion(ctx context.Context, templateID int64, version int) (*TemplateVersion, error) {
+	ctx, span := startSpan(ctx, "GetTemplateVersion")
+	defer span.End()
+
+	query := `
+		SELECT id, template_id, version, subject, body, COALESCE(preview_text, ''), COALESCE(created_by, ''), created_at
+		FROM template_versions
+		WHERE template_id = ? AND version = ?
+	`
+
+	var v TemplateVersion
+	err := DB.QueryRowContext(ctx, query, templateID, version).Scan(&v.ID, &v.TemplateID, &v.Version, &v.Subject, &v.Body, &v.PreviewText, &v.CreatedBy, &v.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// GetTemplateVersionByID récupère une version par son identifiant global
+func GetTemplateVersionByID(ctx context.Context, id int64) (*TemplateVersion, error) {
+	ctx, span := startSpan(ctx, "GetTemplateVersionByID")
+	defer span.End()
+
+	query := `
+		SELECT id, template_id, version, subject, body, COALESCE(preview_text, ''), COALESCE(created_by, ''), created_at
+		FROM template_versions
+		WHERE id = ?
+	`
+
+	var v TemplateVersion
+	err := DB.QueryRowContext(ctx, query, id).Scan(&v.ID, &v.TemplateID, &v.Version, &v.Subject, &v.Body, &v.PreviewText, &v.CreatedBy, &v.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
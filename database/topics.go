@@ -0,0 +1,267 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Topic est un thème de communication auquel un destinataire peut s'abonner ou non
+type Topic struct {
+	ID          int64     `json:"id"`
+	Key         string    `json:"key"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TopicPreference est le choix d'un destinataire pour un thème. Sans choix
+// enregistré, le destinataire reçoit tous les envois du thème.
+type TopicPreference struct {
+	Topic
+	Subscribed bool   `json:"subscribed"`
+	Frequency  string `json:"frequency"` // "all", "weekly", "monthly"
+}
+
+// Preferences regroupe les choix d'un destinataire
+type Preferences struct {
+	RecipientID    int64             `json:"recipient_id"`
+	Email          string            `json:"email"`
+	UnsubscribedAt *time.Time        `json:"unsubscribed_at,omitempty"` // désinscription de tous les envois
+	Topics         []TopicPreference `json:"topics"`
+}
+
+// frequencyPeriods donne l'écart minimal entre deux envois d'un même thème
+var frequencyPeriods = map[string]string{
+	"all":     "",
+	"weekly":  "-7 days",
+	"monthly": "-1 month",
+}
+
+// ValidFrequency indique si la fréquence est connue
+func ValidFrequency(frequency string) bool {
+	_, ok := frequencyPeriods[frequency]
+	return ok
+}
+
+// CreateTopic enregistre un thème et retourne son ID
+func CreateTopic(ctx context.Context, t *Topic) (int64, error) {
+	ctx, span := startSpan(ctx, "CreateTopic")
+	defer span.End()
+
+	result, err := DB.ExecContext(ctx, `INSERT INTO topics (key, name, description) VALUES (?, ?, ?)`, t.Key, t.Name, t.Description)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// UpdateTopic modifie le nom et la description d'un thème
+func UpdateTopic(ctx context.Context, t *Topic) error {
+	ctx, span := startSpan(ctx, "UpdateTopic")
+	defer span.End()
+
+	_, err := DB.ExecContext(ctx, `UPDATE topics SET name = ?, description = ? WHERE id = ?`, t.Name, t.Description, t.ID)
+	return err
+}
+
+// DeleteTopic supprime un thème et les choix associés
+func DeleteTopic(ctx context.Context, id int64) error {
+	ctx, span := startSpan(ctx, "DeleteTopic")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recipient_topics WHERE topic_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE campaigns SET topic_id = NULL WHERE topic_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM topics WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetTopic récupère un thème par son ID
+func GetTopic(ctx context.Context, id int64) (*Topic, error) {
+	ctx, span := startSpan(ctx, "GetTopic")
+	defer span.End()
+
+	var t Topic
+	err := DB.QueryRowContext(ctx, `SELECT id, key, name, COALESCE(description, ''), created_at FROM topics WHERE id = ?`, id).
+		Scan(&t.ID, &t.Key, &t.Name, &t.Description, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetAllTopics liste les thèmes par nom
+func GetAllTopics(ctx context.Context) ([]Topic, error) {
+	ctx, span := startSpan(ctx, "GetAllTopics")
+	defer span.End()
+
+	rows, err := DB.QueryContext(ctx, `SELECT id, key, name, COALESCE(description, ''), created_at FROM topics ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []Topic
+	for rows.Next() {
+		var t Topic
+		if err := rows.Scan(&t.ID, &t.Key, &t.Name, &t.Description, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+
+	return topics, rows.Err()
+}
+
+// GetPreferences récupère les choix d'un destinataire pour tous les thèmes
+func GetPreferences(ctx context.Context, recipientID int64) (*Preferences, error) {
+	ctx, span := startSpan(ctx, "GetPreferences")
+	defer span.End()
+
+	p := Preferences{RecipientID: recipientID, Topics: []TopicPreference{}}
+	err := DB.QueryRowContext(ctx, `SELECT email, unsubscribed_at FROM recipients WHERE id = ?`, recipientID).Scan(&p.Email, &p.UnsubscribedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT t.id, t.key, t.name, COALESCE(t.description, ''), t.created_at,
+			COALESCE(rt.subscribed, 1), COALESCE(rt.frequency, 'all')
+		FROM topics t
+		LEFT JOIN recipient_topics rt ON rt.topic_id = t.id AND rt.recipient_id = ?
+		ORDER BY t.name
+	`
+	rows, err := DB.QueryContext(ctx, query, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tp TopicPreference
+		if err := rows.Scan(&tp.ID, &tp.Key, &tp.Name, &tp.Description, &tp.CreatedAt, &tp.Subscribed, &tp.Frequency); err != nil {
+			return nil, err
+		}
+		p.Topics = append(p.Topics, tp)
+	}
+
+	return &p, rows.Err()
+}
+
+// SavePreferences enregistre les choix d'un destinataire. unsubscribeAll
+// désinscrit de tous les envois ; false annule une désinscription précédente.
+func SavePreferences(ctx context.Context, recipientID int64, unsubscribeAll bool, topics []TopicPreference) error {
+	ctx, span := startSpan(ctx, "SavePreferences")
+	defer span.End()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var unsubscribed bool
+	if err := tx.QueryRowContext(ctx, `SELECT unsubscribed_at IS NOT NULL FROM recipients WHERE id = ?`, recipientID).Scan(&unsubscribed); err != nil {
+		return err
+	}
+
+	query := `UPDATE recipients SET unsubscribed_at = NULL WHERE id = ?`
+	if unsubscribeAll {
+		query = `UPDATE recipients SET unsubscribed_at = COALESCE(unsubscribed_at, CURRENT_TIMESTAMP) WHERE id = ?`
+	}
+	if _, err := tx.ExecContext(ctx, query, recipientID); err != nil {
+		return err
+	}
+	if unsubscribeAll && !unsubscribed {
+		if err := insertRecipientEvent(ctx, tx, recipientID, EventUnsubscribed); err != nil {
+			return err
+		}
+	}
+
+	for _, tp := range topics {
+		if !ValidFrequency(tp.Frequency) {
+			return fmt.Errorf("fréquence invalide: %s", tp.Frequency)
+		}
+		query := `
+			INSERT INTO recipient_topics (recipient_id, topic_id, subscribed, frequency, updated_at)
+			SELECT ?, id, ?, ?, CURRENT_TIMESTAMP FROM topics WHERE id = ?
+			ON CONFLICT(recipient_id, topic_id) DO UPDATE SET
+				subscribed = excluded.subscribed, frequency = excluded.frequency, updated_at = excluded.updated_at
+		`
+		if _, err := tx.ExecContext(ctx, query, recipientID, tp.Subscribed, tp.Frequency, tp.ID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CheckSendAllowed indique si un destinataire accepte un envoi du thème donné
+// (0 = sans thème) et, sinon, pourquoi : inscription non confirmée, désinscription
+// totale, désabonnement du thème ou fréquence choisie déjà atteinte
+func CheckSendAllowed(ctx context.Context, recipientID, topicID int64) (bool, string, error) {
+	ctx, span := startSpan(ctx, "CheckSendAllowed")
+	defer span.End()
+
+	var (
+		pending      bool
+		unsubscribed bool
+		subscribed   bool
+		frequency    string
+	)
+	query := `
+		SELECT ` + pendingConsent + `, r.unsubscribed_at IS NOT NULL, COALESCE(rt.subscribed, 1), COALESCE(rt.frequency, 'all')
+		FROM recipients r
+		LEFT JOIN recipient_topics rt ON rt.recipient_id = r.id AND rt.topic_id = ?
+		WHERE r.id = ?
+	`
+	if err := DB.QueryRowContext(ctx, query, topicID, recipientID).Scan(&pending, &unsubscribed, &subscribed, &frequency); err != nil {
+		return false, "", err
+	}
+
+	if pending {
+		return false, "inscription non confirmée", nil
+	}
+	if unsubscribed {
+		return false, "désinscrit de tous les envois", nil
+	}
+	if topicID == 0 {
+		return true, "", nil
+	}
+	if !subscribed {
+		return false, "désabonné de ce thème", nil
+	}
+
+	period := frequencyPeriods[frequency]
+	if period == "" {
+		return true, "", nil
+	}
+
+	var recent int
+	query = `
+		SELECT COUNT(*)
+		FROM email_sends es
+		JOIN email_contents ec ON ec.id = es.content_id
+		JOIN campaigns c ON c.id = ec.campaign_id
+		WHERE es.recipient_id = ? AND es.status = 'sent' AND c.topic_id = ? AND es.sent_at >= datetime('now', ?)
+	`
+	if err := DB.QueryRowContext(ctx, query, recipientID, topicID, period).Scan(&recent); err != nil {
+		return false, "", err
+	}
+	if recent > 0 {
+		return false, "fréquence choisie atteinte (" + frequency + ")", nil
+	}
+	return true, "", nil
+}
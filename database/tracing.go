@@ -0,0 +1,16 @@
+package database
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("bulk-email-mailgun/database")
+
+// startSpan ouvre le span d'une fonction du package, nommé database.<fonction>
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "database."+name, trace.WithAttributes(attribute.String("db.system", "sqlite")))
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// analyticsMaxAge est l'ancienneté maximale des agrégats servis au tableau de bord
+const analyticsMaxAge = time.Minute
+
+// AnalyticsHandler retourne une série temporelle d'indicateurs : ?period=hour|day|week,
+// group_by=provider|domain|campaign, filtres campaign_id=, provider=, domain=, from=, to=
+func (h *Handler) AnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	query := r.URL.Query()
+	q := database.AnalyticsQuery{
+		Period:   query.Get("period"),
+		GroupBy:  query.Get("group_by"),
+		Provider: query.Get("provider"),
+		Domain:   query.Get("domain"),
+	}
+	if q.Period == "" {
+		q.Period = "day"
+	}
+	q.CampaignID, _ = strconv.ParseInt(query.Get("campaign_id"), 10, 64)
+
+	var err error
+	if q.From, err = parseHistoryDate(query.Get("from"), false); err == nil {
+		q.To, err = parseHistoryDate(query.Get("to"), true)
+	}
+	if err == nil {
+		err = database.ValidAnalyticsQuery(q)
+	}
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// La conservation borne les heures recalculées (événements éventuellement purgés)
+	policy, err := h.retentionService.Policy(r.Context())
+	if err == nil {
+		err = database.RefreshAnalytics(r.Context(), analyticsMaxAge, policy)
+	}
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	series, totals, err := database.GetAnalytics(r.Context(), q)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"period":  q.Period,
+		"series":  series,
+		"totals":  totals,
+	})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// AttachmentsHandler liste (GET) ou téléverse (POST multipart) les pièces jointes.
+// Champs du formulaire : file, inline=true pour une image intégrée, cid optionnel.
+func (h *Handler) AttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		r.Body = http.MaxBytesReader(w, r.Body, services.MaxAttachmentSize+1<<20)
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Upload error",
+			})
+			return
+		}
+		defer file.Close()
+
+		inline := r.FormValue("inline") == "true"
+		attachment, err := h.attachmentService.Save(r.Context(), header.Filename, file, inline, r.FormValue("cid"))
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":    true,
+			"attachment": attachment,
+		})
+		return
+	}
+
+	attachments, err := database.GetAllAttachments(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"attachments": attachments,
+	})
+}
+
+// AttachmentHandler supprime une pièce jointe (DELETE)
+func (h *Handler) AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "DELETE" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	if err := h.attachmentService.Delete(r.Context(), id); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: "Pièce jointe supprimée",
+	})
+}
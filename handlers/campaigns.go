@@ -0,0 +1,498 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/middleware"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxTestRecipients limite la taille de la liste de test
+const maxTestRecipients = 10
+
+var errInvalidRecipient = errors.New("destinataire introuvable")
+
+// CampaignsHandler liste (GET) ou crée en brouillon (POST) les campagnes
+func (h *Handler) CampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		var campaign database.Campaign
+		if err := json.NewDecoder(r.Body).Decode(&campaign); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		if err := validateCampaign(r.Context(), &campaign); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		campaign.Status = "draft"
+		campaign.CreatedBy = middleware.CurrentUser(r)
+
+		id, err := database.CreateCampaign(r.Context(), &campaign)
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"id":      id,
+		})
+		return
+	}
+
+	campaigns, err := database.GetAllCampaigns(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"campaigns": campaigns,
+	})
+}
+
+// CampaignHandler retourne une campagne et ses envois de test (GET)
+// ou modifie un brouillon (PUT)
+func (h *Handler) CampaignHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	campaign, ok := loadCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == "PUT" {
+		if campaign.Status != "draft" {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Seuls les brouillons peuvent être modifiés",
+			})
+			return
+		}
+
+		var update database.Campaign
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+		if err := validateCampaign(r.Context(), &update); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		update.ID = campaign.ID
+		if err := database.UpdateCampaign(r.Context(), &update); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: "Campagne mise à jour",
+		})
+		return
+	}
+
+	tests, err := database.GetTestSends(r.Context(), campaign.ID)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"campaign":   campaign,
+		"test_sends": tests,
+	})
+}
+
+// CampaignPreviewHandler rend l'objet et le corps pour un destinataire choisi :
+// ?recipient_id=, ?email= ou un JSON {"email": ..., "fields": {...}} en POST
+func (h *Handler) CampaignPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	campaign, ok := loadCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	recipient, err := previewRecipient(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	req := campaignSendRequest(campaign, nil)
+	if err := resolveTemplateVersion(r.Context(), &req); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	tmpl, err := services.ParseEmailTemplate(req.Subject, req.Body, req.TextBody)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Template invalide: " + err.Error(),
+		})
+		return
+	}
+
+	rendered, err := tmpl.Render(recipient)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Erreur de rendu: " + err.Error(),
+		})
+		return
+	}
+
+	text := rendered.Text
+	if text == "" {
+		text = services.HTMLToText(rendered.HTML)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"recipient": recipient,
+		"subject":   rendered.Subject,
+		"html":      rendered.HTML,
+		"text":      text,
+	})
+}
+
+// CampaignTestHandler envoie la campagne à une liste de test ({"emails": [...]})
+func (h *Handler) CampaignTestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	campaign, ok := loadCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Emails []string `json:"emails"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.Emails) == 0 {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Liste de test requise",
+		})
+		return
+	}
+	if len(body.Emails) > maxTestRecipients {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Liste de test limitée à " + strconv.Itoa(maxTestRecipients) + " adresses",
+		})
+		return
+	}
+
+	// Utiliser les attributs connus des adresses de test pour la personnalisation
+	seeds := make([]models.EmailData, 0, len(body.Emails))
+	for _, email := range body.Emails {
+		email = strings.TrimSpace(email)
+		seed := models.EmailData{Email: email}
+		if recipient, err := database.FindRecipient(r.Context(), email); err == nil {
+			seed.Fields = recipient.Attributes
+		}
+		seeds = append(seeds, seed)
+	}
+
+	req := campaignSendRequest(campaign, seeds)
+	if err := h.prepareSend(r.Context(), &req); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	results, err := h.emailService.SendTest(r.Context(), req, seeds)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"results": results,
+	})
+}
+
+// CampaignSendHandler lance une campagne brouillon vers les destinataires fournis,
+// ou à défaut vers les listes et segments de la campagne. Une campagne
+// interrompue par un arrêt du serveur est relancée sans renvoyer aux
+// destinataires déjà servis.
+func (h *Handler) CampaignSendHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	campaign, ok := loadCampaign(w, r)
+	if !ok {
+		return
+	}
+	if campaign.Status != "draft" && campaign.Status != "interrupted" {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Campagne déjà lancée",
+		})
+		return
+	}
+
+	var body struct {
+		Emails         []models.EmailData `json:"emails"`
+		ImportID       int64              `json:"import_id"`
+		ListIDs        []int64            `json:"list_ids"`
+		SegmentIDs     []int64            `json:"segment_ids"`
+		DryRun         bool               `json:"dry_run"`
+		ExcludeInvalid bool               `json:"exclude_invalid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Invalid data",
+		})
+		return
+	}
+
+	req := campaignSendRequest(campaign, body.Emails)
+	req.ImportID = body.ImportID
+	if len(body.ListIDs) > 0 || len(body.SegmentIDs) > 0 {
+		req.ListIDs, req.SegmentIDs = body.ListIDs, body.SegmentIDs
+	}
+	req.DryRun = body.DryRun
+	req.ExcludeInvalid = body.ExcludeInvalid
+	req.Resume = campaign.Status == "interrupted"
+	if err := h.prepareSend(r.Context(), &req); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	h.launch(w, r, req)
+}
+
+// CampaignDryRunHandler retourne le rapport de la dernière simulation d'une campagne :
+// messages rendus et destinataires écartés, en JSON ou en CSV (?format=csv)
+func (h *Handler) CampaignDryRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	campaign, ok := loadCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := database.GetLastDryRun(r.Context(), campaign.ID)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	rendered, skipped := 0, 0
+	for _, m := range messages {
+		if m.Status == "rendered" {
+			rendered++
+		} else {
+			skipped++
+		}
+	}
+
+	if r.URL.Query().Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"dry-run-campaign-%d.csv\"", campaign.ID))
+
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"email", "status", "reason", "sender_email", "subject", "html", "text"})
+		for _, m := range messages {
+			cw.Write([]string{m.Email, m.Status, m.Reason, m.SenderEmail, m.Subject, m.HTML, m.Text})
+		}
+		cw.Flush()
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"campaign": campaign.ID,
+		"rendered": rendered,
+		"skipped":  skipped,
+		"messages": messages,
+	})
+}
+
+// loadCampaign lit la campagne désignée par {id} et écrit l'erreur si besoin
+func loadCampaign(w http.ResponseWriter, r *http.Request) (*database.Campaign, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return nil, false
+	}
+
+	campaign, err := database.GetCampaign(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Campagne introuvable",
+		})
+		return nil, false
+	}
+
+	return campaign, true
+}
+
+// validateCampaign complète les valeurs par défaut et vérifie la syntaxe du template
+func validateCampaign(ctx context.Context, c *database.Campaign) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		c.Name = c.Subject
+	}
+	if c.Provider == "" {
+		c.Provider = config.AppConfig.Provider
+	}
+	tags, err := database.NormalizeTags(c.ClickTags)
+	if err != nil {
+		return err
+	}
+	c.ClickTags = tags
+
+	if c.TopicID != 0 {
+		if _, err := database.GetTopic(ctx, c.TopicID); err != nil {
+			return fmt.Errorf("Thème introuvable")
+		}
+	}
+
+	req := campaignSendRequest(c, nil)
+	if err := resolveTemplateVersion(ctx, &req); err != nil {
+		return err
+	}
+	if _, err := services.ParseEmailTemplate(req.Subject, req.Body, req.TextBody); err != nil {
+		return err
+	}
+	return nil
+}
+
+// campaignSendRequest construit la demande d'envoi correspondant à une campagne
+func campaignSendRequest(c *database.Campaign, emails []models.EmailData) models.SendRequest {
+	return models.SendRequest{
+		CampaignID:        c.ID,
+		Emails:            emails,
+		Subject:           c.Subject,
+		Body:              c.Body,
+		TextBody:          c.TextBody,
+		Provider:          c.Provider,
+		SenderName:        c.SenderName,
+		TrackClicks:       c.TrackClicks,
+		TrackOpens:        c.TrackOpens,
+		TemplateVersionID: c.TemplateVersionID,
+		AttachmentIDs:     c.AttachmentIDs,
+		ListIDs:           c.ListIDs,
+		SegmentIDs:        c.SegmentIDs,
+		ClickTags:         c.ClickTags,
+		TopicID:           c.TopicID,
+	}
+}
+
+// previewRecipient détermine le destinataire utilisé pour l'aperçu
+func previewRecipient(r *http.Request) (models.EmailData, error) {
+	query := r.URL.Query()
+
+	if id := query.Get("recipient_id"); id != "" {
+		recipientID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return models.EmailData{}, errInvalidRecipient
+		}
+		recipient, err := database.GetRecipient(r.Context(), recipientID)
+		if err != nil {
+			return models.EmailData{}, errInvalidRecipient
+		}
+		return models.EmailData{Email: recipient.Email, Fields: recipient.Attributes}, nil
+	}
+
+	if email := query.Get("email"); email != "" {
+		data := models.EmailData{Email: email}
+		if recipient, err := database.FindRecipient(r.Context(), email); err == nil {
+			data.Fields = recipient.Attributes
+		}
+		return data, nil
+	}
+
+	if r.Method == "POST" {
+		var data models.EmailData
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil || data.Email == "" {
+			return models.EmailData{}, errInvalidRecipient
+		}
+		return data, nil
+	}
+
+	return models.EmailData{Email: "exemple@example.com"}, nil
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sendReportHeader est l'en-tête des lignes d'export d'envois
+var sendReportHeader = []interface{}{
+	"send_id", "sent_at", "campaign_id", "campaign", "sender", "recipient", "subject", "provider",
+	"status", "error", "opens", "first_opened_at", "clicks", "first_clicked_at", "clicked_urls",
+}
+
+// HistoryExportHandler exporte l'historique en CSV ou XLSX (?format=csv|xlsx)
+// avec les mêmes filtres que /api/history
+func (h *Handler) HistoryExportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := historyFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	filename := "historique-" + time.Now().Format("2006-01-02")
+	h.streamSendReport(w, r, filter, filename, nil)
+}
+
+// CampaignReportHandler exporte le rapport d'une campagne en CSV ou XLSX ;
+// le XLSX contient en plus une feuille de synthèse
+func (h *Handler) CampaignReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	campaign, err := database.GetCampaign(r.Context(), id)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Campagne introuvable",
+		})
+		return
+	}
+
+	filter, err := historyFilter(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	filter.CampaignID = campaign.ID
+
+	summary := func(out services.SheetWriter, totals database.SendReportSummary) error {
+		if err := out.NewSheet("Synthèse"); err != nil {
+			return err
+		}
+		rows := [][]interface{}{
+			{"campagne", campaign.Name},
+			{"envois", totals.Total},
+			{"envoyés", totals.Sent},
+			{"échecs", totals.Failed},
+			{"ouverts", totals.Opened},
+			{"taux d'ouverture", rate(totals.Opened, totals.Sent)},
+			{"cliqués", totals.Clicked},
+			{"taux de clic", rate(totals.Clicked, totals.Sent)},
+			{"ouvertures", totals.Opens},
+			{"clics", totals.Clicks},
+		}
+		for _, row := range rows {
+			if err := out.Write(row...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	h.streamSendReport(w, r, filter, fmt.Sprintf("campagne-%d-rapport", campaign.ID), summary)
+}
+
+// streamSendReport écrit les envois filtrés au fil de la lecture en base.
+// Une fois l'en-tête HTTP envoyé, une erreur ne peut plus être retournée en
+// JSON : elle est journalisée et le fichier est tronqué.
+func (h *Handler) streamSendReport(w http.ResponseWriter, r *http.Request, filter database.HistoryFilter, filename string,
+	summary func(services.SheetWriter, database.SendReportSummary) error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.FormatCSV
+	}
+	if format != services.FormatCSV && format != services.FormatXLSX {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "format invalide (csv ou xlsx)",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", services.ExportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.%s\"", filename, format))
+
+	out, err := services.NewExportWriter(format, w, "Envois")
+	if err != nil {
+		logging.FromContext(r.Context()).Error("export interrompu", "file", filename, "error", err)
+		return
+	}
+
+	var totals database.SendReportSummary
+	err = out.Write(sendReportHeader...)
+	if err == nil {
+		err = database.StreamSendReport(r.Context(), filter, func(row database.SendReportRow) error {
+			totals.Add(row)
+			return out.Write(row.SendID, row.SentAt, row.CampaignID, row.CampaignName, row.SenderEmail, row.RecipientEmail,
+				row.Subject, row.Provider, row.Status, row.ErrorMessage, row.Opens, row.FirstOpenedAt,
+				row.Clicks, row.FirstClickedAt, row.ClickedURLs)
+		})
+	}
+	if sheets, ok := out.(services.SheetWriter); ok && err == nil && summary != nil {
+		err = summary(sheets, totals)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Error("export interrompu", "file", filename, "error", err)
+		return
+	}
+	logging.FromContext(r.Context()).Info("export terminé", "file", filename, "format", format, "rows", totals.Total)
+}
+
+// rate retourne part/total en pourcentage arrondi à 0,1
+func rate(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(int(float64(part)*1000/float64(total)+0.5)) / 10
+}
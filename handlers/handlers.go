@@ -3,29 +3,44 @@ package handlers
 import (
 	"bulk-email-mailgun/config"
 	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
 	"bulk-email-mailgun/middleware"
 	"bulk-email-mailgun/models"
 	"bulk-email-mailgun/services"
-	"encoding/csv"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 type Handler struct {
-	emailService *services.EmailService
-	wsService    *services.WebSocketService
-	upgrader     websocket.Upgrader
+	emailService        *services.EmailService
+	wsService           *services.WebSocketService
+	trackingService     *services.TrackingService
+	attachmentService   *services.AttachmentService
+	domainChecker       *services.DomainChecker
+	importService       *services.ImportService
+	subscriptionService *services.SubscriptionService
+	retentionService    *services.RetentionService
+	healthService       *services.HealthService
+	upgrader            websocket.Upgrader
 }
 
-func NewHandler(emailService *services.EmailService, wsService *services.WebSocketService) *Handler {
+func NewHandler(emailService *services.EmailService, wsService *services.WebSocketService, trackingService *services.TrackingService, attachmentService *services.AttachmentService, domainChecker *services.DomainChecker, importService *services.ImportService, subscriptionService *services.SubscriptionService, retentionService *services.RetentionService, healthService *services.HealthService) *Handler {
 	return &Handler{
-		emailService: emailService,
-		wsService:    wsService,
+		emailService:        emailService,
+		wsService:           wsService,
+		trackingService:     trackingService,
+		attachmentService:   attachmentService,
+		domainChecker:       domainChecker,
+		importService:       importService,
+		subscriptionService: subscriptionService,
+		retentionService:    retentionService,
+		healthService:       healthService,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
@@ -103,10 +118,13 @@ func (h *Handler) ConfigHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// UploadHandler enregistre un fichier de destinataires (CSV, XLSX, JSON/NDJSON, vCard).
+// Avec preview=1 l'import reste en attente et l'aperçu est retourné ; sinon il
+// démarre aussitôt. Les options (JSON) peuvent être passées dans le champ "options".
 func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	file, _, err := r.FormFile("file")
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		json.NewEncoder(w).Encode(models.UploadResponse{
 			Success: false,
@@ -116,44 +134,49 @@ func (h *Handler) UploadHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	var opts models.ImportOptions
+	if raw := r.FormValue("options"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &opts); err != nil {
+			json.NewEncoder(w).Encode(models.UploadResponse{
+				Success: false,
+				Error:   "Options invalides",
+			})
+			return
+		}
+	}
+	if r.URL.Query().Get("verify") == "0" {
+		opts.SkipVerify = true
+	}
+
+	importID, err := h.importService.Store(r.Context(), header.Filename, file, middleware.CurrentUser(r))
 	if err != nil {
 		json.NewEncoder(w).Encode(models.UploadResponse{
 			Success: false,
-			Error:   "CSV read error",
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	var emails []models.EmailData
-	insertedCount := 0
-
-	for i, record := range records {
-		if i == 0 {
-			continue
-		}
-		if len(record) >= 1 {
-			email := models.EmailData{
-				Email: strings.TrimSpace(record[0]),
-			}
-
-			// Insérer dans la DB
-			_, err := database.InsertOrGetRecipient(email.Email)
-			if err == nil {
-				insertedCount++
-			}
-
-			emails = append(emails, email)
+	if r.FormValue("preview") == "1" {
+		preview, err := h.importService.Preview(r.Context(), importID, opts)
+		if err != nil {
+			json.NewEncoder(w).Encode(models.UploadResponse{
+				Success:  false,
+				ImportID: importID,
+				Error:    err.Error(),
+			})
+			return
 		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":   true,
+			"import_id": importID,
+			"preview":   preview,
+		})
+		return
 	}
 
-	json.NewEncoder(w).Encode(models.UploadResponse{
-		Success: true,
-		Count:   len(emails),
-		Emails:  emails,
-		Message: fmt.Sprintf("%d recipients ajoutés/mis à jour dans la base de données", insertedCount),
-	})
+	h.startImport(w, r, importID, opts)
 }
 
 func (h *Handler) SendHandler(w http.ResponseWriter, r *http.Request) {
@@ -168,44 +191,179 @@ func (h *Handler) SendHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Déterminer le provider (mailgun par défaut)
-	provider := req.Provider
-	if provider == "" {
-		provider = "mailgun"
+	if err := h.prepareSend(r.Context(), &req); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// Chaque envoi direct est enregistré comme une campagne
+	if req.CampaignID == 0 {
+		campaignID, err := database.CreateCampaign(r.Context(), &database.Campaign{
+			Name:              req.Subject,
+			Subject:           req.Subject,
+			Body:              req.Body,
+			TextBody:          req.TextBody,
+			Provider:          req.Provider,
+			SenderName:        req.SenderName,
+			TrackClicks:       req.TrackClicks,
+			TrackOpens:        req.TrackOpens,
+			TemplateVersionID: req.TemplateVersionID,
+			AttachmentIDs:     req.AttachmentIDs,
+			ListIDs:           req.ListIDs,
+			SegmentIDs:        req.SegmentIDs,
+			ClickTags:         req.ClickTags,
+			TopicID:           req.TopicID,
+			Status:            "draft",
+			CreatedBy:         middleware.CurrentUser(r),
+		})
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		req.CampaignID = campaignID
 	}
 
-	// Vérifier la configuration selon le provider
-	if provider == "mailgun" {
-		if config.AppConfig.MailgunDomain == "" || config.AppConfig.MailgunAPIKey == "" {
+	h.launch(w, r, req)
+}
+
+// launch démarre l'envoi en arrière-plan et marque la campagne comme en cours
+func (h *Handler) launch(w http.ResponseWriter, r *http.Request, req models.SendRequest) {
+	// Une simulation laisse la campagne en brouillon ; sinon seul le premier
+	// passage à "sending" démarre l'envoi
+	if !req.DryRun {
+		started, err := database.StartCampaign(r.Context(), req.CampaignID)
+		if err != nil {
 			json.NewEncoder(w).Encode(models.APIResponse{
 				Success: false,
-				Error:   "Mailgun not configured",
+				Error:   err.Error(),
 			})
 			return
 		}
-	} else if provider == "gmail" {
-		if config.AppConfig.Email == "" || config.AppConfig.Password == "" {
+		if !started {
+			w.WriteHeader(http.StatusConflict)
 			json.NewEncoder(w).Encode(models.APIResponse{
 				Success: false,
-				Error:   "Gmail not configured",
+				Error:   "Campagne déjà lancée",
 			})
 			return
 		}
 	}
 
-	go h.emailService.ProcessEmails(req, h.wsService.GetBroadcastChannel())
+	// L'envoi survit à la requête mais garde son logger (request_id)
+	h.emailService.Launch(context.WithoutCancel(r.Context()), req, h.wsService.GetBroadcastChannel())
 
-	json.NewEncoder(w).Encode(models.APIResponse{
-		Success: true,
-		Message: "Sending started with " + provider,
+	if req.DryRun {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success":     true,
+			"message":     "Dry run started with " + req.Provider,
+			"campaign_id": req.CampaignID,
+			"report":      fmt.Sprintf("/api/campaigns/%d/dry-run", req.CampaignID),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"message":     "Sending started with " + req.Provider,
+		"campaign_id": req.CampaignID,
 	})
 }
 
+// prepareSend complète et valide une demande d'envoi avant le premier email :
+// provider configuré, version de template, syntaxe du template et pièces jointes
+func (h *Handler) prepareSend(ctx context.Context, req *models.SendRequest) error {
+	// Déterminer le provider (mailgun par défaut)
+	if req.Provider == "" {
+		req.Provider = "mailgun"
+	}
+
+	// Vérifier la configuration selon le provider (inutile en simulation)
+	if !req.DryRun {
+		if err := services.CheckProviderConfig(req.Provider); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveTemplateVersion(ctx, req); err != nil {
+		return err
+	}
+
+	tags, err := database.NormalizeTags(req.ClickTags)
+	if err != nil {
+		return err
+	}
+	req.ClickTags = tags
+
+	if req.TopicID != 0 {
+		if _, err := database.GetTopic(ctx, req.TopicID); err != nil {
+			return fmt.Errorf("Thème introuvable")
+		}
+	}
+
+	// Charger les destinataires d'un import si la liste n'est pas fournie
+	if len(req.Emails) == 0 && req.ImportID != 0 {
+		recipients, err := database.GetImportRecipients(ctx, req.ImportID)
+		if err != nil {
+			return err
+		}
+		for _, recipient := range recipients {
+			req.Emails = append(req.Emails, models.EmailData{Email: recipient.Email, Fields: recipient.Attributes})
+		}
+	}
+
+	// Sinon, résoudre maintenant les listes et segments ciblés
+	if len(req.Emails) == 0 && (len(req.ListIDs) > 0 || len(req.SegmentIDs) > 0) {
+		recipients, err := database.ResolveAudience(ctx, req.ListIDs, req.SegmentIDs)
+		if err != nil {
+			return err
+		}
+		if len(recipients) == 0 {
+			return fmt.Errorf("Aucun destinataire dans les listes et segments ciblés")
+		}
+		for _, recipient := range recipients {
+			req.Emails = append(req.Emails, models.EmailData{Email: recipient.Email, Fields: recipient.Attributes})
+		}
+	}
+
+	// Valider le template avant le premier envoi
+	if err := services.ValidateEmailTemplate(req.Subject, req.Body, req.TextBody, req.Emails); err != nil {
+		return fmt.Errorf("Template invalide: %v", err)
+	}
+
+	// Vérifier les pièces jointes et les images intégrées référencées
+	attachments, err := h.attachmentService.Load(ctx, req.AttachmentIDs)
+	if err != nil {
+		return err
+	}
+	return services.CheckInlineReferences(req.Body, attachments)
+}
+
+// resolveTemplateVersion remplace l'objet et le corps par ceux de la version
+// de template référencée, le cas échéant
+func resolveTemplateVersion(ctx context.Context, req *models.SendRequest) error {
+	if req.TemplateVersionID == 0 {
+		return nil
+	}
+	version, err := database.GetTemplateVersionByID(ctx, req.TemplateVersionID)
+	if err != nil {
+		return fmt.Errorf("Version de template introuvable")
+	}
+	req.Subject = version.Subject
+	req.Body = version.Body
+	return nil
+}
+
 // StatsHandler retourne les statistiques
 func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	stats, err := database.GetStats()
+	stats, err := database.GetStats(r.Context())
 	if err != nil {
 		json.NewEncoder(w).Encode(models.APIResponse{
 			Success: false,
@@ -220,11 +378,25 @@ func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// HistoryHandler retourne l'historique des envois
+// HistoryHandler retourne une page de l'historique des envois, du plus récent au
+// plus ancien. Filtres : ?status=, campaign_id=, recipient_id=, recipient=,
+// sender=, provider=, from=, to= ; pagination : ?limit= et ?cursor= (next_cursor
+// de la page précédente). Le corps HTML s'obtient via /api/contents/{id}.
 func (h *Handler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	history, err := database.GetAllEmailSends()
+	filter, err := historyFilter(r)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	filter.Cursor, _ = strconv.ParseInt(r.URL.Query().Get("cursor"), 10, 64)
+	filter.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+
+	page, err := database.GetEmailSends(r.Context(), filter)
 	if err != nil {
 		json.NewEncoder(w).Encode(models.APIResponse{
 			Success: false,
@@ -234,16 +406,110 @@ func (h *Handler) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"history": history,
+		"success":     true,
+		"history":     page.Entries,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// historyFilter lit les filtres d'historique communs à la liste et aux exports
+func historyFilter(r *http.Request) (database.HistoryFilter, error) {
+	query := r.URL.Query()
+	filter := database.HistoryFilter{
+		Status:    query.Get("status"),
+		Recipient: query.Get("recipient"),
+		Sender:    query.Get("sender"),
+		Provider:  query.Get("provider"),
+	}
+	filter.CampaignID, _ = strconv.ParseInt(query.Get("campaign_id"), 10, 64)
+	filter.RecipientID, _ = strconv.ParseInt(query.Get("recipient_id"), 10, 64)
+
+	var err error
+	if filter.From, err = parseHistoryDate(query.Get("from"), false); err == nil {
+		filter.To, err = parseHistoryDate(query.Get("to"), true)
+	}
+	if err != nil {
+		return filter, fmt.Errorf("Date invalide (AAAA-MM-JJ ou RFC 3339)")
+	}
+	return filter, nil
+}
+
+// parseHistoryDate lit une date AAAA-MM-JJ ou RFC 3339. Une date seule en fin
+// d'intervalle inclut toute la journée.
+func parseHistoryDate(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// ContentHandler retourne le sujet et le corps HTML d'un contenu envoyé
+func (h *Handler) ContentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	content, err := database.GetEmailContent(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Contenu introuvable",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"id":         content.ID,
+		"subject":    content.Subject,
+		"body":       content.Body,
+		"created_at": content.CreatedAt,
 	})
 }
 
-// RecipientsHandler retourne tous les recipients
+// RecipientsHandler retourne les recipients, filtrés par adresse (?email=),
+// tags (?tag=, ?any_tag=, ?exclude_tag=), liste (?list_id=) ou segment (?segment_id=)
 func (h *Handler) RecipientsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	recipients, err := database.GetAllRecipients()
+	query := r.URL.Query()
+	filter := database.RecipientFilter{
+		TagFilter: database.TagFilter{
+			Tags:        splitQueryValues(query["tag"]),
+			AnyTags:     splitQueryValues(query["any_tag"]),
+			ExcludeTags: splitQueryValues(query["exclude_tag"]),
+		},
+		Email: query.Get("email"),
+	}
+	filter.ListID, _ = strconv.ParseInt(query.Get("list_id"), 10, 64)
+	filter.SegmentID, _ = strconv.ParseInt(query.Get("segment_id"), 10, 64)
+
+	var (
+		recipients []database.Recipient
+		err        error
+	)
+	if filter.IsEmpty() {
+		recipients, err = database.GetAllRecipients(r.Context())
+	} else {
+		recipients, err = database.SearchRecipients(r.Context(), filter)
+	}
 	if err != nil {
 		json.NewEncoder(w).Encode(models.APIResponse{
 			Success: false,
@@ -270,7 +536,7 @@ func (h *Handler) ResetDatabaseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := database.TruncateAllTables(); err != nil {
+	if err := database.TruncateAllTables(r.Context()); err != nil {
 		json.NewEncoder(w).Encode(models.APIResponse{
 			Success: false,
 			Error:   err.Error(),
@@ -278,6 +544,14 @@ func (h *Handler) ResetDatabaseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Les fichiers des pièces jointes et des imports n'ont plus de référence en base
+	if err := h.attachmentService.RemoveAll(); err != nil {
+		logging.FromContext(r.Context()).Error("suppression des pièces jointes impossible", "error", err)
+	}
+	if err := h.importService.RemoveAll(); err != nil {
+		logging.FromContext(r.Context()).Error("suppression des imports impossible", "error", err)
+	}
+
 	json.NewEncoder(w).Encode(models.APIResponse{
 		Success: true,
 		Message: "Base de données vidée avec succès",
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxImportIssues limite le nombre d'anomalies retournées pour un import
+	maxImportIssues = 1000
+	// importWait est le temps laissé à un import pour se terminer avant de
+	// répondre : un petit fichier retourne directement son bilan, un gros
+	// fichier se poursuit en arrière-plan et son bilan est diffusé par WebSocket
+	importWait = 3 * time.Second
+)
+
+// ImportsHandler liste les imports de destinataires
+func (h *Handler) ImportsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	jobs, err := database.GetAllImportJobs(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"imports": jobs,
+	})
+}
+
+// ImportPreviewHandler recalcule l'aperçu d'un import en attente avec de
+// nouvelles options (format, séparateur, encodage, mapping)
+func (h *Handler) ImportPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, opts, ok := importRequest(w, r)
+	if !ok {
+		return
+	}
+
+	preview, err := h.importService.Preview(r.Context(), id, opts)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"import_id": id,
+		"preview":   preview,
+	})
+}
+
+// ImportStartHandler lance un import en attente avec les options validées
+func (h *Handler) ImportStartHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, opts, ok := importRequest(w, r)
+	if !ok {
+		return
+	}
+
+	h.startImport(w, r, id, opts)
+}
+
+// startImport lance l'import et répond avec son statut et ses compteurs
+func (h *Handler) startImport(w http.ResponseWriter, r *http.Request, id int64, opts models.ImportOptions) {
+	done, err := h.importService.Start(r.Context(), id, opts)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.UploadResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	timer := time.NewTimer(importWait)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+	case <-r.Context().Done():
+		return
+	}
+
+	job, err := database.GetImportJob(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.UploadResponse{
+			Success:  false,
+			ImportID: id,
+			Error:    err.Error(),
+		})
+		return
+	}
+
+	summary := services.SummarizeImport(job)
+	response := models.UploadResponse{
+		Success:  job.Status != "failed",
+		ImportID: id,
+		Status:   job.Status,
+		Summary:  &summary,
+		Error:    job.Error,
+	}
+	switch job.Status {
+	case "done":
+		response.Message = "Import terminé"
+	case "running":
+		response.Message = "Import en cours"
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// importRequest lit l'ID de l'import et les options postées en JSON
+func importRequest(w http.ResponseWriter, r *http.Request) (int64, models.ImportOptions, bool) {
+	var opts models.ImportOptions
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return 0, opts, false
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return 0, opts, false
+	}
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return 0, opts, false
+		}
+	}
+
+	return id, opts, true
+}
+
+// ImportHandler retourne l'état d'un import et ses lignes rejetées ou signalées
+func (h *Handler) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	job, err := database.GetImportJob(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Import introuvable",
+		})
+		return
+	}
+
+	issues, err := database.GetImportIssues(r.Context(), id, maxImportIssues)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"import":  job,
+		"issues":  issues,
+	})
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/middleware"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultMembersPage est le nombre de membres retournés par défaut
+	defaultMembersPage = 100
+	// maxSegmentPreview limite l'aperçu des destinataires d'un segment
+	maxSegmentPreview = 100
+)
+
+// ListsHandler liste (GET) ou crée (POST) les listes de destinataires
+func (h *Handler) ListsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		var list database.RecipientList
+		if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		list.Name = strings.TrimSpace(list.Name)
+		if list.Name == "" {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Nom de liste requis",
+			})
+			return
+		}
+
+		id, err := database.CreateList(r.Context(), list.Name, list.Description, middleware.CurrentUser(r))
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"id":      id,
+		})
+		return
+	}
+
+	lists, err := database.GetAllLists(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"lists":   lists,
+	})
+}
+
+// ListHandler retourne une liste et une page de ses membres (GET, ?limit=&offset=)
+// ou la supprime (DELETE) ; les destinataires sont conservés
+func (h *Handler) ListHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	list, ok := loadList(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if err := database.DeleteList(r.Context(), list.ID); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: "Liste supprimée",
+		})
+		return
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultMembersPage
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	members, err := database.GetListMembers(r.Context(), list.ID, limit, offset)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"list":    list,
+		"members": members,
+	})
+}
+
+// ListMembersHandler ajoute (POST) ou retire (DELETE) des membres d'une liste,
+// désignés par adresse ({"emails": [...]}) ou par ID ({"recipient_ids": [...]}).
+// Les adresses inconnues sont créées à l'ajout.
+func (h *Handler) ListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" && r.Method != "DELETE" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	list, ok := loadList(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Emails       []string `json:"emails"`
+		RecipientIDs []int64  `json:"recipient_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Invalid JSON",
+		})
+		return
+	}
+
+	ids := body.RecipientIDs
+	invalid := []string{}
+	for _, raw := range body.Emails {
+		address, err := services.NormalizeEmail(raw)
+		if err != nil {
+			invalid = append(invalid, raw)
+			continue
+		}
+
+		if r.Method == "DELETE" {
+			recipient, err := database.FindRecipient(r.Context(), address)
+			if err != nil {
+				invalid = append(invalid, raw)
+				continue
+			}
+			ids = append(ids, int64(recipient.ID))
+			continue
+		}
+
+		id, err := database.UpsertRecipient(r.Context(), address, nil)
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	var (
+		count int
+		err   error
+	)
+	if r.Method == "DELETE" {
+		count, err = database.RemoveListMembers(r.Context(), list.ID, ids)
+	} else {
+		count, err = database.AddListMembers(r.Context(), list.ID, ids)
+	}
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"changed": count,
+		"invalid": invalid,
+	})
+}
+
+// SegmentsHandler liste (GET) ou crée (POST) les segments
+func (h *Handler) SegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		var segment database.Segment
+		if err := json.NewDecoder(r.Body).Decode(&segment); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		segment.Name = strings.TrimSpace(segment.Name)
+		if segment.Name == "" {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Nom de segment requis",
+			})
+			return
+		}
+		segment.CreatedBy = middleware.CurrentUser(r)
+
+		id, err := database.CreateSegment(r.Context(), &segment)
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"id":      id,
+		})
+		return
+	}
+
+	segments, err := database.GetAllSegments(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"segments": segments,
+	})
+}
+
+// SegmentHandler retourne un segment et son nombre actuel de destinataires (GET),
+// remplace ses règles (PUT) ou le supprime (DELETE)
+func (h *Handler) SegmentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	segment, ok := loadSegment(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		var update database.Segment
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		update.ID = segment.ID
+		update.Name = strings.TrimSpace(update.Name)
+		if update.Name == "" {
+			update.Name = segment.Name
+		}
+		if err := database.UpdateSegment(r.Context(), &update); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: "Segment mis à jour",
+		})
+		return
+
+	case "DELETE":
+		if err := database.DeleteSegment(r.Context(), segment.ID); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: "Segment supprimé",
+		})
+		return
+	}
+
+	count, err := database.CountSegmentRecipients(r.Context(), segment)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"segment": segment,
+		"count":   count,
+	})
+}
+
+// SegmentRecipientsHandler évalue un segment et retourne ses premiers destinataires
+func (h *Handler) SegmentRecipientsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	segment, ok := loadSegment(w, r)
+	if !ok {
+		return
+	}
+
+	recipients, err := database.GetSegmentRecipients(r.Context(), segment, maxSegmentPreview)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"recipients": recipients,
+	})
+}
+
+// loadList lit la liste désignée par {id} et écrit l'erreur si besoin
+func loadList(w http.ResponseWriter, r *http.Request) (*database.RecipientList, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return nil, false
+	}
+
+	list, err := database.GetList(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Liste introuvable",
+		})
+		return nil, false
+	}
+
+	return list, true
+}
+
+// loadSegment lit le segment désigné par {id} et écrit l'erreur si besoin
+func loadSegment(w http.ResponseWriter, r *http.Request) (*database.Segment, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return nil, false
+	}
+
+	segment, err := database.GetSegment(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Segment introuvable",
+		})
+		return nil, false
+	}
+
+	return segment, true
+}
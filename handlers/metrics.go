@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/config"
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsHandler expose les collecteurs enregistrés par les services
+var metricsHandler = promhttp.Handler()
+
+// MetricsHandler expose les métriques Prometheus. La route est hors session
+// (un scraper ne se connecte pas) ; si METRICS_TOKEN est défini, le jeton
+// doit être fourni en Authorization: Bearer.
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if token := config.AppConfig.MetricsToken; token != "" {
+		expected := []byte("Bearer " + token)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	metricsHandler.ServeHTTP(w, r)
+}
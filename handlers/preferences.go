@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TopicsHandler liste (GET) ou crée (POST) les thèmes de communication
+func (h *Handler) TopicsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		var topic database.Topic
+		if err := json.NewDecoder(r.Body).Decode(&topic); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		topic.Key = strings.ToLower(strings.TrimSpace(topic.Key))
+		topic.Name = strings.TrimSpace(topic.Name)
+		if topic.Key == "" || topic.Name == "" {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Clé et nom du thème requis",
+			})
+			return
+		}
+
+		id, err := database.CreateTopic(r.Context(), &topic)
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"id":      id,
+		})
+		return
+	}
+
+	topics, err := database.GetAllTopics(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"topics":  topics,
+	})
+}
+
+// TopicHandler retourne (GET), modifie (PUT) ou supprime (DELETE) un thème
+func (h *Handler) TopicHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	topic, err := database.GetTopic(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Thème introuvable",
+		})
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		var update database.Topic
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		topic.Description = update.Description
+		if name := strings.TrimSpace(update.Name); name != "" {
+			topic.Name = name
+		}
+		if err := database.UpdateTopic(r.Context(), topic); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: "Thème mis à jour",
+		})
+		return
+
+	case "DELETE":
+		if err := database.DeleteTopic(r.Context(), topic.ID); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: "Thème supprimé",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"topic":   topic,
+	})
+}
+
+// PreferencesPageHandler sert le centre de préférences public ; la page lit
+// et enregistre les choix via /api/preferences avec le jeton du lien
+func (h *Handler) PreferencesPageHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, "templates/preferences.html")
+}
+
+// PreferencesHandler retourne (GET) ou enregistre (POST) les préférences du
+// destinataire désigné par le jeton signé (?token=) :
+// {"unsubscribe_all": false, "topics": [{"id": 1, "subscribed": true, "frequency": "weekly"}]}
+func (h *Handler) PreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	recipientID, err := h.trackingService.VerifyPreferencesToken(r.URL.Query().Get("token"))
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if r.Method == "POST" {
+		var body struct {
+			UnsubscribeAll bool                       `json:"unsubscribe_all"`
+			Topics         []database.TopicPreference `json:"topics"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		if err := database.SavePreferences(r.Context(), recipientID, body.UnsubscribeAll, body.Topics); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		logging.FromContext(r.Context()).Info("préférences mises à jour", "recipient_id", recipientID)
+	}
+
+	preferences, err := database.GetPreferences(r.Context(), recipientID)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Destinataire introuvable",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":     true,
+		"preferences": preferences,
+	})
+}
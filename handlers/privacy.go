@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/middleware"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PrivacyExportHandler exporte tout ce qui est conservé pour une adresse
+// (droit d'accès) : ?email=...&format=json|zip. L'archive ZIP contient
+// export.json et le contenu HTML de chaque envoi.
+func (h *Handler) PrivacyExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if email == "" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "email requis",
+		})
+		return
+	}
+
+	export, err := database.ExportRecipientData(r.Context(), email)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	logging.FromContext(r.Context()).Info("export RGPD", "email_hash", database.SuppressionHash(email)[:12], "user", middleware.CurrentUser(r))
+
+	if r.URL.Query().Get("format") != "zip" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"export":  export,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"export-%s.zip\"", exportFilename(email)))
+
+	archive := zip.NewWriter(w)
+	if file, err := archive.Create("export.json"); err == nil {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(export)
+	}
+	for _, send := range export.Sends {
+		if file, err := archive.Create(fmt.Sprintf("messages/send-%d.html", send.ID)); err == nil {
+			file.Write([]byte(send.Body))
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logging.FromContext(r.Context()).Error("archive d'export RGPD incomplète", "error", err)
+	}
+}
+
+// PrivacyEraseHandler efface une adresse (droit à l'effacement) : {"email": "..."}.
+// L'adresse est ajoutée aux suppressions sous forme d'empreinte et ne pourra plus être importée.
+func (h *Handler) PrivacyEraseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	var body struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Invalid JSON",
+		})
+		return
+	}
+
+	email, err := services.NormalizeEmail(body.Email)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	report, err := database.EraseRecipient(r.Context(), email, middleware.CurrentUser(r))
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	logging.FromContext(r.Context()).Info("effacement RGPD", "email_hash", report.Hash[:12], "user", middleware.CurrentUser(r))
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"erasure": report,
+	})
+}
+
+// exportFilename remplace les caractères gênants dans un nom de fichier
+func exportFilename(email string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '/' || r == '\\' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, email)
+}
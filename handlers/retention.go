@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/middleware"
+	"bulk-email-mailgun/models"
+	"encoding/json"
+	"net/http"
+)
+
+// retentionRunsLimit est le nombre de purges récentes retournées avec les règles
+const retentionRunsLimit = 20
+
+// RetentionHandler retourne (GET) ou modifie (PUT) les règles de conservation ;
+// les champs absents du PUT gardent leur valeur actuelle
+func (h *Handler) RetentionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	policy, err := h.retentionService.Policy(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if r.Method == "PUT" || r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		policy.UpdatedBy = middleware.CurrentUser(r)
+		if err := h.retentionService.UpdatePolicy(r.Context(), policy); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		logging.FromContext(r.Context()).Info("règles de conservation modifiées", "user", policy.UpdatedBy,
+			"sends_days", policy.SendsDays, "events_days", policy.EventsDays, "interval_hours", policy.IntervalHours)
+
+		if policy, err = h.retentionService.Policy(r.Context()); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	runs, err := database.GetRetentionRuns(r.Context(), retentionRunsLimit)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"policy":  policy,
+		"runs":    runs,
+	})
+}
+
+// RetentionRunHandler lance immédiatement une purge et retourne son compte rendu
+func (h *Handler) RetentionRunHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	run, err := h.retentionService.Run(r.Context(), "manual")
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"run":     run,
+	})
+}
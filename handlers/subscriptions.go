@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxSignupBody limite la taille d'une demande d'inscription publique
+const maxSignupBody = 16 << 10
+
+// SubscribeHandler reçoit les inscriptions du formulaire public (JSON ou formulaire HTML)
+// et envoie l'email de confirmation. La réponse ne révèle pas si l'adresse était connue.
+func (h *Handler) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(config.AppConfig.SubscribeOrigins, origin) {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Vary", "Origin")
+	}
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSignupBody)
+
+	var (
+		req      services.SignupRequest
+		honeypot string
+	)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			services.SignupRequest
+			Website string `json:"website"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+		req, honeypot = body.SignupRequest, body.Website
+	} else {
+		if err := r.ParseForm(); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid data",
+			})
+			return
+		}
+		req.Email = r.PostForm.Get("email")
+		req.Source = r.PostForm.Get("source")
+		req.ListID, _ = strconv.ParseInt(r.PostForm.Get("list_id"), 10, 64)
+		req.Fields = map[string]string{}
+		for key := range r.PostForm {
+			if name, ok := strings.CutPrefix(key, "fields."); ok {
+				req.Fields[name] = r.PostForm.Get(key)
+			}
+		}
+		honeypot = r.PostForm.Get("website")
+	}
+
+	// Champ caché rempli : robot, la demande est ignorée silencieusement
+	if honeypot == "" {
+		if req.Source == "" {
+			req.Source = r.Referer()
+		}
+		req.IP = clientIP(r)
+
+		if err := h.subscriptionService.Subscribe(r.Context(), req); err != nil {
+			message := err.Error()
+			if !errors.Is(err, services.ErrListClosed) && !isAddressError(err) {
+				logging.FromContext(r.Context()).Error("inscription impossible", "error", err)
+				message = "Inscription impossible pour le moment"
+			}
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   message,
+			})
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: "Un email de confirmation vous a été envoyé",
+	})
+}
+
+// ConfirmSubscriptionHandler valide le lien reçu par email
+func (h *Handler) ConfirmSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	page := struct{ Title, Message string }{"Inscription confirmée", "Merci ! Votre inscription est bien enregistrée."}
+	if err := h.subscriptionService.Confirm(r.Context(), r.URL.Query().Get("token")); err != nil {
+		if !errors.Is(err, services.ErrInvalidConfirmation) {
+			logging.FromContext(r.Context()).Error("confirmation d'inscription impossible", "error", err)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		page.Title, page.Message = "Lien invalide", "Ce lien de confirmation est invalide ou a expiré. Merci de vous inscrire à nouveau."
+	}
+
+	tmpl, err := template.ParseFiles("templates/subscribe.html")
+	if err != nil {
+		http.Error(w, page.Message, http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, page)
+}
+
+// RecipientConsentHandler retourne la preuve d'inscription d'un destinataire
+func (h *Handler) RecipientConsentHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	consent, err := database.GetConsent(r.Context(), id)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Destinataire introuvable",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"consent": consent,
+	})
+}
+
+// clientIP retourne l'adresse du visiteur, transmise par nginx derrière le proxy
+func clientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isAddressError indique si l'erreur concerne l'adresse saisie
+func isAddressError(err error) bool {
+	return errors.Is(err, services.ErrEmptyAddress) || errors.Is(err, services.ErrInvalidAddress) ||
+		errors.Is(err, services.ErrInvalidDomain) || errors.Is(err, services.ErrAddressTooLong) ||
+		errors.Is(err, services.ErrQuotedLocal)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/models"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errNoTags = errors.New("Aucun tag fourni")
+
+// TagsHandler liste les tags et leur nombre de destinataires
+func (h *Handler) TagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	tags, err := database.GetAllTags(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"tags":    tags,
+	})
+}
+
+// RecipientTagsHandler ajoute ou retire des tags à tous les destinataires d'un filtre :
+// {"action": "add"|"remove", "tags": [...], "filter": {...}}.
+// Un filtre vide est refusé pour éviter de modifier toute la base par erreur.
+func (h *Handler) RecipientTagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	var body struct {
+		Action string                   `json:"action"`
+		Tags   []string                 `json:"tags"`
+		Filter database.RecipientFilter `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Invalid JSON",
+		})
+		return
+	}
+
+	if body.Action != "add" && body.Action != "remove" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "action doit valoir add ou remove",
+		})
+		return
+	}
+	if body.Filter.IsEmpty() {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Filtre requis",
+		})
+		return
+	}
+
+	tags, err := database.NormalizeTags(body.Tags)
+	if err == nil && len(tags) == 0 {
+		err = errNoTags
+	}
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	changed, err := database.TagRecipients(r.Context(), body.Filter, tags, body.Action == "add")
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"changed": changed,
+	})
+}
+
+// splitQueryValues accepte les paramètres répétés (?tag=a&tag=b) ou séparés par des virgules
+func splitQueryValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/middleware"
+	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TemplatesHandler liste (GET) ou crée (POST) les templates de la bibliothèque
+func (h *Handler) TemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == "POST" {
+		var req models.TemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Nom du template requis",
+			})
+			return
+		}
+		if _, err := services.ParseEmailTemplate(req.Subject, req.Body, ""); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Template invalide: " + err.Error(),
+			})
+			return
+		}
+
+		version, err := database.CreateTemplate(r.Context(), req.Name, req.Subject, req.Body, req.PreviewText, middleware.CurrentUser(r))
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"version": version,
+		})
+		return
+	}
+
+	templates, err := database.GetAllTemplates(r.Context())
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":   true,
+		"templates": templates,
+	})
+}
+
+// TemplateHandler retourne un template et ses versions (GET)
+// ou enregistre une nouvelle version (PUT/POST)
+func (h *Handler) TemplateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	templateID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	name, err := database.GetTemplateName(r.Context(), templateID)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Template introuvable",
+		})
+		return
+	}
+
+	if r.Method == "PUT" || r.Method == "POST" {
+		var req models.TemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Invalid JSON",
+			})
+			return
+		}
+		if _, err := services.ParseEmailTemplate(req.Subject, req.Body, ""); err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Template invalide: " + err.Error(),
+			})
+			return
+		}
+
+		version, err := database.AddTemplateVersion(r.Context(), templateID, req.Subject, req.Body, req.PreviewText, middleware.CurrentUser(r))
+		if err != nil {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"version": version,
+		})
+		return
+	}
+
+	versions, err := database.GetTemplateVersions(r.Context(), templateID)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"id":       templateID,
+		"name":     name,
+		"versions": versions,
+	})
+}
+
+// TemplateCloneHandler copie une version d'un template dans un nouveau template
+func (h *Handler) TemplateCloneHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Method not allowed",
+		})
+		return
+	}
+
+	templateID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	var req struct {
+		Name    string `json:"name"`
+		Version int    `json:"version"` // 0 = dernière version
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Nom du nouveau template requis",
+		})
+		return
+	}
+
+	versions, err := database.GetTemplateVersions(r.Context(), templateID)
+	if err != nil || len(versions) == 0 {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Template introuvable",
+		})
+		return
+	}
+
+	source := versions[0]
+	if req.Version != 0 {
+		found := false
+		for _, v := range versions {
+			if v.Version == req.Version {
+				source, found = v, true
+				break
+			}
+		}
+		if !found {
+			json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Error:   "Version introuvable",
+			})
+			return
+		}
+	}
+
+	version, err := database.CreateTemplate(r.Context(), strings.TrimSpace(req.Name), source.Subject, source.Body, source.PreviewText, middleware.CurrentUser(r))
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"version": version,
+	})
+}
+
+// TemplateDiffHandler compare deux versions d'un template (?from=1&to=2)
+func (h *Handler) TemplateDiffHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	templateID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "id invalide",
+		})
+		return
+	}
+
+	fromVersion, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	toVersion, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Paramètres from et to requis",
+		})
+		return
+	}
+
+	from, err := database.GetTemplateVersion(r.Context(), templateID, fromVersion)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Version from introuvable",
+		})
+		return
+	}
+	to, err := database.GetTemplateVersion(r.Context(), templateID, toVersion)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "Version to introuvable",
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":      true,
+		"from":         fromVersion,
+		"to":           toVersion,
+		"subject":      services.DiffLines(from.Subject, to.Subject),
+		"body":         services.DiffLines(from.Body, to.Body),
+		"preview_text": services.DiffLines(from.PreviewText, to.PreviewText),
+	})
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/middleware"
+	"bulk-email-mailgun/services"
+	"bulk-email-mailgun/tracing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// TestSendTraceHierarchy vérifie qu'un envoi produit une seule trace :
+// requête HTTP → campagne → destinataire → provider, les requêtes SQL étant
+// rattachées au span qui les exécute
+func TestSendTraceHierarchy(t *testing.T) {
+	exporter := tracing.UseMemory("axsender-test")
+
+	// Base SQLite jetable (Init ouvre ./emails.db)
+	t.Chdir(t.TempDir())
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	// Faux Mailgun
+	mailgun := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"<test@example.test>","message":"Queued. Thank you."}`))
+	}))
+	defer mailgun.Close()
+
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.MailgunDomain = "example.test"
+	config.AppConfig.MailgunAPIKey = "key-test"
+	config.AppConfig.MailgunAPIBase = mailgun.URL + "/v3"
+
+	tracking := services.NewTrackingService()
+	attachments := services.NewAttachmentService(t.TempDir())
+	domains := services.NewDomainChecker(nil)
+	emails := services.NewEmailService(tracking, attachments, domains)
+	ws := services.NewWebSocketService()
+	h := NewHandler(emails, ws, tracking, attachments, domains, nil, nil, services.NewRetentionService(), services.NewHealthService())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/send", h.SendHandler)
+	server := httptest.NewServer(middleware.Tracing(middleware.RequestID(mux)))
+	defer server.Close()
+
+	body := `{"emails":[{"email":"alice@example.com"}],"subject":"Bonjour","body":"<p>Bonjour</p>","provider":"mailgun"}`
+	resp, err := http.Post(server.URL+"/api/send", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// L'envoi se poursuit en arrière-plan : attendre la fin du span de campagne
+	spans := waitForSpan(t, exporter, "campaign.run")
+
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		if _, seen := byName[span.Name]; !seen {
+			byName[span.Name] = span
+		}
+	}
+	find := func(name string) tracetest.SpanStub {
+		t.Helper()
+		span, ok := byName[name]
+		if !ok {
+			t.Fatalf("span %q absent", name)
+		}
+		return span
+	}
+
+	root := find("POST /api/send")
+	if root.Parent.IsValid() {
+		t.Errorf("le span HTTP ne doit pas avoir de parent")
+	}
+
+	cases := []struct {
+		child, parent string
+	}{
+		{"database.CreateCampaign", "POST /api/send"},
+		{"database.StartCampaign", "POST /api/send"},
+		{"campaign.run", "POST /api/send"},
+		{"database.InsertEmailContent", "campaign.run"},
+		{"campaign.recipient", "campaign.run"},
+		{"database.UpsertRecipient", "campaign.recipient"},
+		{"mailgun.send", "campaign.recipient"},
+		{"database.InsertEmailSend", "campaign.recipient"},
+	}
+	for _, c := range cases {
+		child, parent := find(c.child), find(c.parent)
+		if child.SpanContext.TraceID() != root.SpanContext.TraceID() {
+			t.Errorf("%s: trace %s, attendu %s", c.child, child.SpanContext.TraceID(), root.SpanContext.TraceID())
+		}
+		if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+			t.Errorf("%s: parent %s, attendu %s (%s)", c.child, child.Parent.SpanID(), c.parent, parent.SpanContext.SpanID())
+		}
+	}
+}
+
+// waitForSpan attend qu'un span nommé name soit terminé et retourne tous les spans exportés
+func waitForSpan(t *testing.T, exporter *tracetest.InMemoryExporter, name string) tracetest.SpanStubs {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		spans := exporter.GetSpans()
+		for _, span := range spans {
+			if span.Name == name {
+				return spans
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("span %q non exporté", name)
+	return nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/models"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ClickHandler enregistre un clic puis redirige vers l'URL d'origine.
+// Seules les cibles signées sont honorées, pour éviter les redirections ouvertes.
+func (h *Handler) ClickHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.URL.Path, "/c/")
+
+	target, err := h.trackingService.Verify(token)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := database.InsertClick(r.Context(), target.ContentID, target.RecipientID, target.LinkIndex, target.URL, r.UserAgent()); err != nil {
+		logging.FromContext(r.Context()).Error("enregistrement du clic impossible", "recipient_id", target.RecipientID, "error", err)
+	}
+	if err := database.TagOnClick(r.Context(), target.ContentID, target.RecipientID); err != nil {
+		logging.FromContext(r.Context()).Error("tags de clic impossibles", "recipient_id", target.RecipientID, "error", err)
+	}
+
+	http.Redirect(w, r, target.URL, http.StatusFound)
+}
+
+// openPixel est un GIF transparent de 1x1 pixel
+var openPixel = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\x00\x00\x00!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+// OpenHandler enregistre l'ouverture d'un email (pixel de suivi) et renvoie une image transparente
+func (h *Handler) OpenHandler(w http.ResponseWriter, r *http.Request) {
+	if contentID, recipientID, err := h.trackingService.VerifyOpenToken(r.PathValue("token")); err == nil {
+		if err := database.InsertEvent(r.Context(), contentID, recipientID, database.EventOpen, ""); err != nil {
+			logging.FromContext(r.Context()).Error("enregistrement de l'ouverture impossible", "recipient_id", recipientID, "error", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate")
+	w.Write(openPixel)
+}
+
+// ClickStatsHandler retourne les clics par lien pour un contenu (?content_id=)
+func (h *Handler) ClickStatsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	contentID, err := strconv.ParseInt(r.URL.Query().Get("content_id"), 10, 64)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   "content_id invalide",
+		})
+		return
+	}
+
+	clicks, err := database.GetClickStats(r.Context(), contentID)
+	if err != nil {
+		json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"clicks":  clicks,
+	})
+}
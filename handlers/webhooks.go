@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/services"
+	"io"
+	"net/http"
+)
+
+// maxWebhookBody limite la taille d'un webhook provider
+const maxWebhookBody = 1 << 20
+
+// MailgunWebhookHandler reçoit les événements de délivrabilité Mailgun
+func (h *Handler) MailgunWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	h.providerWebhook(w, r, "mailgun", func(body []byte) (*services.ProviderEvent, error) {
+		return services.ParseMailgunWebhook(body)
+	})
+}
+
+// ResendWebhookHandler reçoit les événements de délivrabilité Resend
+func (h *Handler) ResendWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	h.providerWebhook(w, r, "resend", func(body []byte) (*services.ProviderEvent, error) {
+		return services.ParseResendWebhook(r.Header, body)
+	})
+}
+
+// providerWebhook vérifie le webhook puis enregistre l'événement. Une plainte
+// ou une désinscription signalée par le provider désinscrit le destinataire.
+func (h *Handler) providerWebhook(w http.ResponseWriter, r *http.Request, provider string, parse func([]byte) (*services.ProviderEvent, error)) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	event, err := parse(body)
+	if err == services.ErrWebhookDisabled {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("webhook refusé", "provider", provider, "error", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if event == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := database.InsertEvent(r.Context(), event.Ref.ContentID, event.Ref.RecipientID, event.Type, event.Detail); err != nil {
+		// Le provider retentera l'envoi du webhook
+		logging.FromContext(r.Context()).Error("enregistrement de l'événement impossible", "provider", provider,
+			"content_id", event.Ref.ContentID, "recipient_id", event.Ref.RecipientID, "error", err)
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	if event.Type == database.EventComplained || event.Type == database.EventUnsubscribed {
+		if err := database.MarkUnsubscribed(r.Context(), event.Ref.RecipientID); err != nil {
+			logging.FromContext(r.Context()).Error("désinscription impossible", "recipient_id", event.Ref.RecipientID, "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
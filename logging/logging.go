@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey struct{}
+
+// redactedKeys sont les attributs dont la valeur n'est jamais écrite dans les logs
+var redactedKeys = []string{"password", "secret", "token", "api_key", "apikey", "authorization", "cookie", "body", "html"}
+
+// Init configure le logger par défaut : niveau (debug, info, warn, error) et
+// format (json ou text) sur la sortie standard
+func Init(level, format string) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	var handler slog.Handler = slog.NewJSONHandler(os.Stdout, opts)
+	if format == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// redact masque les attributs sensibles, quel que soit l'appelant
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, sensitive := range redactedKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(a.Key, "[REDACTED]")
+		}
+	}
+	return a
+}
+
+// WithContext retourne un contexte portant le logger (et ses attributs de corrélation)
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext retourne le logger du contexte, ou le logger par défaut
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// EmailDomain retourne le domaine d'une adresse : les adresses complètes ne sont pas journalisées
+func EmailDomain(address string) string {
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		return strings.ToLower(address[at+1:])
+	}
+	return ""
+}
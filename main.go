@@ -4,20 +4,40 @@ import (
 	"bulk-email-mailgun/config"
 	"bulk-email-mailgun/database"
 	"bulk-email-mailgun/handlers"
+	"bulk-email-mailgun/logging"
 	"bulk-email-mailgun/middleware"
 	"bulk-email-mailgun/services"
-	"fmt"
-	"log"
+	"bulk-email-mailgun/tracing"
+	"context"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout borne l'attente des requêtes et des envois en cours à l'arrêt
+const shutdownTimeout = 20 * time.Second
+
+// flushTimeout borne l'export des derniers spans à l'arrêt
+const flushTimeout = 5 * time.Second
+
 func main() {
 	// Initialiser la configuration
 	config.Init()
+	logging.Init(config.AppConfig.LogLevel, config.AppConfig.LogFormat)
+
+	shutdownTracing, err := tracing.Init(config.AppConfig.TracesExporter, config.AppConfig.ServiceName)
+	if err != nil {
+		slog.Error("initialisation des traces impossible", "error", err)
+		os.Exit(1)
+	}
 
 	// Initialiser SQLite
 	if err := database.Init(); err != nil {
-		log.Fatal("❌ Erreur initialisation DB:", err)
+		slog.Error("initialisation de la base impossible", "error", err)
+		os.Exit(1)
 	}
 	defer database.Close()
 
@@ -25,13 +45,39 @@ func main() {
 	middleware.InitCleanup()
 
 	// Initialiser les services
-	emailService := services.NewEmailService()
+	trackingService := services.NewTrackingService()
+	attachmentService := services.NewAttachmentService(config.AppConfig.AttachmentsDir)
+	domainChecker := services.NewDomainChecker(nil)
+	emailService := services.NewEmailService(trackingService, attachmentService, domainChecker)
 	wsService := services.NewWebSocketService()
-	handler := handlers.NewHandler(emailService, wsService)
+	importService := services.NewImportService(config.AppConfig.ImportsDir, domainChecker, wsService.GetImportChannel())
+	subscriptionService := services.NewSubscriptionService(trackingService, emailService)
+	retentionService := services.NewRetentionService()
+	healthService := services.NewHealthService(config.AppConfig.AttachmentsDir, config.AppConfig.ImportsDir)
+	handler := handlers.NewHandler(emailService, wsService, trackingService, attachmentService, domainChecker, importService, subscriptionService, retentionService, healthService)
+
+	// Purge périodique selon les règles de conservation
+	retentionService.Start()
+
+	// Sondes de santé (docker, reverse proxy)
+	http.HandleFunc("/healthz", handler.HealthzHandler)
+	http.HandleFunc("/readyz", handler.ReadyzHandler)
 
 	// Routes publiques (sans authentification)
 	http.HandleFunc("/login", handler.LoginPageHandler)
 	http.HandleFunc("/api/login", handler.LoginHandler)
+	http.HandleFunc("/c/", handler.ClickHandler)
+	http.HandleFunc("/o/{token}", handler.OpenHandler)
+	http.HandleFunc("/webhooks/mailgun", handler.MailgunWebhookHandler)
+	http.HandleFunc("/webhooks/resend", handler.ResendWebhookHandler)
+	http.HandleFunc("/api/subscribe", handler.SubscribeHandler)
+	http.HandleFunc("/subscribe/confirm", handler.ConfirmSubscriptionHandler)
+	http.HandleFunc("/preferences", handler.PreferencesPageHandler)
+	http.HandleFunc("/api/preferences", handler.PreferencesHandler)
+	http.HandleFunc("/metrics", handler.MetricsHandler)
+	if config.AppConfig.MetricsToken == "" {
+		slog.Warn("METRICS_TOKEN non défini, /metrics ne doit pas être exposé hors du réseau interne")
+	}
 
 	// Routes protégées (avec authentification)
 	http.HandleFunc("/", middleware.AuthMiddleware(handler.IndexHandler))
@@ -39,14 +85,89 @@ func main() {
 	http.HandleFunc("/ws", middleware.AuthMiddleware(handler.WebSocketHandler))
 	http.HandleFunc("/api/config", middleware.AuthMiddleware(handler.ConfigHandler))
 	http.HandleFunc("/api/upload", middleware.AuthMiddleware(handler.UploadHandler))
+	http.HandleFunc("/api/imports", middleware.AuthMiddleware(handler.ImportsHandler))
+	http.HandleFunc("/api/imports/{id}", middleware.AuthMiddleware(handler.ImportHandler))
+	http.HandleFunc("/api/imports/{id}/preview", middleware.AuthMiddleware(handler.ImportPreviewHandler))
+	http.HandleFunc("/api/imports/{id}/start", middleware.AuthMiddleware(handler.ImportStartHandler))
 	http.HandleFunc("/api/send", middleware.AuthMiddleware(handler.SendHandler))
 	http.HandleFunc("/api/stats", middleware.AuthMiddleware(handler.StatsHandler))
+	http.HandleFunc("/api/analytics", middleware.AuthMiddleware(handler.AnalyticsHandler))
 	http.HandleFunc("/api/history", middleware.AuthMiddleware(handler.HistoryHandler))
+	http.HandleFunc("/api/history/export", middleware.AuthMiddleware(handler.HistoryExportHandler))
+	http.HandleFunc("/api/contents/{id}", middleware.AuthMiddleware(handler.ContentHandler))
 	http.HandleFunc("/api/recipients", middleware.AuthMiddleware(handler.RecipientsHandler))
 	http.HandleFunc("/api/reset", middleware.AuthMiddleware(handler.ResetDatabaseHandler))
+	http.HandleFunc("/api/clicks", middleware.AuthMiddleware(handler.ClickStatsHandler))
+	http.HandleFunc("/api/templates", middleware.AuthMiddleware(handler.TemplatesHandler))
+	http.HandleFunc("/api/templates/{id}", middleware.AuthMiddleware(handler.TemplateHandler))
+	http.HandleFunc("/api/templates/{id}/clone", middleware.AuthMiddleware(handler.TemplateCloneHandler))
+	http.HandleFunc("/api/templates/{id}/diff", middleware.AuthMiddleware(handler.TemplateDiffHandler))
+	http.HandleFunc("/api/attachments", middleware.AuthMiddleware(handler.AttachmentsHandler))
+	http.HandleFunc("/api/attachments/{id}", middleware.AuthMiddleware(handler.AttachmentHandler))
+	http.HandleFunc("/api/recipients/{id}/consent", middleware.AuthMiddleware(handler.RecipientConsentHandler))
+	http.HandleFunc("/api/recipients/tags", middleware.AuthMiddleware(handler.RecipientTagsHandler))
+	http.HandleFunc("/api/tags", middleware.AuthMiddleware(handler.TagsHandler))
+	http.HandleFunc("/api/retention", middleware.AuthMiddleware(handler.RetentionHandler))
+	http.HandleFunc("/api/retention/run", middleware.AuthMiddleware(handler.RetentionRunHandler))
+	http.HandleFunc("/api/privacy/export", middleware.AuthMiddleware(handler.PrivacyExportHandler))
+	http.HandleFunc("/api/privacy/erase", middleware.AuthMiddleware(handler.PrivacyEraseHandler))
+	http.HandleFunc("/api/topics", middleware.AuthMiddleware(handler.TopicsHandler))
+	http.HandleFunc("/api/topics/{id}", middleware.AuthMiddleware(handler.TopicHandler))
+	http.HandleFunc("/api/lists", middleware.AuthMiddleware(handler.ListsHandler))
+	http.HandleFunc("/api/lists/{id}", middleware.AuthMiddleware(handler.ListHandler))
+	http.HandleFunc("/api/lists/{id}/members", middleware.AuthMiddleware(handler.ListMembersHandler))
+	http.HandleFunc("/api/segments", middleware.AuthMiddleware(handler.SegmentsHandler))
+	http.HandleFunc("/api/segments/{id}", middleware.AuthMiddleware(handler.SegmentHandler))
+	http.HandleFunc("/api/segments/{id}/recipients", middleware.AuthMiddleware(handler.SegmentRecipientsHandler))
+	http.HandleFunc("/api/campaigns", middleware.AuthMiddleware(handler.CampaignsHandler))
+	http.HandleFunc("/api/campaigns/{id}", middleware.AuthMiddleware(handler.CampaignHandler))
+	http.HandleFunc("/api/campaigns/{id}/preview", middleware.AuthMiddleware(handler.CampaignPreviewHandler))
+	http.HandleFunc("/api/campaigns/{id}/test", middleware.AuthMiddleware(handler.CampaignTestHandler))
+	http.HandleFunc("/api/campaigns/{id}/send", middleware.AuthMiddleware(handler.CampaignSendHandler))
+	http.HandleFunc("/api/campaigns/{id}/dry-run", middleware.AuthMiddleware(handler.CampaignDryRunHandler))
+	http.HandleFunc("/api/campaigns/{id}/report", middleware.AuthMiddleware(handler.CampaignReportHandler))
+
+	server := &http.Server{
+		Addr:    ":8080",
+		Handler: middleware.Tracing(middleware.RequestID(http.DefaultServeMux)),
+	}
 
-	fmt.Println("Server started on http://localhost:8080")
-	fmt.Printf(" Provider: %s\n", config.AppConfig.Provider)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	go func() {
+		slog.Info("serveur démarré", "addr", server.Addr, "provider", config.AppConfig.Provider)
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			slog.Error("serveur arrêté", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	// Signaler l'arrêt à /readyz, laisser le temps au proxy de retirer l'instance,
+	// puis refuser les nouvelles connexions et terminer les requêtes en cours
+	healthService.SetShuttingDown()
+	drain := time.Duration(config.AppConfig.ShutdownDrainSeconds) * time.Second
+	slog.Info("arrêt demandé", "drain", drain.String())
+	time.Sleep(drain)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("arrêt du serveur incomplet", "error", err)
+	}
+
+	// Les campagnes encore en cours à l'échéance sont interrompues (reprise possible)
+	if err := emailService.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("envois en cours interrompus", "error", err)
+	}
+
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("export des traces incomplet", "error", err)
+	}
+	slog.Info("serveur arrêté")
 }
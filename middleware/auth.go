@@ -6,6 +6,9 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 const (
@@ -29,6 +32,14 @@ var Manager = &SessionManager{
 	sessions: make(map[string]*Session),
 }
 
+// Nombre de sessions actives, exposé sur /metrics
+var _ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+	Name: "axsender_active_sessions",
+	Help: "Sessions utilisateur non expirées.",
+}, func() float64 {
+	return float64(Manager.ActiveCount())
+})
+
 func GenerateToken() (string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
@@ -74,12 +85,39 @@ func (sm *SessionManager) ValidateSession(token string) bool {
 	return true
 }
 
+// GetUsername retourne l'utilisateur associé à une session valide
+func (sm *SessionManager) GetUsername(token string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[token]
+	if !exists || time.Now().After(session.ExpiresAt) {
+		return ""
+	}
+	return session.Username
+}
+
 func (sm *SessionManager) DeleteSession(token string) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	delete(sm.sessions, token)
 }
 
+// ActiveCount retourne le nombre de sessions non expirées
+func (sm *SessionManager) ActiveCount() int {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+	for _, session := range sm.sessions {
+		if now.Before(session.ExpiresAt) {
+			count++
+		}
+	}
+	return count
+}
+
 func (sm *SessionManager) CleanExpiredSessions() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -110,6 +148,15 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// CurrentUser retourne l'utilisateur connecté pour la requête
+func CurrentUser(r *http.Request) string {
+	cookie, err := r.Cookie("session_token")
+	if err != nil {
+		return ""
+	}
+	return Manager.GetUsername(cookie.Value)
+}
+
 func ValidateCredentials(username, password string) bool {
 	return username == DefaultUsername && password == DefaultPassword
 }
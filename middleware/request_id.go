@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bufio"
+	"bulk-email-mailgun/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader transporte l'identifiant de requête, en entrée comme en réponse
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limite les identifiants fournis par le client (proxy, load balancer)
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{8,64}$`)
+
+// statusRecorder retient le statut HTTP écrit par le handler et le motif de route
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	route  string
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack est requis par l'upgrade WebSocket
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// Unwrap permet à http.ResponseController d'atteindre la réponse d'origine
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RequestID attribue un identifiant à chaque requête, place un logger corrélé
+// dans son contexte et journalise la requête terminée. Seul le motif de route
+// est journalisé : les chemins et paramètres peuvent contenir des jetons.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := slog.Default().With("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logger = logger.With("trace_id", sc.TraceID().String())
+		}
+		r = r.WithContext(logging.WithContext(r.Context(), logger))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route := routeOf(r, rec)
+
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		logger.Log(r.Context(), level, "requête HTTP",
+			"method", r.Method,
+			"route", route,
+			"status", rec.status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// routeOf retourne le motif de route de la requête servie. Le ServeMux ne le
+// renseigne que sur la requête qu'il reçoit : le middleware le plus interne le
+// remonte au statusRecorder du middleware englobant.
+func routeOf(r *http.Request, rec *statusRecorder) string {
+	if rec.route == "" {
+		rec.route = r.Pattern
+	}
+	if outer, ok := rec.ResponseWriter.(*statusRecorder); ok && outer.route == "" {
+		outer.route = rec.route
+	}
+	return rec.route
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -9,20 +9,90 @@ type EmailConfig struct {
 	MailgunDomain string `json:"mailgun_domain"`
 	MailgunAPIKey string `json:"mailgun_api_key"`
 
+	// URL de l'API Mailgun (région EU : https://api.eu.mailgun.net/v3) ; vide = défaut du client
+	MailgunAPIBase string `json:"-"`
+
 	ResendAPIKey    string `json:"resend_api_key"`
 	ResendFromEmail string `json:"resend_from_email"`
+
+	// Clés de signature des webhooks de délivrabilité
+	MailgunWebhookKey   string `json:"-"`
+	ResendWebhookSecret string `json:"-"`
+
+	// Suivi des clics
+	PublicBaseURL  string `json:"public_base_url"`
+	TrackingSecret string `json:"-"`
+
+	// Répertoire de stockage des pièces jointes
+	AttachmentsDir string `json:"-"`
+	ImportsDir     string `json:"-"`
+
+	// Inscription publique en double opt-in
+	SubscribeLists      []int64  `json:"-"` // listes ouvertes à l'inscription, la première par défaut
+	SubscribeOrigins    []string `json:"-"` // origines autorisées (CORS) pour le formulaire
+	SubscribeSenderName string   `json:"-"`
+
+	// Conservation des données : valeurs initiales, modifiables ensuite via /api/retention
+	RetentionSendsDays     int `json:"-"`
+	RetentionEventsDays    int `json:"-"`
+	RetentionIntervalHours int `json:"-"`
+
+	// Supervision : jeton d'accès à /metrics, niveau et format des logs
+	MetricsToken string `json:"-"`
+	LogLevel     string `json:"-"`
+	LogFormat    string `json:"-"`
+
+	// Traces OpenTelemetry : exporteur (none, stdout, otlp) et nom du service
+	TracesExporter string `json:"-"`
+	ServiceName    string `json:"-"`
+
+	// Arrêt : délai pendant lequel /readyz signale l'arrêt avant la fermeture du serveur
+	ShutdownDrainSeconds int `json:"-"`
 }
 
 type EmailData struct {
-	Email string `json:"email"`
+	Email  string            `json:"email"`
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 type SendRequest struct {
-	Emails     []EmailData `json:"emails"`
-	Subject    string      `json:"subject"`
-	Body       string      `json:"body"`
-	Provider   string      `json:"provider"` // "mailgun", "resend"
-	SenderName string      `json:"sender_name"`
+	CampaignID  int64       `json:"campaign_id,omitempty"`
+	Emails      []EmailData `json:"emails"`
+	Subject     string      `json:"subject"`
+	Body        string      `json:"body"`
+	TextBody    string      `json:"text_body,omitempty"` // version texte, générée depuis le HTML si vide
+	Provider    string      `json:"provider"`            // "mailgun", "resend"
+	SenderName  string      `json:"sender_name"`
+	TrackClicks bool        `json:"track_clicks"` // suivi des clics
+	TrackOpens  bool        `json:"track_opens"`  // pixel de suivi des ouvertures (désactivé par défaut)
+
+	// Version de template de la bibliothèque (remplace subject/body si renseigné)
+	TemplateVersionID int64 `json:"template_version_id,omitempty"`
+
+	// Pièces jointes téléversées via /api/attachments
+	AttachmentIDs []int64 `json:"attachment_ids,omitempty"`
+
+	// Simulation : tout le pipeline est exécuté mais rien n'est envoyé
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Destinataires d'un import (/api/upload), utilisés si emails est vide
+	ImportID int64 `json:"import_id,omitempty"`
+
+	// Listes et segments ciblés, résolus au moment de l'envoi si emails est vide
+	ListIDs    []int64 `json:"list_ids,omitempty"`
+	SegmentIDs []int64 `json:"segment_ids,omitempty"`
+
+	// Tags posés sur les destinataires qui cliquent un lien suivi
+	ClickTags []string `json:"click_tags,omitempty"`
+
+	// Thème de l'envoi : les destinataires désabonnés du thème sont écartés
+	TopicID int64 `json:"topic_id,omitempty"`
+
+	// Écarter les adresses dont le domaine est invalide, jetable ou mal orthographié
+	ExcludeInvalid bool `json:"exclude_invalid,omitempty"`
+
+	// Reprise d'une campagne interrompue : les destinataires déjà servis sont écartés
+	Resume bool `json:"-"`
 }
 
 type ProgressUpdate struct {
@@ -34,11 +104,44 @@ type ProgressUpdate struct {
 }
 
 type UploadResponse struct {
-	Success bool        `json:"success"`
-	Count   int         `json:"count,omitempty"`
-	Emails  []EmailData `json:"emails,omitempty"`
-	Error   string      `json:"error,omitempty"`
-	Message string      `json:"message,omitempty"`
+	Success  bool           `json:"success"`
+	ImportID int64          `json:"import_id,omitempty"`
+	Status   string         `json:"status,omitempty"`  // statut de l'import au moment de la réponse
+	Summary  *ImportSummary `json:"summary,omitempty"` // compteurs, définitifs si l'import est terminé
+	Error    string         `json:"error,omitempty"`
+	Message  string         `json:"message,omitempty"`
+}
+
+// ImportOptions décrit comment lire un fichier importé ; les champs vides
+// sont détectés automatiquement
+type ImportOptions struct {
+	Format     string            `json:"format,omitempty"`    // "csv", "xlsx", "json", "vcard"
+	Delimiter  string            `json:"delimiter,omitempty"` // CSV : ",", ";", "\t", "|"
+	Encoding   string            `json:"encoding,omitempty"`  // CSV : "utf-8", "latin-1", "windows-1252"
+	Sheet      string            `json:"sheet,omitempty"`     // XLSX : première feuille par défaut
+	NoHeader   bool              `json:"no_header,omitempty"` // la première ligne contient déjà des données
+	Mapping    map[string]string `json:"mapping,omitempty"`   // colonne source -> "email", attribut, ou "" pour ignorer
+	SkipVerify bool              `json:"skip_verify,omitempty"`
+	ListID     int64             `json:"list_id,omitempty"` // liste à laquelle ajouter les destinataires importés
+	Tags       []string          `json:"tags,omitempty"`    // tags posés sur tous les destinataires importés
+}
+
+// ImportSummary contient les compteurs d'un import
+type ImportSummary struct {
+	Processed int `json:"processed"`
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Rejected  int `json:"rejected"`
+	Flagged   int `json:"flagged"`
+}
+
+// ImportProgress est diffusé par WebSocket pendant un import en arrière-plan ;
+// le dernier message (statut "done" ou "failed") porte les compteurs définitifs
+type ImportProgress struct {
+	ImportID int64  `json:"import_id"`
+	Status   string `json:"status"`
+	ImportSummary
+	Error string `json:"error,omitempty"`
 }
 
 type ConfigResponse struct {
@@ -56,3 +159,10 @@ type APIResponse struct {
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
 }
+
+type TemplateRequest struct {
+	Name        string `json:"name"`
+	Subject     string `json:"subject"`
+	Body        string `json:"body"`
+	PreviewText string `json:"preview_text"`
+}
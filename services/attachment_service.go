@@ -0,0 +1,259 @@
+package services
+
+import (
+	"bulk-email-mailgun/database"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxAttachmentSize est la taille maximale d'un fichier
+	MaxAttachmentSize = 10 << 20
+	// MaxCampaignAttachmentsSize est la taille cumulée maximale par campagne
+	MaxCampaignAttachmentsSize = 25 << 20
+)
+
+// attachmentTypes associe les extensions acceptées à leur type MIME
+var attachmentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".zip":  "application/zip",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xls":  "application/vnd.ms-excel",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".txt":  "text/plain",
+	".csv":  "text/csv",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// cidPattern repère les références cid: dans le HTML (src="cid:logo")
+var cidPattern = regexp.MustCompile(`(?i)(["'(])cid:([^"')\s]+)`)
+
+// LoadedAttachment est une pièce jointe prête à être envoyée
+type LoadedAttachment struct {
+	database.Attachment
+	Data []byte
+}
+
+type AttachmentService struct {
+	dir string
+}
+
+func NewAttachmentService(dir string) *AttachmentService {
+	return &AttachmentService{dir: dir}
+}
+
+// Save vérifie la taille et le type du fichier puis l'enregistre sur disque
+func (a *AttachmentService) Save(ctx context.Context, filename string, r io.Reader, inline bool, cid string) (*database.Attachment, error) {
+	filename = filepath.Base(strings.TrimSpace(filename))
+	if filename == "" || filename == "." || filename == string(filepath.Separator) {
+		return nil, fmt.Errorf("nom de fichier invalide")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxAttachmentSize {
+		return nil, fmt.Errorf("fichier trop volumineux (max %d Mo)", MaxAttachmentSize>>20)
+	}
+
+	contentType, err := detectAttachmentType(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	if inline && !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("seules les images peuvent être intégrées au HTML")
+	}
+
+	if inline {
+		cid = strings.TrimSpace(cid)
+		if cid == "" {
+			cid = filename
+		}
+	} else {
+		cid = ""
+	}
+
+	if err := os.MkdirAll(a.dir, 0755); err != nil {
+		return nil, err
+	}
+
+	name := make([]byte, 16)
+	rand.Read(name)
+	path := filepath.Join(a.dir, hex.EncodeToString(name))
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, err
+	}
+
+	attachment := &database.Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Path:        path,
+		Inline:      inline,
+		ContentID:   cid,
+		CreatedAt:   time.Now(),
+	}
+	attachment.ID, err = database.InsertAttachment(ctx, attachment)
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// Load lit les pièces jointes d'une campagne en vérifiant la taille cumulée ;
+// un identifiant répété dans la requête n'est joint qu'une fois
+func (a *AttachmentService) Load(ctx context.Context, ids []int64) ([]LoadedAttachment, error) {
+	ids = uniqueIDs(ids)
+	attachments, err := database.GetAttachments(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) != len(ids) {
+		return nil, fmt.Errorf("pièce jointe introuvable")
+	}
+
+	var total int64
+	loaded := make([]LoadedAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		total += attachment.Size
+		if total > MaxCampaignAttachmentsSize {
+			return nil, fmt.Errorf("pièces jointes trop volumineuses (max %d Mo par campagne)", MaxCampaignAttachmentsSize>>20)
+		}
+
+		data, err := os.ReadFile(attachment.Path)
+		if err != nil {
+			return nil, fmt.Errorf("lecture %s: %v", attachment.Filename, err)
+		}
+		loaded = append(loaded, LoadedAttachment{Attachment: attachment, Data: data})
+	}
+
+	return loaded, nil
+}
+
+// Delete supprime une pièce jointe de la base et du disque
+func (a *AttachmentService) Delete(ctx context.Context, id int64) error {
+	path, err := database.DeleteAttachment(ctx, id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// RemoveAll supprime tous les fichiers stockés (après un reset de la base)
+func (a *AttachmentService) RemoveAll() error {
+	return os.RemoveAll(a.dir)
+}
+
+// CheckInlineReferences vérifie que chaque cid: du HTML correspond à une seule image intégrée
+func CheckInlineReferences(body string, attachments []LoadedAttachment) error {
+	known := map[string]bool{}
+	for _, attachment := range attachments {
+		if !attachment.Inline {
+			continue
+		}
+		if known[attachment.ContentID] {
+			return fmt.Errorf("plusieurs images intégrées utilisent cid:%s", attachment.ContentID)
+		}
+		known[attachment.ContentID] = true
+	}
+
+	for _, match := range cidPattern.FindAllStringSubmatch(body, -1) {
+		if !known[match[2]] {
+			return fmt.Errorf("image intégrée introuvable: cid:%s", match[2])
+		}
+	}
+	return nil
+}
+
+// inlineFilenames attribue à chaque image intégrée un nom de fichier unique,
+// pour les providers qui utilisent le nom de fichier comme Content-ID : deux
+// images nommées logo.png deviennent logo.png et logo-2.png
+func inlineFilenames(attachments []LoadedAttachment) map[int64]string {
+	names := map[int64]string{}
+	used := map[string]bool{}
+	for _, attachment := range attachments {
+		if !attachment.Inline {
+			continue
+		}
+		name := attachment.Filename
+		ext := filepath.Ext(name)
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(attachment.Filename, ext), n, ext)
+		}
+		used[strings.ToLower(name)] = true
+		names[attachment.ID] = name
+	}
+	return names
+}
+
+// resolveInlineFilenames remplace les cid: par le nom de fichier attribué
+// par inlineFilenames à chaque image intégrée
+func resolveInlineFilenames(body string, attachments []LoadedAttachment, names map[int64]string) string {
+	filenames := map[string]string{}
+	for _, attachment := range attachments {
+		if attachment.Inline {
+			filenames[attachment.ContentID] = names[attachment.ID]
+		}
+	}
+	if len(filenames) == 0 {
+		return body
+	}
+
+	return cidPattern.ReplaceAllStringFunc(body, func(match string) string {
+		parts := cidPattern.FindStringSubmatch(match)
+		if filename, ok := filenames[parts[2]]; ok {
+			return parts[1] + "cid:" + filename
+		}
+		return match
+	})
+}
+
+// uniqueIDs retire les doublons en conservant l'ordre
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// detectAttachmentType retourne le type MIME d'après l'extension, en vérifiant
+// pour les images et les PDF que le contenu correspond bien à l'extension
+func detectAttachmentType(filename string, data []byte) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	contentType, ok := attachmentTypes[ext]
+	if !ok {
+		return "", fmt.Errorf("type de fichier non autorisé: %s", ext)
+	}
+
+	if strings.HasPrefix(contentType, "image/") || contentType == "application/pdf" {
+		detected, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+		if detected != contentType {
+			return "", fmt.Errorf("contenu %s incohérent avec l'extension %s", detected, ext)
+		}
+	}
+
+	return contentType, nil
+}
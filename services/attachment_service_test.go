@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bulk-email-mailgun/database"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// onePixelPNG est une image PNG 1x1 valide
+var onePixelPNG, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII=")
+
+func inline(id int64, filename, cid string) LoadedAttachment {
+	return LoadedAttachment{Attachment: database.Attachment{ID: id, Filename: filename, Inline: true, ContentID: cid}}
+}
+
+func attached(id int64, filename string) LoadedAttachment {
+	return LoadedAttachment{Attachment: database.Attachment{ID: id, Filename: filename}}
+}
+
+func TestInlineFilenames(t *testing.T) {
+	cases := []struct {
+		name        string
+		attachments []LoadedAttachment
+		want        map[int64]string
+	}{
+		{"aucune", nil, map[int64]string{}},
+		{"noms distincts", []LoadedAttachment{inline(1, "logo.png", "logo"), inline(2, "photo.jpg", "photo")}, map[int64]string{1: "logo.png", 2: "photo.jpg"}},
+		{"même nom", []LoadedAttachment{inline(1, "logo.png", "a"), inline(2, "logo.png", "b"), inline(3, "logo.png", "c")}, map[int64]string{1: "logo.png", 2: "logo-2.png", 3: "logo-3.png"}},
+		{"casse différente", []LoadedAttachment{inline(1, "Logo.PNG", "a"), inline(2, "logo.png", "b")}, map[int64]string{1: "Logo.PNG", 2: "logo-2.png"}},
+		{"nom déjà suffixé", []LoadedAttachment{inline(1, "logo.png", "a"), inline(2, "logo-2.png", "b"), inline(3, "logo.png", "c")}, map[int64]string{1: "logo.png", 2: "logo-2.png", 3: "logo-3.png"}},
+		{"sans extension", []LoadedAttachment{inline(1, "logo", "a"), inline(2, "logo", "b")}, map[int64]string{1: "logo", 2: "logo-2"}},
+		{"pièces jointes ignorées", []LoadedAttachment{attached(1, "logo.png"), inline(2, "logo.png", "logo")}, map[int64]string{2: "logo.png"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := inlineFilenames(c.attachments); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("inlineFilenames = %v, attendu %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestResolveInlineFilenames(t *testing.T) {
+	attachments := []LoadedAttachment{inline(1, "logo.png", "entete"), inline(2, "logo.png", "pied"), attached(3, "tarifs.pdf")}
+	body := `<img src="cid:entete"><p style="background:url(cid:pied)"></p><img src='cid:inconnu'>`
+
+	got := resolveInlineFilenames(body, attachments, inlineFilenames(attachments))
+	want := `<img src="cid:logo.png"><p style="background:url(cid:logo-2.png)"></p><img src='cid:inconnu'>`
+	if got != want {
+		t.Errorf("resolveInlineFilenames =\n%s\nattendu\n%s", got, want)
+	}
+}
+
+func TestCheckInlineReferences(t *testing.T) {
+	cases := []struct {
+		name        string
+		body        string
+		attachments []LoadedAttachment
+		err         string
+	}{
+		{"sans image", `<p>Bonjour</p>`, nil, ""},
+		{"référence connue", `<img src="cid:logo">`, []LoadedAttachment{inline(1, "logo.png", "logo")}, ""},
+		{"même nom, cid distincts", `<img src="cid:a"><img src="cid:b">`, []LoadedAttachment{inline(1, "logo.png", "a"), inline(2, "logo.png", "b")}, ""},
+		{"référence inconnue", `<img src="cid:logo">`, nil, "introuvable: cid:logo"},
+		{"pièce jointe non intégrée", `<img src="cid:logo">`, []LoadedAttachment{{Attachment: database.Attachment{ID: 1, Filename: "logo.png", ContentID: "logo"}}}, "introuvable: cid:logo"},
+		{"cid en double", `<img src="cid:logo">`, []LoadedAttachment{inline(1, "a.png", "logo"), inline(2, "b.png", "logo")}, "plusieurs images intégrées utilisent cid:logo"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := CheckInlineReferences(c.body, c.attachments)
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("erreur inattendue : %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("erreur = %v, attendu %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestLoadDeduplicatesIDs(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	service := NewAttachmentService(t.TempDir())
+
+	logo, err := service.Save(ctx, "logo.png", bytes.NewReader(onePixelPNG), true, "logo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := service.Save(ctx, "notes.txt", strings.NewReader("notes"), false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := service.Load(ctx, []int64{logo.ID, notes.ID, logo.ID, notes.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, attachment := range loaded {
+		ids = append(ids, attachment.ID)
+	}
+	if want := []int64{logo.ID, notes.ID}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("pièces chargées %v, attendu %v", ids, want)
+	}
+
+	if _, err := service.Load(ctx, []int64{logo.ID, logo.ID + notes.ID + 1}); err == nil {
+		t.Errorf("un identifiant inconnu doit être refusé")
+	}
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"bulk-email-mailgun/database"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuts de délivrabilité d'un domaine
+const (
+	DomainValid      = "valid"      // MX (ou A/AAAA de repli) trouvé
+	DomainNoMX       = "no_mx"      // le domaine ne peut pas recevoir d'email
+	DomainDisposable = "disposable" // fournisseur d'adresses jetables
+	DomainTypo       = "typo"       // faute de frappe probable (gmial.com) sans serveur de messagerie
+	DomainUnknown    = "unknown"    // erreur DNS temporaire, non enregistrée en base
+)
+
+const (
+	domainCheckTTL     = 7 * 24 * time.Hour
+	domainCheckTimeout = 5 * time.Second
+	// domainCheckWorkers limite les requêtes DNS simultanées de CheckDomains
+	domainCheckWorkers = 8
+	// Les erreurs temporaires ne sont gardées qu'en mémoire, brièvement
+	domainUnknownTTL = time.Minute
+)
+
+// Resolver est le sous-ensemble de *net.Resolver utilisé par le vérificateur,
+// remplaçable par un faux DNS
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DomainVerdict est le résultat de la vérification d'une adresse
+type DomainVerdict struct {
+	Email      string `json:"email"`
+	Domain     string `json:"domain"`
+	Status     string `json:"status"`
+	Suggestion string `json:"suggestion,omitempty"` // domaine populaire proche, simple conseil si le domaine reçoit l'email
+	Detail     string `json:"detail,omitempty"`
+}
+
+// Deliverable indique si l'adresse peut être envoyée ; une erreur DNS
+// temporaire ne suffit pas à écarter un destinataire
+func (v DomainVerdict) Deliverable() bool {
+	return v.Status == DomainValid || v.Status == DomainUnknown
+}
+
+// Reason décrit le verdict pour les rapports d'import et d'envoi
+func (v DomainVerdict) Reason() string {
+	switch v.Status {
+	case DomainNoMX:
+		return fmt.Sprintf("aucun serveur de messagerie pour %s", v.Domain)
+	case DomainDisposable:
+		return fmt.Sprintf("adresse jetable (%s)", v.Domain)
+	case DomainTypo:
+		return fmt.Sprintf("domaine suspect %s, vouliez-vous dire %s ?", v.Domain, v.Suggestion)
+	case DomainValid:
+		if v.Suggestion != "" {
+			return fmt.Sprintf("%s reçoit les emails, vouliez-vous dire %s ?", v.Domain, v.Suggestion)
+		}
+	case DomainUnknown:
+		return fmt.Sprintf("vérification DNS impossible: %s", v.Detail)
+	}
+	return ""
+}
+
+// disposableDomains liste les fournisseurs d'adresses jetables courants
+var disposableDomains = map[string]bool{
+	"mailinator.com":     true,
+	"guerrillamail.com":  true,
+	"sharklasers.com":    true,
+	"10minutemail.com":   true,
+	"yopmail.com":        true,
+	"yopmail.fr":         true,
+	"tempmail.com":       true,
+	"temp-mail.org":      true,
+	"trashmail.com":      true,
+	"getnada.com":        true,
+	"throwawaymail.com":  true,
+	"maildrop.cc":        true,
+	"dispostable.com":    true,
+	"fakeinbox.com":      true,
+	"jetable.org":        true,
+	"mailnesia.com":      true,
+	"discard.email":      true,
+	"emailondeck.com":    true,
+	"mohmal.com":         true,
+	"spamgourmet.com":    true,
+	"mintemail.com":      true,
+	"mytemp.email":       true,
+	"burnermail.io":      true,
+	"guerrillamail.info": true,
+}
+
+// popularDomains sert de référence pour repérer les fautes de frappe
+var popularDomains = []string{
+	"gmail.com", "googlemail.com", "yahoo.com", "yahoo.fr", "hotmail.com", "hotmail.fr",
+	"outlook.com", "outlook.fr", "live.com", "live.fr", "icloud.com", "me.com", "aol.com",
+	"protonmail.com", "proton.me", "orange.fr", "wanadoo.fr", "free.fr", "sfr.fr",
+	"laposte.net", "neuf.fr", "bbox.fr", "gmx.fr", "gmx.com",
+}
+
+// knownDomains sont de vrais fournisseurs à une faute de frappe d'un domaine
+// populaire (mail.com et gmail.com) : aucune correction ne leur est suggérée
+var knownDomains = map[string]bool{
+	"mail.com":  true,
+	"email.com": true,
+	"ymail.com": true,
+	"cloud.com": true,
+}
+
+// DomainChecker vérifie les domaines destinataires (MX, jetables, fautes de
+// frappe) et met en cache les réponses DNS dans SQLite
+type DomainChecker struct {
+	resolver Resolver
+
+	mu     sync.Mutex
+	memory map[string]cachedVerdict
+}
+
+type cachedVerdict struct {
+	verdict DomainVerdict
+	expires time.Time
+}
+
+// NewDomainChecker crée un vérificateur ; resolver nil utilise le DNS système
+func NewDomainChecker(resolver Resolver) *DomainChecker {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &DomainChecker{resolver: resolver, memory: map[string]cachedVerdict{}}
+}
+
+// Check retourne le verdict pour une adresse déjà normalisée
+func (d *DomainChecker) Check(ctx context.Context, email string) DomainVerdict {
+	verdict := d.checkDomain(ctx, emailDomain(email))
+	verdict.Email = email
+	return verdict
+}
+
+// CheckDomains vérifie une liste de domaines distincts : les verdicts connus
+// d'abord, puis les requêtes DNS en parallèle. Les domaines encore en attente
+// à l'échéance de ctx sont "unknown" et seront réessayés au prochain appel.
+func (d *DomainChecker) CheckDomains(ctx context.Context, domains []string) map[string]DomainVerdict {
+	verdicts := make(map[string]DomainVerdict, len(domains))
+	var pending []string
+	for _, domain := range domains {
+		if verdict, ok := d.cached(ctx, domain); ok {
+			verdicts[domain] = verdict
+		} else {
+			pending = append(pending, domain)
+		}
+	}
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, domainCheckWorkers)
+	)
+	for _, domain := range pending {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			verdict := d.resolve(ctx, domain)
+			mu.Lock()
+			verdicts[domain] = verdict
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for domain, verdict := range verdicts {
+		verdicts[domain] = withSuggestion(verdict)
+	}
+	return verdicts
+}
+
+func (d *DomainChecker) checkDomain(ctx context.Context, domain string) DomainVerdict {
+	if verdict, ok := d.cached(ctx, domain); ok {
+		return withSuggestion(verdict)
+	}
+	return withSuggestion(d.resolve(ctx, domain))
+}
+
+// withSuggestion complète le verdict DNS d'une correction probable. Seul un
+// domaine sans serveur de messagerie est écarté comme faute de frappe : yahoo.gr
+// ou live.fi existent bel et bien, la suggestion n'est alors qu'un conseil.
+func withSuggestion(verdict DomainVerdict) DomainVerdict {
+	if verdict.Status == DomainDisposable {
+		return verdict
+	}
+	if verdict.Suggestion = suggestDomain(verdict.Domain); verdict.Suggestion != "" && verdict.Status == DomainNoMX {
+		verdict.Status = DomainTypo
+	}
+	return verdict
+}
+
+// cached retourne le verdict obtenu sans requête DNS : domaine jetable, ou
+// réponse en cache mémoire puis SQLite
+func (d *DomainChecker) cached(ctx context.Context, domain string) (DomainVerdict, bool) {
+	verdict := DomainVerdict{Domain: domain}
+
+	if disposableDomains[domain] {
+		verdict.Status = DomainDisposable
+		return verdict, true
+	}
+
+	d.mu.Lock()
+	cached, ok := d.memory[domain]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.verdict, true
+	}
+	if check, err := database.GetDomainCheck(ctx, domain, domainCheckTTL); err == nil {
+		verdict.Status, verdict.Detail = check.Status, check.Detail
+		d.remember(verdict, time.Until(check.CheckedAt.Add(domainCheckTTL)))
+		return verdict, true
+	}
+	return verdict, false
+}
+
+// resolve interroge le DNS et met le verdict en cache
+func (d *DomainChecker) resolve(ctx context.Context, domain string) DomainVerdict {
+	verdict := DomainVerdict{Domain: domain}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, domainCheckTimeout)
+	defer cancel()
+	verdict.Status, verdict.Detail = d.lookup(lookupCtx, domain)
+
+	if verdict.Status == DomainUnknown {
+		// Une requête interrompue par l'appelant ne dit rien du domaine
+		if ctx.Err() == nil {
+			d.remember(verdict, domainUnknownTTL)
+		}
+		return verdict
+	}
+
+	if err := database.SaveDomainCheck(lookupCtx, domain, verdict.Status, verdict.Detail); err != nil {
+		slog.Warn("cache de domaine indisponible", "domain", domain, "error", err)
+	}
+	d.remember(verdict, domainCheckTTL)
+	return verdict
+}
+
+func (d *DomainChecker) remember(verdict DomainVerdict, ttl time.Duration) {
+	d.mu.Lock()
+	d.memory[verdict.Domain] = cachedVerdict{verdict: verdict, expires: time.Now().Add(ttl)}
+	d.mu.Unlock()
+}
+
+// lookup interroge le DNS : un MX suffit, sinon un enregistrement A/AAAA
+// sert de MX implicite (RFC 5321 §5.1) ; un MX nul (RFC 7505) refuse l'email
+func (d *DomainChecker) lookup(ctx context.Context, domain string) (status, detail string) {
+	mxs, err := d.resolver.LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		if len(mxs) == 1 && (mxs[0].Host == "." || mxs[0].Host == "") {
+			return DomainNoMX, "MX nul"
+		}
+		return DomainValid, strings.TrimSuffix(mxs[0].Host, ".")
+	}
+	if err != nil && !isNotFound(err) {
+		return DomainUnknown, err.Error()
+	}
+
+	hosts, err := d.resolver.LookupHost(ctx, domain)
+	if err == nil && len(hosts) > 0 {
+		return DomainValid, hosts[0]
+	}
+	if err != nil && !isNotFound(err) {
+		return DomainUnknown, err.Error()
+	}
+	return DomainNoMX, "ni MX ni A/AAAA"
+}
+
+// emailDomain retourne le domaine en minuscules d'une adresse
+func emailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// suggestDomain retourne le domaine populaire le plus proche lorsque domain
+// n'en diffère que d'une faute de frappe (lettre en trop, manquante, remplacée ou inversée)
+func suggestDomain(domain string) string {
+	dot := strings.Index(domain, ".")
+	if dot <= 0 {
+		return ""
+	}
+	name, tld := domain[:dot], domain[dot+1:]
+
+	if knownDomains[domain] {
+		return ""
+	}
+	for _, known := range popularDomains {
+		if domain == known {
+			return ""
+		}
+	}
+
+	for _, known := range popularDomains {
+		knownDot := strings.Index(known, ".")
+		knownName, knownTLD := known[:knownDot], known[knownDot+1:]
+
+		switch {
+		case name == knownName && editDistance(tld, knownTLD) == 1 && len(tld) >= 2:
+			// gmail.con, yahoo.ffr
+			return known
+		case tld == knownTLD && len(knownName) >= 5 && editDistance(name, knownName) == 1:
+			// gmial.com, hotmal.fr ; les noms courts (live, free) donnent trop de faux positifs
+			return known
+		}
+	}
+	return ""
+}
+
+// editDistance calcule la distance de Damerau-Levenshtein restreinte (inversions comprises)
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
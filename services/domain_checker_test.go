@@ -0,0 +1,384 @@
+package services
+
+import (
+	"bulk-email-mailgun/database"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver est un DNS en mémoire ; un nom absent répond NXDOMAIN.
+// Avec delay, chaque requête MX attend avant de répondre, ou jusqu'à l'annulation de ctx.
+type fakeResolver struct {
+	mu      sync.Mutex
+	mx      map[string][]*net.MX
+	hosts   map[string][]string
+	mxErr   map[string]error
+	hostErr map[string]error
+	delay   time.Duration
+	calls   int
+	lookups map[string]int
+}
+
+func (f *fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	f.mu.Lock()
+	f.calls++
+	if f.lookups == nil {
+		f.lookups = map[string]int{}
+	}
+	f.lookups[name]++
+	f.mu.Unlock()
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return nil, &net.DNSError{Err: ctx.Err().Error(), Name: name, IsTimeout: true}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.mxErr[name]; err != nil {
+		return nil, err
+	}
+	if mx, ok := f.mx[name]; ok {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (f *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if err := f.hostErr[host]; err != nil {
+		return nil, err
+	}
+	if hosts, ok := f.hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (f *fakeResolver) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func (f *fakeResolver) lookupCount(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookups[name]
+}
+
+// openTestDB initialise une base SQLite jetable (Init ouvre ./emails.db)
+func openTestDB(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+}
+
+func TestDomainLookup(t *testing.T) {
+	temporary := &net.DNSError{Err: "server misbehaving", Name: "exemple.fr", IsTemporary: true}
+
+	cases := []struct {
+		name     string
+		resolver *fakeResolver
+		status   string
+		detail   string
+	}{
+		{
+			name:     "MX",
+			resolver: &fakeResolver{mx: map[string][]*net.MX{"exemple.fr": {{Host: "mx1.exemple.fr.", Pref: 10}}}},
+			status:   DomainValid,
+			detail:   "mx1.exemple.fr",
+		},
+		{
+			name:     "MX nul",
+			resolver: &fakeResolver{mx: map[string][]*net.MX{"exemple.fr": {{Host: ".", Pref: 0}}}},
+			status:   DomainNoMX,
+			detail:   "MX nul",
+		},
+		{
+			name:     "A de repli",
+			resolver: &fakeResolver{hosts: map[string][]string{"exemple.fr": {"192.0.2.1"}}},
+			status:   DomainValid,
+			detail:   "192.0.2.1",
+		},
+		{
+			name:     "NXDOMAIN",
+			resolver: &fakeResolver{},
+			status:   DomainNoMX,
+			detail:   "ni MX ni A/AAAA",
+		},
+		{
+			name:     "erreur temporaire sur MX",
+			resolver: &fakeResolver{mxErr: map[string]error{"exemple.fr": temporary}},
+			status:   DomainUnknown,
+			detail:   temporary.Error(),
+		},
+		{
+			name:     "erreur temporaire sur A",
+			resolver: &fakeResolver{hostErr: map[string]error{"exemple.fr": temporary}},
+			status:   DomainUnknown,
+			detail:   temporary.Error(),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, detail := NewDomainChecker(c.resolver).lookup(context.Background(), "exemple.fr")
+			if status != c.status || detail != c.detail {
+				t.Errorf("lookup = (%q, %q), attendu (%q, %q)", status, detail, c.status, c.detail)
+			}
+		})
+	}
+}
+
+func TestDomainCheckCache(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	resolver := &fakeResolver{mx: map[string][]*net.MX{"exemple.fr": {{Host: "mx.exemple.fr."}}}}
+	checker := NewDomainChecker(resolver)
+
+	expect := func(step string, calls int) {
+		t.Helper()
+		verdict := checker.Check(ctx, "jean@exemple.fr")
+		if verdict.Status != DomainValid || verdict.Email != "jean@exemple.fr" {
+			t.Fatalf("%s : verdict %+v", step, verdict)
+		}
+		if got := resolver.callCount(); got != calls {
+			t.Fatalf("%s : %d requêtes DNS, attendu %d", step, got, calls)
+		}
+	}
+	expireMemory := func() {
+		checker.mu.Lock()
+		cached := checker.memory["exemple.fr"]
+		cached.expires = time.Now().Add(-time.Second)
+		checker.memory["exemple.fr"] = cached
+		checker.mu.Unlock()
+	}
+
+	expect("première vérification", 1)
+	expect("cache mémoire", 1)
+
+	expireMemory()
+	expect("cache SQLite", 1)
+
+	expireMemory()
+	if _, err := database.DB.Exec(`UPDATE domain_checks SET checked_at = ?`, time.Now().UTC().Add(-domainCheckTTL-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expect("cache expiré", 2)
+}
+
+func TestDomainCheckUnknownNotPersisted(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	resolver := &fakeResolver{mxErr: map[string]error{"exemple.fr": &net.DNSError{Err: "timeout", IsTimeout: true, IsTemporary: true}}}
+	checker := NewDomainChecker(resolver)
+
+	verdict := checker.Check(ctx, "jean@exemple.fr")
+	if verdict.Status != DomainUnknown || !verdict.Deliverable() {
+		t.Fatalf("verdict %+v, attendu unknown et délivrable", verdict)
+	}
+	if _, err := database.GetDomainCheck(ctx, "exemple.fr", domainCheckTTL); err == nil {
+		t.Errorf("une erreur DNS temporaire ne doit pas être enregistrée en base")
+	}
+
+	checker.Check(ctx, "jean@exemple.fr")
+	if got := resolver.callCount(); got != 1 {
+		t.Errorf("%d requêtes DNS, attendu 1 (verdict gardé en mémoire)", got)
+	}
+
+	checker.mu.Lock()
+	if ttl := time.Until(checker.memory["exemple.fr"].expires); ttl > domainUnknownTTL {
+		t.Errorf("verdict temporaire gardé %v, maximum %v", ttl, domainUnknownTTL)
+	}
+	checker.mu.Unlock()
+}
+
+func TestDomainCheckTypo(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	resolver := &fakeResolver{mx: map[string][]*net.MX{}}
+	for _, domain := range []string{"mail.com", "yahoo.gr", "hotmail.gr", "live.fi", "free.fi"} {
+		resolver.mx[domain] = []*net.MX{{Host: "mx." + domain + "."}}
+	}
+	checker := NewDomainChecker(resolver)
+
+	cases := []struct {
+		email      string
+		status     string
+		suggestion string
+	}{
+		{"jean@yopmail.com", DomainDisposable, ""},
+		{"jean@gmial.com", DomainTypo, "gmail.com"},
+		{"jean@gmail.con", DomainTypo, "gmail.com"},
+		{"jean@mail.com", DomainValid, ""},
+
+		// Domaines réels proches d'un domaine populaire : simple suggestion
+		{"jean@yahoo.gr", DomainValid, "yahoo.fr"},
+		{"jean@hotmail.gr", DomainValid, "hotmail.fr"},
+		{"jean@live.fi", DomainValid, "live.fr"},
+		{"jean@free.fi", DomainValid, "free.fr"},
+	}
+	for _, c := range cases {
+		verdict := checker.Check(ctx, c.email)
+		if verdict.Status != c.status || verdict.Suggestion != c.suggestion {
+			t.Errorf("Check(%q) = %+v, attendu %s %q", c.email, verdict, c.status, c.suggestion)
+		}
+		if deliverable := verdict.Status == DomainValid; verdict.Deliverable() != deliverable {
+			t.Errorf("Check(%q).Deliverable() = %v", c.email, verdict.Deliverable())
+		}
+	}
+	// Les jetables sont reconnus sans requête DNS
+	if got := resolver.lookupCount("yopmail.com"); got != 0 {
+		t.Errorf("yopmail.com : %d requêtes MX, attendu 0", got)
+	}
+}
+
+func TestSuggestDomain(t *testing.T) {
+	cases := []struct {
+		domain string
+		want   string
+	}{
+		// Fautes de frappe
+		{"gmial.com", "gmail.com"},  // inversion
+		{"gmal.com", "gmail.com"},   // lettre manquante
+		{"gmaill.com", "gmail.com"}, // lettre en trop
+		{"gmail.con", "gmail.com"},  // extension
+		{"hotmal.fr", "hotmail.fr"},
+		{"yahooo.fr", "yahoo.fr"},
+		{"outlok.com", "outlook.com"},
+
+		// Domaines corrects ou fournisseurs réels proches d'un domaine populaire
+		{"gmail.com", ""},
+		{"hotmail.fr", ""},
+		{"mail.com", ""},
+		{"email.com", ""},
+		{"ymail.com", ""},
+		{"cloud.com", ""},
+
+		// Noms courts (live, free) : trop de faux positifs
+		{"lvie.fr", ""},
+		{"fre.fr", ""},
+
+		// Sans rapport
+		{"exemple.fr", ""},
+		{"localhost", ""},
+		{"gmail.co.uk", ""},
+	}
+
+	for _, c := range cases {
+		if got := suggestDomain(c.domain); got != c.want {
+			t.Errorf("suggestDomain(%q) = %q, attendu %q", c.domain, got, c.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"gmail", "gmail", 0},
+		{"gmail", "gmial", 1},
+		{"gmail", "gmal", 1},
+		{"gmail", "gmaill", 1},
+		{"gmail", "ymail", 1},
+		{"gmail", "hotmail", 3},
+		{"", "abc", 3},
+		{"bücher", "bucher", 1},
+	}
+	for _, c := range cases {
+		if got := editDistance(c.a, c.b); got != c.want {
+			t.Errorf("editDistance(%q, %q) = %d, attendu %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestCheckDomains(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	resolver := &fakeResolver{delay: 200 * time.Millisecond, mx: map[string][]*net.MX{}}
+	var domains []string
+	for _, domain := range []string{"a.fr", "b.fr", "c.fr", "d.fr", "e.fr", "f.fr", "g.fr", "h.fr"} {
+		resolver.mx[domain] = []*net.MX{{Host: "mx." + domain + "."}}
+		domains = append(domains, domain)
+	}
+	domains = append(domains, "yopmail.com", "gmial.com")
+	checker := NewDomainChecker(resolver)
+
+	// Les requêtes DNS sont parallèles : 8 domaines en un seul délai
+	start := time.Now()
+	verdicts := checker.CheckDomains(ctx, domains)
+	if elapsed := time.Since(start); elapsed > 4*resolver.delay {
+		t.Errorf("vérification en %v, les requêtes ne sont pas parallèles", elapsed)
+	}
+	if len(verdicts) != len(domains) {
+		t.Fatalf("%d verdicts pour %d domaines", len(verdicts), len(domains))
+	}
+	for _, domain := range domains[:8] {
+		if verdicts[domain].Status != DomainValid {
+			t.Errorf("%s : %+v", domain, verdicts[domain])
+		}
+	}
+	if verdicts["yopmail.com"].Status != DomainDisposable || verdicts["gmial.com"].Status != DomainTypo {
+		t.Errorf("jetable ou faute de frappe mal classés : %+v %+v", verdicts["yopmail.com"], verdicts["gmial.com"])
+	}
+	// gmial.com est résolu (MX puis A/AAAA) avant d'être classé faute de frappe
+	if got := resolver.callCount(); got != 10 {
+		t.Errorf("%d requêtes DNS, attendu 10", got)
+	}
+
+	// Deuxième passage : tout vient du cache
+	verdicts = checker.CheckDomains(ctx, domains)
+	if got := resolver.callCount(); got != 10 {
+		t.Errorf("%d requêtes DNS après un second passage, attendu 10", got)
+	}
+	if verdicts["gmial.com"].Status != DomainTypo {
+		t.Errorf("faute de frappe perdue par le cache : %+v", verdicts["gmial.com"])
+	}
+}
+
+func TestCheckDomainsDeadline(t *testing.T) {
+	openTestDB(t)
+
+	resolver := &fakeResolver{delay: time.Minute}
+	checker := NewDomainChecker(resolver)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	verdicts := checker.CheckDomains(ctx, []string{"lent.fr", "lent2.fr"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("CheckDomains a ignoré l'échéance du contexte (%v)", elapsed)
+	}
+	for domain, verdict := range verdicts {
+		if verdict.Status != DomainUnknown || !verdict.Deliverable() {
+			t.Errorf("%s : %+v, attendu unknown", domain, verdict)
+		}
+	}
+
+	// Un domaine interrompu par l'échéance n'est pas mis en cache
+	resolver.mu.Lock()
+	resolver.delay = 0
+	resolver.mx = map[string][]*net.MX{"lent.fr": {{Host: "mx.lent.fr."}}}
+	resolver.mu.Unlock()
+	if verdict := checker.Check(context.Background(), "jean@lent.fr"); verdict.Status != DomainValid {
+		t.Errorf("après l'échéance : %+v, attendu une nouvelle requête DNS", verdict)
+	}
+	if got := resolver.lookupCount("lent.fr"); got != 2 {
+		t.Errorf("%d requêtes pour lent.fr, attendu 2", got)
+	}
+}
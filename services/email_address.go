@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Erreurs de validation d'adresse, utilisées comme motif de rejet à l'import
+var (
+	ErrEmptyAddress   = errors.New("adresse vide")
+	ErrInvalidAddress = errors.New("syntaxe d'adresse invalide")
+	ErrInvalidDomain  = errors.New("domaine invalide")
+	ErrAddressTooLong = errors.New("adresse trop longue")
+	ErrQuotedLocal    = errors.New("partie locale entre guillemets non prise en charge")
+)
+
+// NormalizeEmail valide une adresse selon la syntaxe RFC 5322 (addr-spec) et
+// retourne sa forme canonique : domaine en minuscules et converti en punycode
+// pour les noms de domaine internationalisés. Une forme "Nom <adresse>" est acceptée.
+// Une partie locale qui n'est valide qu'entre guillemets ("jean dupont"@exemple.fr)
+// est refusée : net/mail la retourne sans ses guillemets, donc inutilisable.
+func NormalizeEmail(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrEmptyAddress
+	}
+
+	parsed, err := mail.ParseAddress(raw)
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+
+	at := strings.LastIndex(parsed.Address, "@")
+	if at <= 0 || at == len(parsed.Address)-1 {
+		return "", ErrInvalidAddress
+	}
+	local, domain := parsed.Address[:at], parsed.Address[at+1:]
+	if !isDotAtom(local) {
+		return "", ErrQuotedLocal
+	}
+
+	// Les littéraux IP ([192.0.2.1]) ne sont pas acceptés pour un envoi en masse
+	if strings.HasPrefix(domain, "[") {
+		return "", ErrInvalidDomain
+	}
+
+	domain, err = idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil || !strings.Contains(domain, ".") {
+		return "", ErrInvalidDomain
+	}
+	domain = strings.ToLower(domain)
+
+	if len(local) > 64 || len(local)+1+len(domain) > 254 {
+		return "", ErrAddressTooLong
+	}
+
+	return local + "@" + domain, nil
+}
+
+// isDotAtom indique si la partie locale s'écrit sans guillemets (RFC 5322 dot-atom,
+// caractères UTF-8 admis selon la RFC 6532)
+func isDotAtom(local string) bool {
+	if local == "" || strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return false
+	}
+	for _, r := range local {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r > 127:
+		case strings.ContainsRune(".!#$%&'*+-/=?^_`{|}~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// EmailKey retourne la clé de dédoublonnage d'une adresse normalisée : les
+// fournisseurs ignorent la casse de la partie locale en pratique
+func EmailKey(email string) string {
+	return strings.ToLower(email)
+}
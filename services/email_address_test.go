@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	cases := []struct {
+		name string
+		raw  string
+		want string
+		err  error
+	}{
+		{"simple", "jean@exemple.fr", "jean@exemple.fr", nil},
+		{"espaces", "  jean@exemple.fr \t", "jean@exemple.fr", nil},
+		{"domaine en minuscules", "Jean.Dupont@Exemple.FR", "Jean.Dupont@exemple.fr", nil},
+		{"nom affiché", "Jean Dupont <jean@exemple.fr>", "jean@exemple.fr", nil},
+		{"caractères atext", "jean+promo_2024!#$%&'*/=?^`{|}~-@exemple.fr", "jean+promo_2024!#$%&'*/=?^`{|}~-@exemple.fr", nil},
+		{"guillemets superflus", `"jean"@exemple.fr`, "jean@exemple.fr", nil},
+
+		// Noms de domaine internationalisés
+		{"IDN", "jean@bücher.example", "jean@xn--bcher-kva.example", nil},
+		{"IDN majuscules", "jean@BÜCHER.example", "jean@xn--bcher-kva.example", nil},
+		{"IDN déjà en punycode", "jean@xn--bcher-kva.example", "jean@xn--bcher-kva.example", nil},
+		{"partie locale UTF-8", "jösé@exemple.fr", "jösé@exemple.fr", nil},
+
+		// Parties locales qui n'existent qu'entre guillemets
+		{"espace entre guillemets", `"jean dupont"@exemple.fr`, "", ErrQuotedLocal},
+		{"points consécutifs entre guillemets", `"jean..dupont"@exemple.fr`, "", ErrQuotedLocal},
+		{"point initial entre guillemets", `".jean"@exemple.fr`, "", ErrQuotedLocal},
+		{"arobase entre guillemets", `"jean@bureau"@exemple.fr`, "", ErrQuotedLocal},
+		{"guillemets échappés", `"jean\"d"@exemple.fr`, "", ErrQuotedLocal},
+
+		// Rejets
+		{"vide", "   ", "", ErrEmptyAddress},
+		{"sans arobase", "jean.exemple.fr", "", ErrInvalidAddress},
+		{"sans partie locale", "@exemple.fr", "", ErrInvalidAddress},
+		{"sans domaine", "jean@", "", ErrInvalidAddress},
+		{"espace non protégé", "jean dupont@exemple.fr", "", ErrInvalidAddress},
+		{"points consécutifs", "jean..dupont@exemple.fr", "", ErrInvalidAddress},
+		{"point final du domaine", "jean@exemple.fr.", "", ErrInvalidAddress},
+		{"domaine sans point", "jean@localhost", "", ErrInvalidDomain},
+		{"littéral IP", "jean@[192.0.2.1]", "", ErrInvalidDomain},
+		{"tiret initial", "jean@-exemple.fr", "", ErrInvalidDomain},
+		{"punycode invalide", "jean@xn--zz.fr", "", ErrInvalidDomain},
+		{"partie locale trop longue", strings.Repeat("a", 65) + "@exemple.fr", "", ErrAddressTooLong},
+		{"adresse trop longue", "jean@" + strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 60) + ".fr", "", ErrAddressTooLong},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := NormalizeEmail(c.raw)
+			if !errors.Is(err, c.err) {
+				t.Fatalf("NormalizeEmail(%q) erreur = %v, attendu %v", c.raw, err, c.err)
+			}
+			if got != c.want {
+				t.Errorf("NormalizeEmail(%q) = %q, attendu %q", c.raw, got, c.want)
+			}
+		})
+	}
+}
+
+func TestEmailKey(t *testing.T) {
+	if a, b := EmailKey("Jean@exemple.fr"), EmailKey("jean@exemple.fr"); a != b {
+		t.Errorf("EmailKey ne doit pas dépendre de la casse : %q != %q", a, b)
+	}
+}
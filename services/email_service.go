@@ -3,21 +3,102 @@ package services
 import (
 	"bulk-email-mailgun/config"
 	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
 	"bulk-email-mailgun/models"
+	"bulk-email-mailgun/tracing"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mailgun/mailgun-go/v4"
 	"github.com/resend/resend-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type EmailService struct{}
+// interruptGrace laisse aux destinataires en cours d'envoi le temps d'enregistrer
+// leur résultat quand l'arrêt interrompt une campagne
+const interruptGrace = 5 * time.Second
+
+type EmailService struct {
+	tracking    *TrackingService
+	attachments *AttachmentService
+	domains     *DomainChecker
+
+	// Envois en arrière-plan, attendus à l'arrêt
+	active   sync.WaitGroup
+	mu       sync.Mutex
+	running  map[int64]bool // campagnes réelles en cours d'envoi
+	stopping chan struct{}  // fermé quand l'arrêt interrompt les envois
+	stopOnce sync.Once
+}
+
+func NewEmailService(tracking *TrackingService, attachments *AttachmentService, domains *DomainChecker) *EmailService {
+	return &EmailService{
+		tracking:    tracking,
+		attachments: attachments,
+		domains:     domains,
+		running:     make(map[int64]bool),
+		stopping:    make(chan struct{}),
+	}
+}
+
+// Launch démarre l'envoi de la campagne en arrière-plan ; Shutdown attend sa fin
+func (s *EmailService) Launch(ctx context.Context, req models.SendRequest, broadcast chan<- models.ProgressUpdate) {
+	s.active.Add(1)
+	go func() {
+		defer s.active.Done()
+		s.ProcessEmails(ctx, req, broadcast)
+	}()
+}
+
+// Shutdown attend la fin des envois en cours jusqu'à l'échéance de ctx, puis
+// les interrompt : plus aucun destinataire n'est traité et les campagnes
+// inachevées passent à l'état "interrupted", d'où elles peuvent être relancées
+func (s *EmailService) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.stopOnce.Do(func() { close(s.stopping) })
+	select {
+	case <-done:
+	case <-time.After(interruptGrace):
+	}
+
+	// Campagnes dont l'envoi n'a pas pu se terminer à temps
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.running {
+		if err := database.SetCampaignStatus(context.Background(), id, "interrupted"); err != nil {
+			slog.Error("mise à jour du statut de campagne impossible", "campaign_id", id, "error", err)
+		}
+	}
+	return ctx.Err()
+}
 
-func NewEmailService() *EmailService {
-	return &EmailService{}
+// stopped indique si l'arrêt a interrompu les envois
+func (s *EmailService) stopped() bool {
+	select {
+	case <-s.stopping:
+		return true
+	default:
+		return false
+	}
 }
 
 // generateRandomEmail génère un email aléatoire pour Mailgun
@@ -71,26 +152,34 @@ func buildResendEmail(senderName string) string {
 	return fmt.Sprintf("%s@%s", senderName, domain)
 }
 
-// SendEmailWithProvider envoie un email via le provider choisi
-func (s *EmailService) SendEmailWithProvider(to, subject, body, provider, senderName string) (string, error) {
+// SendEmailWithProvider envoie un email via le provider choisi.
+// Si text est vide, la version texte est générée depuis le HTML.
+func (s *EmailService) SendEmailWithProvider(ctx context.Context, to, subject, body, text, provider, senderName string, attachments []LoadedAttachment) (string, error) {
+	if text == "" {
+		text = HTMLToText(body)
+	}
+	ctx = logging.WithContext(ctx, logging.FromContext(ctx).With("provider", provider, "domain", logging.EmailDomain(to)))
 	if provider == "mailgun" {
-		senderEmail, err := s.sendWithMailgun(to, subject, body)
+		senderEmail, err := s.sendWithMailgun(ctx, to, subject, body, text, attachments, SendRef{})
 		return senderEmail, err
 	}
 	if provider == "resend" {
 		// ✅ Construire l'email dynamiquement
 		dynamicEmail := buildResendEmail(senderName)
-		return dynamicEmail, s.sendWithResend(to, subject, body, dynamicEmail, senderName)
+		return dynamicEmail, s.sendWithResend(ctx, to, subject, body, text, dynamicEmail, senderName, attachments, SendRef{})
 	}
 	return "", fmt.Errorf("provider inconnu: %s", provider)
 }
 
-func (s *EmailService) sendWithMailgun(to, subject, body string) (string, error) {
+func (s *EmailService) sendWithMailgun(ctx context.Context, to, subject, body, text string, attachments []LoadedAttachment, ref SendRef) (string, error) {
 	if config.AppConfig.MailgunDomain == "" || config.AppConfig.MailgunAPIKey == "" {
 		return "", fmt.Errorf("mailgun not configured")
 	}
 
 	mg := mailgun.NewMailgun(config.AppConfig.MailgunDomain, config.AppConfig.MailgunAPIKey)
+	if base := config.AppConfig.MailgunAPIBase; base != "" {
+		mg.SetAPIBase(base)
+	}
 
 	randomEmail := generateRandomEmail()
 	displayName := "Admirateur Secret"
@@ -99,27 +188,47 @@ func (s *EmailService) sendWithMailgun(to, subject, body string) (string, error)
 	message := mg.NewMessage(
 		fromAddress,
 		subject,
-		"",
+		text,
 		to,
 	)
-	message.SetHtml(body)
+	// Mailgun utilise le nom de fichier comme Content-ID des images intégrées
+	inlineNames := inlineFilenames(attachments)
+	message.SetHtml(resolveInlineFilenames(body, attachments, inlineNames))
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	// Variables renvoyées par les webhooks pour rattacher les événements à l'envoi
+	for name, value := range ref.values() {
+		message.AddVariable(name, value)
+	}
+
+	for _, attachment := range attachments {
+		if attachment.Inline {
+			message.AddReaderInline(inlineNames[attachment.ID], io.NopCloser(bytes.NewReader(attachment.Data)))
+		} else {
+			message.AddBufferAttachment(attachment.Filename, attachment.Data)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
 	defer cancel()
 
+	ctx, span := tracer.Start(ctx, "mailgun.send", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
 	resp, id, err := mg.Send(ctx, message)
+	observeProviderCall("mailgun", start, err)
+	tracing.End(span, err)
 
+	logger := logging.FromContext(ctx)
 	if err != nil {
-		fmt.Printf("❌ Erreur envoi Mailgun à %s: %v\n", to, err)
+		logger.Error("envoi échoué", "error", err)
 		return randomEmail, err
 	}
 
-	fmt.Printf("✅ Email envoyé via Mailgun depuis %s → %s (ID: %s, Response: %s)\n", randomEmail, to, id, resp)
+	logger.Debug("email envoyé", "message_id", id, "response", resp)
 	return randomEmail, nil
 }
 
 // ✅ MODIFIÉ: Accepter l'email et le nom dynamiques
-func (s *EmailService) sendWithResend(to, subject, body, fromEmail, displayName string) error {
+func (s *EmailService) sendWithResend(ctx context.Context, to, subject, body, text, fromEmail, displayName string, attachments []LoadedAttachment, ref SendRef) error {
 	if config.AppConfig.ResendAPIKey == "" {
 		return fmt.Errorf("resend not configured")
 	}
@@ -141,19 +250,39 @@ func (s *EmailService) sendWithResend(to, subject, body, fromEmail, displayName
 		To:      []string{to},
 		Subject: subject,
 		Html:    body,
+		Text:    text,
+	}
+	for name, value := range ref.values() {
+		params.Tags = append(params.Tags, resend.Tag{Name: name, Value: value})
 	}
 
-	sent, err := client.Emails.Send(params)
+	for _, attachment := range attachments {
+		params.Attachments = append(params.Attachments, &resend.Attachment{
+			Content:     attachment.Data,
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			ContentId:   attachment.ContentID,
+		})
+	}
+
+	ctx, span := tracer.Start(ctx, "resend.send", trace.WithSpanKind(trace.SpanKindClient))
+	start := time.Now()
+	sent, err := client.Emails.SendWithContext(ctx, params)
+	observeProviderCall("resend", start, err)
+	tracing.End(span, err)
+	logger := logging.FromContext(ctx)
 	if err != nil {
-		fmt.Printf("❌ Erreur envoi Resend à %s: %v\n", to, err)
+		logger.Error("envoi échoué", "error", err)
 		return err
 	}
 
-	fmt.Printf("✅ Email envoyé via Resend depuis %s → %s (ID: %s)\n", fromEmail, to, sent.Id)
+	logger.Debug("email envoyé", "message_id", sent.Id)
 	return nil
 }
 
-func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- models.ProgressUpdate) {
+// ProcessEmails envoie la campagne. Les logs reprennent les attributs du logger
+// de ctx (request_id) complétés de campaign_id puis de recipient_id.
+func (s *EmailService) ProcessEmails(ctx context.Context, req models.SendRequest, broadcast chan<- models.ProgressUpdate) {
 	total := len(req.Emails)
 	sent := 0
 	failed := 0
@@ -163,15 +292,70 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 		provider = "mailgun"
 	}
 
-	fmt.Printf("📧 Provider sélectionné: %s\n", provider)
+	ctx, span := tracer.Start(ctx, "campaign.run", trace.WithAttributes(
+		attribute.Int64("campaign.id", req.CampaignID),
+		attribute.String("campaign.provider", provider),
+		attribute.Int("campaign.recipients", total),
+		attribute.Bool("campaign.dry_run", req.DryRun),
+	))
+	var runErr error
+	defer func() { tracing.End(span, runErr) }()
+
+	logger := logging.FromContext(ctx).With("campaign_id", req.CampaignID, "provider", provider, "dry_run", req.DryRun)
+	logger.Info("envoi de campagne démarré", "recipients", total, "resume", req.Resume)
+
+	// Une campagne réelle en cours est marquée interrompue si l'arrêt n'attend pas sa fin
+	status := "sent"
+	if req.CampaignID != 0 && !req.DryRun {
+		s.mu.Lock()
+		s.running[req.CampaignID] = true
+		s.mu.Unlock()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, req.CampaignID)
+			s.mu.Unlock()
+		}()
+
+		// Le statut final est posé sur tous les chemins de sortie : une campagne
+		// qui n'a pas pu démarrer repasse en brouillon pour être corrigée et relancée
+		defer func() {
+			if runErr != nil {
+				status = "draft"
+			}
+			if err := database.SetCampaignStatus(context.WithoutCancel(ctx), req.CampaignID, status); err != nil {
+				logger.Error("mise à jour du statut de campagne impossible", "error", err)
+			}
+		}()
+	}
+
+	// Compiler le template une seule fois pour toute la campagne
+	tmpl, err := ParseEmailTemplate(req.Subject, req.Body, req.TextBody)
+	if err != nil {
+		logger.Error("template invalide", "error", err)
+		runErr = err
+		return
+	}
 
 	// 1. Créer le contenu d'email une seule fois
-	contentID, err := database.InsertEmailContent(req.Subject, req.Body)
+	contentID, err := database.InsertEmailContent(ctx, req.Subject, req.Body, req.TemplateVersionID, req.CampaignID)
 	if err != nil {
-		fmt.Printf("❌ Erreur création contenu: %v\n", err)
+		logger.Error("création du contenu impossible", "error", err)
+		runErr = err
 		return
 	}
-	fmt.Printf("📝 Contenu d'email créé (ID: %d)\n", contentID)
+	logger = logger.With("content_id", contentID)
+	span.SetAttributes(attribute.Int64("campaign.content_id", contentID))
+
+	// Charger les pièces jointes une seule fois pour toute la campagne
+	attachments, err := s.attachments.Load(ctx, req.AttachmentIDs)
+	if err != nil {
+		logger.Error("chargement des pièces jointes impossible", "error", err)
+		runErr = err
+		return
+	}
+	if err := database.LinkContentAttachments(ctx, contentID, req.AttachmentIDs); err != nil {
+		logger.Error("association des pièces jointes impossible", "error", err)
+	}
 
 	// Pour Resend, créer le sender UNE SEULE FOIS
 	var globalSenderID int64
@@ -183,12 +367,13 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 			displayName = "AxSender"
 		}
 
-		globalSenderID, err = database.InsertOrGetSender(dynamicEmail, displayName)
+		globalSenderID, err = database.InsertOrGetSender(ctx, dynamicEmail, displayName)
 		if err != nil {
-			fmt.Printf("❌ Erreur création sender: %v\n", err)
+			logger.Error("création de l'expéditeur impossible", "error", err)
+			runErr = err
 			return
 		}
-		fmt.Printf("📧 Expéditeur Resend: %s <%s>\n", displayName, dynamicEmail)
+		logger.Debug("expéditeur Resend", "sender_id", globalSenderID)
 	}
 
 	concurrency := 10
@@ -198,44 +383,155 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 		concurrency = 1 // ✅ Un seul email à la fois pour éviter rate limit
 	}
 
+	// skip comptabilise un destinataire écarté avant l'envoi
+	skip := func(ctx context.Context, index int, data models.EmailData, reason string) {
+		rlog := logging.FromContext(ctx)
+		rlog.Warn("destinataire ignoré", "reason", reason)
+		trace.SpanFromContext(ctx).AddEvent("skipped", trace.WithAttributes(attribute.String("reason", reason)))
+		if req.DryRun {
+			if err := database.InsertDryRunMessage(ctx, req.CampaignID, contentID, data.Email, "", "", "", "", "skipped", reason); err != nil {
+				rlog.Error("enregistrement de la simulation impossible", "error", err)
+			}
+		}
+		if !req.DryRun {
+			emailsSent.WithLabelValues(provider, "skipped").Inc()
+		}
+		failed++
+		broadcast <- models.ProgressUpdate{
+			Current:    index + 1,
+			Total:      total,
+			Sent:       sent,
+			Failed:     failed,
+			Percentage: float64(index+1) / float64(total) * 100,
+		}
+	}
+
 	semaphore := make(chan struct{}, concurrency)
+	sendQueueDepth.Add(float64(total))
 
+	interrupted := false
 	for i, emailData := range req.Emails {
-		semaphore <- struct{}{}
+		// Le span du destinataire couvre aussi l'attente d'une place de concurrence
+		recipientCtx, recipientSpan := tracer.Start(ctx, "campaign.recipient", trace.WithAttributes(attribute.Int("recipient.index", i)))
+		waitStart := time.Now()
+		select {
+		case semaphore <- struct{}{}:
+			interrupted = s.stopped()
+			if interrupted {
+				<-semaphore
+			}
+		case <-s.stopping:
+			interrupted = true
+		}
+		if interrupted {
+			// Arrêt du serveur : les destinataires restants ne sont pas traités
+			recipientSpan.End()
+			sendQueueDepth.Sub(float64(total - i))
+			break
+		}
+		wait := time.Since(waitStart)
+		throttleWait.WithLabelValues(provider, "concurrency").Observe(wait.Seconds())
+		recipientSpan.AddEvent("throttle.acquired", trace.WithAttributes(attribute.Int64("throttle.wait_ms", wait.Milliseconds())))
 
-		go func(index int, data models.EmailData) {
+		go func(ctx context.Context, span trace.Span, index int, data models.EmailData) {
+			defer span.End()
 			defer func() { <-semaphore }()
+			defer sendQueueDepth.Dec()
+
+			rlog := logger.With("recipient_index", index, "domain", logging.EmailDomain(data.Email))
+			ctx = logging.WithContext(ctx, rlog)
+
+			if strings.TrimSpace(data.Email) == "" {
+				skip(ctx, index, data, "adresse vide")
+				return
+			}
+
+			if req.ExcludeInvalid {
+				if verdict := s.domains.Check(ctx, data.Email); !verdict.Deliverable() {
+					skip(ctx, index, data, verdict.Reason())
+					return
+				}
+			}
 
 			// Insérer/récupérer le recipient
-			recipientID, err := database.InsertOrGetRecipient(data.Email)
+			recipientID, err := database.UpsertRecipient(ctx, data.Email, data.Fields)
 			if err != nil {
-				fmt.Printf("❌ Erreur recipient: %v\n", err)
-				failed++
-				broadcast <- models.ProgressUpdate{
-					Current:    index + 1,
-					Total:      total,
-					Sent:       sent,
-					Failed:     failed,
-					Percentage: float64(index+1) / float64(total) * 100,
+				skip(ctx, index, data, fmt.Sprintf("erreur recipient: %v", err))
+				return
+			}
+			rlog = rlog.With("recipient_id", recipientID)
+			ctx = logging.WithContext(ctx, rlog)
+			span.SetAttributes(attribute.Int64("recipient.id", recipientID))
+
+			// Reprise après interruption : ne pas renvoyer aux destinataires déjà servis
+			if req.Resume {
+				already, err := database.CampaignSentTo(ctx, req.CampaignID, recipientID)
+				if err != nil {
+					skip(ctx, index, data, fmt.Sprintf("erreur reprise: %v", err))
+					return
+				}
+				if already {
+					skip(ctx, index, data, "déjà envoyé avant l'interruption")
+					return
 				}
+			}
+
+			// Respecter la désinscription et les préférences de thème
+			allowed, reason, err := database.CheckSendAllowed(ctx, recipientID, req.TopicID)
+			if err != nil {
+				skip(ctx, index, data, fmt.Sprintf("erreur préférences: %v", err))
+				return
+			}
+			if !allowed {
+				skip(ctx, index, data, reason)
 				return
 			}
+			data = withPreferencesURL(data, s.tracking.PreferencesURL(recipientID))
 
-			// Personnaliser le body
-			body := strings.ReplaceAll(req.Body, "{{email}}", data.Email)
+			// Personnaliser l'objet et le body
+			rendered, err := tmpl.Render(data)
+			if err != nil {
+				skip(ctx, index, data, fmt.Sprintf("erreur template: %v", err))
+				return
+			}
+
+			// Réécrire les liens pour le suivi des clics
+			subject, body := rendered.Subject, rendered.HTML
+			if req.TrackClicks {
+				body = s.tracking.RewriteLinks(body, contentID, recipientID)
+			}
+
+			// Version texte : fournie par l'utilisateur ou générée depuis le HTML
+			text := rendered.Text
+			if text == "" {
+				text = HTMLToText(body)
+			}
+
+			// Pixel d'ouverture, sur demande (après la génération du texte)
+			if req.TrackOpens {
+				body = s.tracking.AddOpenPixel(body, contentID, recipientID)
+			}
 
 			// Envoyer l'email
 			var senderEmail string
 			var sendErr error
 			var senderID int64
 
-			if provider == "mailgun" {
-				senderEmail, sendErr = s.sendWithMailgun(data.Email, req.Subject, body)
+			if req.DryRun {
+				// Simulation : enregistrer le message au lieu de l'envoyer
+				senderEmail = buildResendEmail(req.SenderName)
+				if provider == "mailgun" {
+					senderEmail = generateRandomEmail()
+				}
+				sendErr = database.InsertDryRunMessage(ctx, req.CampaignID, contentID, data.Email, senderEmail, subject, body, text, "rendered", "")
+			} else if provider == "mailgun" {
+				senderEmail, sendErr = s.sendWithMailgun(ctx, data.Email, subject, body, text, attachments, SendRef{ContentID: contentID, RecipientID: recipientID})
 
 				displayName := "Admirateur Secret"
-				senderID, err = database.InsertOrGetSender(senderEmail, displayName)
+				senderID, err = database.InsertOrGetSender(ctx, senderEmail, displayName)
 				if err != nil {
-					fmt.Printf("❌ Erreur sender: %v\n", err)
+					rlog.Error("enregistrement de l'expéditeur impossible", "error", err)
+					emailsSent.WithLabelValues(provider, "failed").Inc()
 					failed++
 					broadcast <- models.ProgressUpdate{
 						Current:    index + 1,
@@ -249,7 +545,8 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 			} else if provider == "resend" {
 				// ✅ Utiliser l'email dynamique
 				senderEmail = buildResendEmail(req.SenderName)
-				sendErr = s.sendWithResend(data.Email, req.Subject, body, senderEmail, req.SenderName)
+				sendErr = s.sendWithResend(ctx, data.Email, subject, body, text, senderEmail, req.SenderName, attachments,
+					SendRef{ContentID: contentID, RecipientID: recipientID})
 				senderID = globalSenderID
 			}
 
@@ -264,10 +561,14 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 			} else {
 				sent++
 			}
+			span.SetAttributes(attribute.String("send.status", status))
 
-			// Enregistrer dans la DB
-			if err := database.InsertEmailSend(contentID, senderID, recipientID, status, errorMessage); err != nil {
-				fmt.Printf("❌ Erreur enregistrement DB: %v\n", err)
+			// Enregistrer dans la DB (l'historique réel n'inclut pas les simulations)
+			if !req.DryRun {
+				emailsSent.WithLabelValues(provider, status).Inc()
+				if err := database.InsertEmailSend(ctx, contentID, senderID, recipientID, provider, status, errorMessage); err != nil {
+					rlog.Error("enregistrement de l'envoi impossible", "error", err)
+				}
 			}
 
 			// Broadcaster la progression
@@ -286,8 +587,11 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 			} else if provider == "resend" {
 				delay = 1000 * time.Millisecond // ✅ 1 seconde entre chaque email
 			}
+			_, delaySpan := tracer.Start(ctx, "throttle.delay")
 			time.Sleep(delay)
-		}(i, emailData)
+			delaySpan.End()
+			throttleWait.WithLabelValues(provider, "delay").Observe(delay.Seconds())
+		}(recipientCtx, recipientSpan, i, emailData)
 	}
 
 	// Attendre que tous les envois soient terminés
@@ -295,10 +599,71 @@ func (s *EmailService) ProcessEmails(req models.SendRequest, broadcast chan<- mo
 		semaphore <- struct{}{}
 	}
 
-	fmt.Printf("\n🎉 Terminé! Total: %d | Envoyés: %d | Échoués: %d\n", total, sent, failed)
+	// Une simulation laisse la campagne en brouillon ; une campagne interrompue
+	// par l'arrêt pourra être relancée
+	if interrupted {
+		status = "interrupted"
+	}
+
+	span.SetAttributes(attribute.Int("campaign.sent", sent), attribute.Int("campaign.failed", failed),
+		attribute.Bool("campaign.interrupted", interrupted))
+	if interrupted {
+		logger.Warn("envoi de campagne interrompu par l'arrêt", "recipients", total, "sent", sent, "failed", failed)
+		return
+	}
+	logger.Info("envoi de campagne terminé", "recipients", total, "sent", sent, "failed", failed)
 }
 
-func (s *EmailService) personalizeBody(body string, data models.EmailData) string {
-	body = strings.ReplaceAll(body, "{{email}}", data.Email)
-	return body
+// withPreferencesURL ajoute le lien du centre de préférences aux variables du destinataire
+func withPreferencesURL(data models.EmailData, preferencesURL string) models.EmailData {
+	fields := make(map[string]string, len(data.Fields)+1)
+	for key, value := range data.Fields {
+		fields[key] = value
+	}
+	fields["preferences_url"] = preferencesURL
+	data.Fields = fields
+	return data
+}
+
+// TestResult est le résultat d'un envoi de test pour une adresse
+type TestResult struct {
+	Email  string `json:"email"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// SendTest envoie la campagne à une petite liste de test. L'objet est préfixé
+// par [TEST] et les résultats sont enregistrés dans test_sends, pas dans email_sends.
+func (s *EmailService) SendTest(ctx context.Context, req models.SendRequest, seeds []models.EmailData) ([]TestResult, error) {
+	tmpl, err := ParseEmailTemplate(req.Subject, req.Body, req.TextBody)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments, err := s.attachments.Load(ctx, req.AttachmentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]TestResult, 0, len(seeds))
+	for _, seed := range seeds {
+		result := TestResult{Email: seed.Email, Status: "sent"}
+
+		rendered, err := tmpl.Render(seed)
+		if err == nil {
+			_, err = s.SendEmailWithProvider(ctx, seed.Email, "[TEST] "+rendered.Subject, rendered.HTML, rendered.Text,
+				req.Provider, req.SenderName, attachments)
+		}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+
+		if err := database.InsertTestSend(ctx, req.CampaignID, seed.Email, req.Provider, result.Status, result.Error); err != nil {
+			logging.FromContext(ctx).Error("enregistrement de l'envoi de test impossible", "campaign_id", req.CampaignID, "error", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
 }
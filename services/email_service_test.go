@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/models"
+	"context"
+	"testing"
+)
+
+func TestProcessEmailsEarlyFailureKeepsCampaignRelaunchable(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	id, err := database.CreateCampaign(ctx, &database.Campaign{Name: "Rentrée", Subject: "Bonjour", Body: "<p>Bonjour</p>", Provider: "mailgun", Status: "draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started, err := database.StartCampaign(ctx, id); err != nil || !started {
+		t.Fatalf("lancement impossible : %v", err)
+	}
+
+	// Une pièce jointe inconnue fait échouer la campagne avant le premier envoi
+	service := NewEmailService(newTestTracking("secret"), NewAttachmentService(t.TempDir()), NewDomainChecker(&fakeResolver{}))
+	req := models.SendRequest{
+		CampaignID:    id,
+		Emails:        []models.EmailData{{Email: "jean@exemple.fr"}},
+		Subject:       "Bonjour",
+		Body:          "<p>Bonjour</p>",
+		Provider:      "mailgun",
+		AttachmentIDs: []int64{42},
+	}
+	broadcast := make(chan models.ProgressUpdate, 10)
+	service.ProcessEmails(ctx, req, broadcast)
+
+	campaign, err := database.GetCampaign(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if campaign.Status != "draft" {
+		t.Errorf("statut %q après un échec au démarrage, attendu draft", campaign.Status)
+	}
+	if started, err := database.StartCampaign(ctx, id); err != nil || !started {
+		t.Errorf("la campagne doit pouvoir être relancée : %v", err)
+	}
+}
+
+func TestInitInterruptsCampaignsLeftSending(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	id, err := database.CreateCampaign(ctx, &database.Campaign{Name: "Rentrée", Subject: "Bonjour", Body: "<p>Bonjour</p>", Provider: "mailgun", Status: "draft"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started, err := database.StartCampaign(ctx, id); err != nil || !started {
+		t.Fatalf("lancement impossible : %v", err)
+	}
+
+	// Redémarrage après un arrêt brutal en cours d'envoi
+	database.Close()
+	if err := database.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	campaign, err := database.GetCampaign(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if campaign.Status != "interrupted" {
+		t.Errorf("statut %q au redémarrage, attendu interrupted", campaign.Status)
+	}
+	if started, err := database.StartCampaign(ctx, id); err != nil || !started {
+		t.Errorf("la campagne doit pouvoir être relancée : %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bulk-email-mailgun/models"
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template/parse"
+	"unicode"
+)
+
+// legacyVarPattern repère l'ancienne syntaxe {{email}} pour la convertir en {{.email}}
+var legacyVarPattern = regexp.MustCompile(`\{\{\s*email\s*\}\}`)
+
+// templateFuncs sont les fonctions disponibles dans l'objet et le corps
+var templateFuncs = template.FuncMap{
+	"default": func(def, value interface{}) interface{} {
+		if value == nil {
+			return def
+		}
+		if s, ok := value.(string); ok && strings.TrimSpace(s) == "" {
+			return def
+		}
+		return value
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"title": func(s string) string {
+		words := strings.Fields(s)
+		for i, w := range words {
+			runes := []rune(strings.ToLower(w))
+			runes[0] = unicode.ToUpper(runes[0])
+			words[i] = string(runes)
+		}
+		return strings.Join(words, " ")
+	},
+}
+
+// EmailTemplate est un couple objet/corps compilé une seule fois par campagne.
+// Les deux parties utilisent html/template : variables {{.email}}, conditions
+// {{if}}, boucles {{range}} et valeurs par défaut {{.prenom | default "ami"}}.
+type EmailTemplate struct {
+	subject *template.Template
+	body    *template.Template
+	text    *template.Template // nil si la version texte est générée depuis le HTML
+}
+
+// RenderedEmail est le résultat du rendu pour un destinataire
+type RenderedEmail struct {
+	Subject string
+	HTML    string
+	Text    string // vide si aucune version texte n'a été fournie
+}
+
+// ParseEmailTemplate compile l'objet, le corps HTML et la version texte
+// optionnelle, et retourne une erreur explicite si l'un d'eux est invalide
+func ParseEmailTemplate(subject, body, text string) (*EmailTemplate, error) {
+	subjectTmpl, err := parseTemplate("subject", subject)
+	if err != nil {
+		return nil, fmt.Errorf("objet invalide: %v", err)
+	}
+
+	bodyTmpl, err := parseTemplate("body", body)
+	if err != nil {
+		return nil, fmt.Errorf("corps invalide: %v", err)
+	}
+
+	tmpl := &EmailTemplate{subject: subjectTmpl, body: bodyTmpl}
+	if strings.TrimSpace(text) != "" {
+		if tmpl.text, err = parseTemplate("text", text); err != nil {
+			return nil, fmt.Errorf("version texte invalide: %v", err)
+		}
+	}
+
+	return tmpl, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	text = legacyVarPattern.ReplaceAllString(text, "{{.email}}")
+	return template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// builtinVars sont les variables ajoutées à chaque destinataire lors de l'envoi
+var builtinVars = []string{"email", "preferences_url"}
+
+// ValidateEmailTemplate compile le template et l'exécute sur le premier destinataire,
+// pour qu'une faute de frappe fasse échouer la campagne avant le premier envoi.
+// Une variable absente au rendu vaut "" : chaque variable référencée doit donc
+// être une colonne ou un attribut d'au moins un destinataire ({{.Fisrt_name}}
+// est refusé), les valeurs manquantes passant par default.
+func ValidateEmailTemplate(subject, body, text string, recipients []models.EmailData) error {
+	tmpl, err := ParseEmailTemplate(subject, body, text)
+	if err != nil {
+		return err
+	}
+
+	sample := models.EmailData{Email: "exemple@example.com"}
+	if len(recipients) > 0 {
+		sample = recipients[0]
+
+		known := map[string]bool{}
+		for _, name := range builtinVars {
+			known[name] = true
+		}
+		for _, recipient := range recipients {
+			for name := range recipient.Fields {
+				known[name] = true
+			}
+		}
+		for _, name := range tmpl.variables() {
+			if !known[name] {
+				names := make([]string, 0, len(known))
+				for key := range known {
+					names = append(names, key)
+				}
+				sort.Strings(names)
+				return fmt.Errorf("variable inconnue {{.%s}} (disponibles : %s)", name, strings.Join(names, ", "))
+			}
+		}
+	}
+
+	_, err = tmpl.Render(sample)
+	return err
+}
+
+// variables retourne, triés, les noms des variables du destinataire
+// référencées dans l'objet, le corps et la version texte
+func (t *EmailTemplate) variables() []string {
+	seen := map[string]bool{}
+	for _, tmpl := range []*template.Template{t.subject, t.body, t.text} {
+		if tmpl != nil && tmpl.Tree != nil {
+			collectVariables(tmpl.Tree.Root, true, seen)
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectVariables parcourt l'arbre du template. root indique si le point
+// désigne encore le destinataire : {{range}} et {{with}} le redéfinissent,
+// seul $ y désigne alors les variables.
+func collectVariables(node parse.Node, root bool, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectVariables(child, root, seen)
+		}
+	case *parse.ActionNode:
+		collectVariables(n.Pipe, root, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectVariables(cmd, root, seen)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectVariables(arg, root, seen)
+		}
+	case *parse.ChainNode:
+		collectVariables(n.Node, root, seen)
+	case *parse.FieldNode:
+		if root {
+			seen[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			seen[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		collectVariables(n.Pipe, root, seen)
+		collectVariables(n.List, root, seen)
+		collectVariables(n.ElseList, root, seen)
+	case *parse.RangeNode:
+		collectVariables(n.Pipe, root, seen)
+		collectVariables(n.List, false, seen)
+		collectVariables(n.ElseList, root, seen)
+	case *parse.WithNode:
+		collectVariables(n.Pipe, root, seen)
+		collectVariables(n.List, false, seen)
+		collectVariables(n.ElseList, root, seen)
+	case *parse.TemplateNode:
+		collectVariables(n.Pipe, root, seen)
+	}
+}
+
+// Render produit l'objet, le corps et la version texte personnalisés pour un destinataire
+func (t *EmailTemplate) Render(data models.EmailData) (*RenderedEmail, error) {
+	vars := recipientVars(data)
+
+	var subject bytes.Buffer
+	if err := t.subject.Execute(&subject, vars); err != nil {
+		return nil, fmt.Errorf("objet: %v", err)
+	}
+
+	var body bytes.Buffer
+	if err := t.body.Execute(&body, vars); err != nil {
+		return nil, fmt.Errorf("corps: %v", err)
+	}
+
+	// L'objet et la version texte ne sont pas du HTML : on retire l'échappement
+	rendered := &RenderedEmail{
+		Subject: html.UnescapeString(subject.String()),
+		HTML:    body.String(),
+	}
+
+	if t.text != nil {
+		var text bytes.Buffer
+		if err := t.text.Execute(&text, vars); err != nil {
+			return nil, fmt.Errorf("version texte: %v", err)
+		}
+		rendered.Text = html.UnescapeString(text.String())
+	}
+
+	return rendered, nil
+}
+
+// recipientVars construit les variables disponibles dans les templates :
+// l'email et toutes les colonnes importées du CSV (prenom, entreprise...)
+func recipientVars(data models.EmailData) map[string]interface{} {
+	vars := make(map[string]interface{}, len(data.Fields)+1)
+	for key, value := range data.Fields {
+		vars[key] = value
+	}
+	vars["email"] = data.Email
+	return vars
+}
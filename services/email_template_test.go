@@ -0,0 +1,119 @@
+package services
+
+import (
+	"bulk-email-mailgun/models"
+	"strings"
+	"testing"
+)
+
+func TestRenderEmailTemplate(t *testing.T) {
+	tmpl, err := ParseEmailTemplate(
+		`Bonjour {{.prenom | default "ami"}} & bienvenue`,
+		`<p>Bonjour {{.prenom | default "ami" | title}}, votre adresse : {{email}}</p>{{if .entreprise}}<p>{{.entreprise | upper}}</p>{{end}}`,
+		`Bonjour {{.prenom}} <{{.email}}>`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		data models.EmailData
+		want RenderedEmail
+	}{
+		{
+			"attributs renseignés",
+			models.EmailData{Email: "jean@exemple.fr", Fields: map[string]string{"prenom": "jean", "entreprise": "Acme"}},
+			RenderedEmail{
+				Subject: "Bonjour jean & bienvenue",
+				HTML:    "<p>Bonjour Jean, votre adresse : jean@exemple.fr</p><p>ACME</p>",
+				Text:    "Bonjour jean <jean@exemple.fr>",
+			},
+		},
+		{
+			"échappement et attribut manquant",
+			models.EmailData{Email: "paul@exemple.fr", Fields: map[string]string{"prenom": "<b>Paul</b>"}},
+			RenderedEmail{
+				Subject: "Bonjour <b>Paul</b> & bienvenue",
+				HTML:    "<p>Bonjour &lt;b&gt;paul&lt;/b&gt;, votre adresse : paul@exemple.fr</p>",
+				Text:    "Bonjour <b>Paul</b> <paul@exemple.fr>",
+			},
+		},
+		{
+			"valeur par défaut",
+			models.EmailData{Email: "anne@exemple.fr"},
+			RenderedEmail{
+				Subject: "Bonjour ami & bienvenue",
+				HTML:    "<p>Bonjour Ami, votre adresse : anne@exemple.fr</p>",
+				Text:    "Bonjour  <anne@exemple.fr>",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := tmpl.Render(c.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != c.want {
+				t.Errorf("Render =\n%+v\nattendu\n%+v", *got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseEmailTemplateErrors(t *testing.T) {
+	cases := []struct {
+		name                string
+		subject, body, text string
+		err                 string
+	}{
+		{"objet", "Bonjour {{.prenom", "<p></p>", "", "objet invalide"},
+		{"corps", "Bonjour", "{{if .prenom}}", "", "corps invalide"},
+		{"version texte", "Bonjour", "<p></p>", "{{.prenom | inconnue}}", "version texte invalide"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseEmailTemplate(c.subject, c.body, c.text)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("erreur = %v, attendu %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestValidateEmailTemplate(t *testing.T) {
+	recipients := []models.EmailData{
+		{Email: "jean@exemple.fr", Fields: map[string]string{"first_name": "Jean"}},
+		{Email: "paul@exemple.fr", Fields: map[string]string{"first_name": "Paul", "city": "Lyon"}},
+	}
+
+	cases := []struct {
+		name                string
+		subject, body, text string
+		err                 string
+	}{
+		{"variables connues", "Bonjour {{.first_name}}", `<p>{{.city | default "?"}} {{.email}}</p><a href="{{.preferences_url}}">Préférences</a>`, "", ""},
+		{"faute dans l'objet", "Bonjour {{.Fisrt_name}}", "<p></p>", "", "variable inconnue {{.Fisrt_name}}"},
+		{"faute dans le corps", "Bonjour", `<p>{{.fisrt_name | default "ami"}}</p>`, "", "variable inconnue {{.fisrt_name}}"},
+		{"faute dans la version texte", "Bonjour", "<p></p>", "{{if .citty}}{{.city}}{{end}}", "variable inconnue {{.citty}}"},
+		{"casse différente", "Bonjour {{.First_name}}", "<p></p>", "", "variable inconnue {{.First_name}}"},
+		{"point redéfini par with", "Bonjour", `{{with .city}}<p>{{.}}</p>{{end}}`, "", ""},
+		{"variable racine dans with", "Bonjour", `{{with .city}}<p>{{$.fisrt_name}}</p>{{end}}`, "", "variable inconnue {{.fisrt_name}}"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := ValidateEmailTemplate(c.subject, c.body, c.text, recipients)
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("erreur inattendue : %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("erreur = %v, attendu %q", err, c.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ExportWriter écrit un tableau ligne par ligne au fil de l'eau
+type ExportWriter interface {
+	Write(values ...interface{}) error
+	// Close termine le fichier ; en XLSX le classeur n'est transmis qu'à ce moment
+	Close() error
+}
+
+// SheetWriter est un ExportWriter capable d'ouvrir une nouvelle feuille (XLSX)
+type SheetWriter interface {
+	ExportWriter
+	NewSheet(name string) error
+}
+
+// NewExportWriter crée un writer CSV ou XLSX vers out ; sheet nomme la première feuille XLSX
+func NewExportWriter(format string, out io.Writer, sheet string) (ExportWriter, error) {
+	switch format {
+	case FormatCSV:
+		// BOM pour qu'Excel lise les accents en UTF-8
+		if _, err := out.Write(utf8BOM); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{w: csv.NewWriter(out)}, nil
+	case FormatXLSX:
+		book := excelize.NewFile()
+		if err := book.SetSheetName(book.GetSheetName(0), sheet); err != nil {
+			book.Close()
+			return nil, err
+		}
+		stream, err := book.NewStreamWriter(sheet)
+		if err != nil {
+			book.Close()
+			return nil, err
+		}
+		return &xlsxExportWriter{book: book, stream: stream, out: out}, nil
+	}
+	return nil, fmt.Errorf("format d'export non supporté: %s", format)
+}
+
+// ExportContentType retourne le type MIME d'un format d'export
+func ExportContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// exportTimeLayout est le format des dates dans les exports
+const exportTimeLayout = "2006-01-02 15:04:05"
+
+// --- CSV ---
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) Write(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		switch v := value.(type) {
+		case time.Time:
+			record[i] = v.UTC().Format(exportTimeLayout)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// --- XLSX ---
+
+// xlsxExportWriter écrit les lignes via le StreamWriter d'excelize, qui les
+// garde dans un fichier temporaire ; seul le classeur compressé final est
+// assemblé en mémoire à la fermeture
+type xlsxExportWriter struct {
+	book   *excelize.File
+	stream *excelize.StreamWriter
+	out    io.Writer
+	row    int
+}
+
+func (x *xlsxExportWriter) Write(values ...interface{}) error {
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	for i, value := range values {
+		if t, ok := value.(time.Time); ok {
+			values[i] = t.UTC().Format(exportTimeLayout)
+		}
+	}
+	return x.stream.SetRow(cell, values)
+}
+
+func (x *xlsxExportWriter) NewSheet(name string) error {
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	if _, err := x.book.NewSheet(name); err != nil {
+		return err
+	}
+	stream, err := x.book.NewStreamWriter(name)
+	if err != nil {
+		return err
+	}
+	x.stream, x.row = stream, 0
+	return nil
+}
+
+func (x *xlsxExportWriter) Close() error {
+	defer x.book.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	_, err := x.book.WriteTo(x.out)
+	return err
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// healthCheckTimeout borne chaque vérification de disponibilité
+const healthCheckTimeout = 2 * time.Second
+
+// HealthCheck est le résultat d'une vérification de disponibilité
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"` // "ok" ou "failed"
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport est la réponse de /readyz
+type HealthReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthService évalue si l'instance peut recevoir du trafic
+type HealthService struct {
+	dataDirs     []string
+	shuttingDown atomic.Bool
+}
+
+// NewHealthService vérifiera l'écriture dans chacun des répertoires de données
+func NewHealthService(dataDirs ...string) *HealthService {
+	return &HealthService{dataDirs: dataDirs}
+}
+
+// SetShuttingDown marque l'instance comme en cours d'arrêt : elle n'est plus prête
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+// Readiness vérifie la base, les répertoires de données et la configuration du provider
+func (s *HealthService) Readiness(ctx context.Context) HealthReport {
+	if s.shuttingDown.Load() {
+		return HealthReport{Ready: false, Checks: []HealthCheck{{Name: "shutdown", Status: "failed", Error: "arrêt en cours"}}}
+	}
+
+	report := HealthReport{Ready: true}
+	add := func(name string, err error) {
+		check := HealthCheck{Name: name, Status: "ok"}
+		if err != nil {
+			check.Status, check.Error = "failed", err.Error()
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	add("database", database.Ping(ctx))
+
+	for _, dir := range s.dataDirs {
+		add("data_dir:"+dir, checkWritable(dir))
+	}
+
+	add("provider", CheckProviderConfig(config.AppConfig.Provider))
+	return report
+}
+
+// checkWritable crée puis supprime un fichier temporaire dans dir
+func checkWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// CheckProviderConfig vérifie que les identifiants du provider sont configurés
+func CheckProviderConfig(provider string) error {
+	switch provider {
+	case "mailgun":
+		if config.AppConfig.MailgunDomain == "" || config.AppConfig.MailgunAPIKey == "" {
+			return fmt.Errorf("Mailgun not configured")
+		}
+	case "resend":
+		if config.AppConfig.ResendAPIKey == "" {
+			return fmt.Errorf("Resend not configured")
+		}
+	case "gmail":
+		if config.AppConfig.Email == "" || config.AppConfig.Password == "" {
+			return fmt.Errorf("Gmail not configured")
+		}
+	default:
+		return fmt.Errorf("provider inconnu: %s", provider)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	whitespacePattern = regexp.MustCompile(`\s+`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// HTMLToText génère la version texte d'un email HTML : titres soulignés,
+// listes à puces ou numérotées, et liens reportés en notes de bas de page
+func HTMLToText(src string) string {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return src
+	}
+
+	tw := &textWriter{}
+	tw.walk(doc)
+
+	text := tw.sb.String()
+
+	// Nettoyer les espaces en fin de ligne et les lignes vides en trop
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	text = strings.TrimSpace(text)
+
+	if len(tw.links) > 0 {
+		var notes strings.Builder
+		for i, link := range tw.links {
+			fmt.Fprintf(&notes, "[%d] %s\n", i+1, link)
+		}
+		text += "\n\n" + strings.TrimRight(notes.String(), "\n")
+	}
+
+	return text
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+type textWriter struct {
+	sb    strings.Builder
+	links []string
+	lists []listState
+	pre   int
+}
+
+func (tw *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		tw.writeText(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			tw.walk(c)
+		}
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Script, atom.Style, atom.Title:
+		return
+
+	case atom.Br:
+		tw.sb.WriteString("\n")
+		return
+
+	case atom.Hr:
+		tw.newlines(2)
+		tw.sb.WriteString(strings.Repeat("-", 40))
+		tw.newlines(2)
+		return
+
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			tw.writeText(alt)
+		}
+		return
+
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		tw.newlines(2)
+		start := tw.sb.Len()
+		tw.children(n)
+		title := strings.TrimSpace(tw.sb.String()[start:])
+		underline := "-"
+		if n.DataAtom == atom.H1 {
+			underline = "="
+		}
+		if n.DataAtom == atom.H1 || n.DataAtom == atom.H2 {
+			tw.sb.WriteString("\n" + strings.Repeat(underline, len([]rune(title))))
+		}
+		tw.newlines(2)
+		return
+
+	case atom.Ul, atom.Ol:
+		tw.newlines(1)
+		tw.lists = append(tw.lists, listState{ordered: n.DataAtom == atom.Ol})
+		tw.children(n)
+		tw.lists = tw.lists[:len(tw.lists)-1]
+		tw.newlines(1)
+		return
+
+	case atom.Li:
+		tw.newlines(1)
+		marker := "- "
+		depth := len(tw.lists)
+		if depth > 0 {
+			list := &tw.lists[depth-1]
+			list.index++
+			if list.ordered {
+				marker = fmt.Sprintf("%d. ", list.index)
+			}
+			tw.sb.WriteString(strings.Repeat("  ", depth-1))
+		}
+		tw.sb.WriteString(marker)
+		tw.children(n)
+		tw.newlines(1)
+		return
+
+	case atom.A:
+		href := strings.TrimSpace(attr(n, "href"))
+		start := tw.sb.Len()
+		tw.children(n)
+		label := strings.TrimSpace(tw.sb.String()[start:])
+
+		switch {
+		case href == "" || strings.HasPrefix(href, "#"):
+		case strings.HasPrefix(href, "mailto:"):
+			address := strings.TrimPrefix(href, "mailto:")
+			if label != address {
+				tw.sb.WriteString(" <" + address + ">")
+			}
+		case label == "" || label == href:
+			if label == "" {
+				tw.sb.WriteString(href)
+			}
+		default:
+			fmt.Fprintf(&tw.sb, " [%d]", tw.footnote(href))
+		}
+		return
+
+	case atom.Pre:
+		tw.newlines(2)
+		tw.pre++
+		tw.children(n)
+		tw.pre--
+		tw.newlines(2)
+		return
+
+	case atom.P, atom.Div, atom.Table, atom.Blockquote, atom.Section, atom.Article,
+		atom.Header, atom.Footer:
+		tw.newlines(2)
+		tw.children(n)
+		tw.newlines(2)
+		return
+
+	case atom.Tr:
+		tw.newlines(1)
+		tw.children(n)
+		tw.newlines(1)
+		return
+
+	case atom.Td, atom.Th:
+		if !tw.atLineStart() {
+			tw.sb.WriteString(" ")
+		}
+		tw.children(n)
+		return
+	}
+
+	tw.children(n)
+}
+
+// footnote retourne le numéro de note du lien, un même lien répété gardant sa première note
+func (tw *textWriter) footnote(href string) int {
+	for i, link := range tw.links {
+		if link == href {
+			return i + 1
+		}
+	}
+	tw.links = append(tw.links, href)
+	return len(tw.links)
+}
+
+func (tw *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		tw.walk(c)
+	}
+}
+
+func (tw *textWriter) writeText(s string) {
+	if tw.pre > 0 {
+		tw.sb.WriteString(s)
+		return
+	}
+
+	s = whitespacePattern.ReplaceAllString(s, " ")
+	if tw.atLineStart() || strings.HasSuffix(tw.sb.String(), " ") {
+		s = strings.TrimLeft(s, " ")
+	}
+	tw.sb.WriteString(s)
+}
+
+// newlines garantit que la sortie se termine par au moins n retours à la ligne
+func (tw *textWriter) newlines(n int) {
+	if tw.sb.Len() == 0 {
+		return
+	}
+	current := tw.sb.String()
+	existing := len(current) - len(strings.TrimRight(current, "\n"))
+	for i := existing; i < n; i++ {
+		tw.sb.WriteString("\n")
+	}
+}
+
+func (tw *textWriter) atLineStart() bool {
+	return tw.sb.Len() == 0 || strings.HasSuffix(tw.sb.String(), "\n")
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,64 @@
+package services
+
+import "testing"
+
+func TestHTMLToText(t *testing.T) {
+	cases := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"vide", ``, ``},
+		{"texte brut", "texte   brut\n ligne", "texte brut ligne"},
+
+		// Liens en notes de bas de page
+		{
+			"notes de bas de page",
+			`<p>Voir <a href="https://exemple.fr/a">notre offre</a> et <a href="https://exemple.fr/b">le blog</a>.</p>`,
+			"Voir notre offre [1] et le blog [2].\n\n[1] https://exemple.fr/a\n[2] https://exemple.fr/b",
+		},
+		{
+			"lien répété",
+			`<a href="https://exemple.fr/a">Un</a>, <a href="https://exemple.fr/b">Deux</a>, <a href="https://exemple.fr/a">Un encore</a>`,
+			"Un [1], Deux [2], Un encore [1]\n\n[1] https://exemple.fr/a\n[2] https://exemple.fr/b",
+		},
+		{"libellé égal à l'URL", `<a href="https://exemple.fr">https://exemple.fr</a>`, "https://exemple.fr"},
+		{"lien sans libellé", `<a href="https://exemple.fr"></a>`, "https://exemple.fr"},
+		{"mailto", `<a href="mailto:jean@exemple.fr">Écrire</a>`, "Écrire <jean@exemple.fr>"},
+		{"mailto affiché", `<a href="mailto:jean@exemple.fr">jean@exemple.fr</a>`, "jean@exemple.fr"},
+		{"ancre", `<a href="#haut">Haut</a>`, "Haut"},
+
+		// Listes
+		{"liste à puces", `<ul><li>Un</li><li>Deux</li></ul>`, "- Un\n- Deux"},
+		{"liste numérotée", `<ol><li>Un</li><li>Deux</li><li>Trois</li></ol>`, "1. Un\n2. Deux\n3. Trois"},
+		{
+			"listes imbriquées",
+			`<ul><li>Un</li><li>Deux<ol><li>A</li><li>B</li></ol></li><li>Trois</li></ul>`,
+			"- Un\n- Deux\n  1. A\n  2. B\n- Trois",
+		},
+		{"liste après paragraphe", `<p>Menu :</p><ul><li>Entrée</li></ul>`, "Menu :\n\n- Entrée"},
+
+		// Entités
+		{"entités nommées", `<p>Caf&eacute; &amp; cr&egrave;me</p>`, "Café & crème"},
+		{"balises échappées", `<p>&lt;b&gt;gras&lt;/b&gt;</p>`, "<b>gras</b>"},
+		{"entités numériques", `<p>&#8364; &#x20AC; &euro;</p>`, "€ € €"},
+		{"espace insécable conservé", `<p>10&nbsp;€</p>`, "10\u00a0€"},
+		{"entité dans un lien", `<a href="https://exemple.fr/?a=1&amp;b=2">Offre</a>`, "Offre [1]\n\n[1] https://exemple.fr/?a=1&b=2"},
+
+		// Structure
+		{"titres", `<h1>Titre</h1><h2>Été</h2><h3>Petit</h3><p>x</p>`, "Titre\n=====\n\nÉté\n---\n\nPetit\n\nx"},
+		{"head, script et style ignorés", `<html><head><title>T</title><style>p{}</style></head><body><script>x()</script><p>a</p></body></html>`, "a"},
+		{"saut de ligne", `<p>a<br>b</p>`, "a\nb"},
+		{"image", `<p><img src="logo.png" alt="Logo"><img src="pixel.gif" alt=""></p>`, "Logo"},
+		{"texte préformaté", "<pre>  code\n  ici</pre>", "code\n  ici"},
+		{"tableau", `<table><tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr></table>`, "a b\nc d"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := HTMLToText(c.html); got != c.want {
+				t.Errorf("HTMLToText(%q) =\n%q\nattendu\n%q", c.html, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package services
+
+import (
+	"bufio"
+	"bulk-email-mailgun/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Formats d'import reconnus
+const (
+	FormatCSV   = "csv"
+	FormatXLSX  = "xlsx"
+	FormatJSON  = "json"
+	FormatVCard = "vcard"
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// recordSource lit les lignes d'un fichier importé sous forme colonne -> valeur
+type recordSource interface {
+	// Columns retourne les colonnes connues ; en JSON la liste peut s'allonger
+	Columns() []string
+	// Next retourne la ligne suivante et son numéro dans le fichier, ou io.EOF
+	Next() (map[string]string, int, error)
+	Close() error
+}
+
+// DetectFormat devine le format d'un fichier d'après son contenu puis son extension
+func DetectFormat(filename string, head []byte) string {
+	head = bytes.TrimPrefix(head, utf8BOM)
+	trimmed := bytes.TrimLeft(head, " \t\r\n")
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return FormatXLSX
+	case bytes.HasPrefix(trimmed, []byte("[")), bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatJSON
+	case len(trimmed) >= 11 && strings.EqualFold(string(trimmed[:11]), "BEGIN:VCARD"):
+		return FormatVCard
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return FormatXLSX
+	case ".json", ".ndjson", ".jsonl":
+		return FormatJSON
+	case ".vcf", ".vcard":
+		return FormatVCard
+	}
+	return FormatCSV
+}
+
+// openSource ouvre le fichier selon opts et complète les réglages détectés
+// (format, séparateur, encodage)
+func openSource(path, filename string, opts *models.ImportOptions) (recordSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(file, 64<<10)
+	head, _ := br.Peek(64 << 10)
+
+	if opts.Format == "" {
+		opts.Format = DetectFormat(filename, head)
+	}
+
+	var source recordSource
+	switch opts.Format {
+	case FormatCSV:
+		source, err = newCSVSource(file, br, head, opts)
+	case FormatXLSX:
+		file.Close()
+		source, err = newXLSXSource(path, opts)
+	case FormatJSON:
+		source, err = newJSONSource(file, br)
+	case FormatVCard:
+		source, err = newVCardSource(file, br)
+	default:
+		err = fmt.Errorf("format non supporté: %s", opts.Format)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return source, nil
+}
+
+// columnNames nomme les colonnes d'un fichier tabulaire, d'après l'en-tête ou
+// par position (column_1, column_2...) ; les noms en double sont suffixés
+func columnNames(header []string, count int) []string {
+	names := make([]string, 0, count)
+	seen := map[string]int{}
+	for i := 0; i < count; i++ {
+		name := ""
+		if i < len(header) {
+			name = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+		}
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		seen[name]++
+		if seen[name] > 1 {
+			name += "_" + strconv.Itoa(seen[name])
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func toRecord(columns []string, values []string) map[string]string {
+	record := make(map[string]string, len(values))
+	for i, value := range values {
+		if i < len(columns) {
+			record[columns[i]] = value
+		} else {
+			record["column_"+strconv.Itoa(i+1)] = value
+		}
+	}
+	return record
+}
+
+// --- CSV ---
+
+type csvSource struct {
+	file    io.Closer
+	reader  *csv.Reader
+	columns []string
+	pending []string // première ligne de données quand le fichier n'a pas d'en-tête
+	line    int
+}
+
+func newCSVSource(file *os.File, br *bufio.Reader, head []byte, opts *models.ImportOptions) (recordSource, error) {
+	var input io.Reader = br
+
+	if opts.Encoding == "" {
+		opts.Encoding = detectEncoding(head)
+	}
+	switch strings.ToLower(opts.Encoding) {
+	case "utf-8", "utf8":
+		if bytes.HasPrefix(head, utf8BOM) {
+			br.Discard(len(utf8BOM))
+		}
+	case "latin-1", "latin1", "iso-8859-1":
+		input = transform.NewReader(br, charmap.ISO8859_1.NewDecoder())
+	case "windows-1252", "cp1252":
+		input = transform.NewReader(br, charmap.Windows1252.NewDecoder())
+	default:
+		return nil, fmt.Errorf("encodage non supporté: %s", opts.Encoding)
+	}
+
+	if opts.Delimiter == "" {
+		opts.Delimiter = detectDelimiter(head)
+	}
+	delimiter, size := utf8.DecodeRuneInString(opts.Delimiter)
+	if opts.Delimiter == `\t` {
+		delimiter, size = '\t', 2
+	}
+	if size != len(opts.Delimiter) {
+		return nil, fmt.Errorf("séparateur invalide: %q", opts.Delimiter)
+	}
+
+	reader := csv.NewReader(input)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	s := &csvSource{file: file, reader: reader}
+	first, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("fichier vide")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("CSV read error: %v", err)
+	}
+
+	if opts.NoHeader {
+		s.columns = columnNames(nil, len(first))
+		s.pending = first
+		s.line, _ = reader.FieldPos(0)
+	} else {
+		s.columns = columnNames(first, len(first))
+	}
+	return s, nil
+}
+
+func (s *csvSource) Columns() []string { return s.columns }
+
+func (s *csvSource) Next() (map[string]string, int, error) {
+	if s.pending != nil {
+		record := toRecord(s.columns, s.pending)
+		s.pending = nil
+		return record, s.line, nil
+	}
+
+	values, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("CSV read error: %v", err)
+	}
+	line, _ := s.reader.FieldPos(0)
+	return toRecord(s.columns, values), line, nil
+}
+
+func (s *csvSource) Close() error { return s.file.Close() }
+
+// detectEncoding choisit UTF-8 si le début du fichier est valide, sinon Windows-1252
+// (export Excel "CSV" le plus courant, compatible Latin-1)
+func detectEncoding(head []byte) string {
+	if bytes.HasPrefix(head, utf8BOM) {
+		return "utf-8"
+	}
+	// Ignorer un caractère multi-octets coupé en fin de tampon
+	for i := 0; i < utf8.UTFMax && len(head) > 0; i++ {
+		if r, _ := utf8.DecodeLastRune(head); r != utf8.RuneError {
+			break
+		}
+		head = head[:len(head)-1]
+	}
+	if utf8.Valid(head) {
+		return "utf-8"
+	}
+	return "windows-1252"
+}
+
+// detectDelimiter retient le séparateur le plus fréquent de la première ligne
+func detectDelimiter(head []byte) string {
+	line := head
+	if i := bytes.IndexByte(head, '\n'); i >= 0 {
+		line = head[:i]
+	}
+
+	best, bestCount := ",", 0
+	for _, candidate := range []string{",", ";", "\t", "|"} {
+		if count := bytes.Count(line, []byte(candidate)); count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+// --- XLSX ---
+
+type xlsxSource struct {
+	book    *excelize.File
+	rows    *excelize.Rows
+	columns []string
+	pending []string
+	line    int
+}
+
+func newXLSXSource(path string, opts *models.ImportOptions) (recordSource, error) {
+	book, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("XLSX invalide: %v", err)
+	}
+
+	sheet := opts.Sheet
+	if sheet == "" {
+		sheet = book.GetSheetName(0)
+		opts.Sheet = sheet
+	}
+	rows, err := book.Rows(sheet)
+	if err != nil {
+		book.Close()
+		return nil, fmt.Errorf("feuille %q introuvable", sheet)
+	}
+
+	s := &xlsxSource{book: book, rows: rows}
+	first, err := s.nextRow()
+	if err != nil {
+		s.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("feuille vide")
+		}
+		return nil, err
+	}
+
+	if opts.NoHeader {
+		s.columns = columnNames(nil, len(first))
+		s.pending = first
+	} else {
+		s.columns = columnNames(first, len(first))
+	}
+	return s, nil
+}
+
+// nextRow retourne la ligne non vide suivante
+func (s *xlsxSource) nextRow() ([]string, error) {
+	for s.rows.Next() {
+		s.line++
+		values, err := s.rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(strings.Join(values, "")) != "" {
+			return values, nil
+		}
+	}
+	if err := s.rows.Error(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *xlsxSource) Columns() []string { return s.columns }
+
+func (s *xlsxSource) Next() (map[string]string, int, error) {
+	if s.pending != nil {
+		record := toRecord(s.columns, s.pending)
+		s.pending = nil
+		return record, s.line, nil
+	}
+
+	values, err := s.nextRow()
+	if err != nil {
+		return nil, 0, err
+	}
+	return toRecord(s.columns, values), s.line, nil
+}
+
+func (s *xlsxSource) Close() error {
+	s.rows.Close()
+	return s.book.Close()
+}
+
+// --- JSON (tableau d'objets ou NDJSON) ---
+
+type jsonSource struct {
+	file    io.Closer
+	decoder *json.Decoder
+	array   bool
+	columns []string
+	known   map[string]bool
+	index   int
+}
+
+func newJSONSource(file *os.File, br *bufio.Reader) (recordSource, error) {
+	if head, _ := br.Peek(len(utf8BOM)); bytes.Equal(head, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	s := &jsonSource{file: file, decoder: json.NewDecoder(br), known: map[string]bool{}}
+	s.decoder.UseNumber()
+
+	// Un tableau JSON commence par "[", sinon chaque objet est lu à la suite (NDJSON)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, fmt.Errorf("fichier vide")
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.Discard(1)
+			continue
+		}
+		if b[0] == '[' {
+			s.array = true
+			s.decoder.Token()
+		}
+		break
+	}
+	return s, nil
+}
+
+func (s *jsonSource) Columns() []string { return s.columns }
+
+func (s *jsonSource) Next() (map[string]string, int, error) {
+	if s.array && !s.decoder.More() {
+		return nil, 0, io.EOF
+	}
+
+	var object map[string]interface{}
+	if err := s.decoder.Decode(&object); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, fmt.Errorf("JSON invalide (élément %d): %v", s.index+1, err)
+	}
+	s.index++
+
+	record := make(map[string]string, len(object))
+	for key, value := range object {
+		if !s.known[key] {
+			s.known[key] = true
+			s.columns = append(s.columns, key)
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			record[key] = v
+		case json.Number:
+			record[key] = v.String()
+		case bool:
+			record[key] = strconv.FormatBool(v)
+		default:
+			encoded, _ := json.Marshal(v)
+			record[key] = string(encoded)
+		}
+	}
+	return record, s.index, nil
+}
+
+func (s *jsonSource) Close() error { return s.file.Close() }
+
+// --- vCard ---
+
+// vcardColumns sont les champs extraits de chaque fiche vCard
+var vcardColumns = []string{"email", "name", "first_name", "last_name", "company", "title", "phone"}
+
+type vcardSource struct {
+	file    io.Closer
+	scanner *bufio.Scanner
+	line    int
+	next    string // ligne lue en avance pour le dépliage des lignes
+	hasNext bool
+}
+
+func newVCardSource(file *os.File, br *bufio.Reader) (recordSource, error) {
+	scanner := bufio.NewScanner(br)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	return &vcardSource{file: file, scanner: scanner}, nil
+}
+
+func (s *vcardSource) Columns() []string { return vcardColumns }
+
+// logicalLine retourne la prochaine ligne dépliée (RFC 6350 §3.2) et son numéro
+func (s *vcardSource) logicalLine() (string, int, bool) {
+	if !s.hasNext {
+		if !s.scanner.Scan() {
+			return "", 0, false
+		}
+		s.line++
+		s.next = s.scanner.Text()
+	}
+
+	current, start := strings.TrimPrefix(s.next, "\ufeff"), s.line
+	s.hasNext = false
+	for s.scanner.Scan() {
+		s.line++
+		text := s.scanner.Text()
+		if strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t") {
+			current += text[1:]
+			continue
+		}
+		s.next, s.hasNext = text, true
+		break
+	}
+	return strings.TrimRight(current, "\r"), start, true
+}
+
+func (s *vcardSource) Next() (map[string]string, int, error) {
+	var (
+		record map[string]string
+		start  int
+	)
+
+	for {
+		text, line, ok := s.logicalLine()
+		if !ok {
+			if err := s.scanner.Err(); err != nil {
+				return nil, 0, err
+			}
+			return nil, 0, io.EOF
+		}
+
+		colon := strings.Index(text, ":")
+		if colon < 0 {
+			continue
+		}
+		name, value := strings.ToUpper(text[:colon]), text[colon+1:]
+		params := ""
+		if i := strings.Index(name, ";"); i >= 0 {
+			name, params = name[:i], name[i:]
+		}
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:] // groupe "item1.EMAIL"
+		}
+
+		switch name {
+		case "BEGIN":
+			record, start = map[string]string{}, line
+		case "END":
+			if record != nil {
+				return record, start, nil
+			}
+		case "EMAIL":
+			// Garder la première adresse, ou celle marquée comme préférée
+			if record != nil && (record["email"] == "" || strings.Contains(params, "PREF")) {
+				record["email"] = vcardUnescape(value)
+			}
+		case "FN":
+			if record != nil {
+				record["name"] = vcardUnescape(value)
+			}
+		case "N":
+			if record != nil {
+				parts := strings.Split(value, ";")
+				record["last_name"] = vcardUnescape(parts[0])
+				if len(parts) > 1 {
+					record["first_name"] = vcardUnescape(parts[1])
+				}
+			}
+		case "ORG":
+			if record != nil {
+				record["company"] = vcardUnescape(strings.Split(value, ";")[0])
+			}
+		case "TITLE":
+			if record != nil {
+				record["title"] = vcardUnescape(value)
+			}
+		case "TEL":
+			if record != nil && record["phone"] == "" {
+				record["phone"] = vcardUnescape(strings.TrimPrefix(value, "tel:"))
+			}
+		}
+	}
+}
+
+func (s *vcardSource) Close() error { return s.file.Close() }
+
+var vcardReplacer = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+
+func vcardUnescape(value string) string {
+	return strings.TrimSpace(vcardReplacer.Replace(value))
+}
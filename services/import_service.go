@@ -0,0 +1,460 @@
+package services
+
+import (
+	"bufio"
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"bulk-email-mailgun/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// importBatchSize est le nombre de lignes enregistrées par transaction
+	importBatchSize = 500
+	// importPreviewRows est le nombre de lignes affichées par l'aperçu
+	importPreviewRows = 20
+	// importDomainTimeout borne les vérifications DNS d'un lot : un serveur DNS
+	// lent ne doit pas bloquer l'import
+	importDomainTimeout = 10 * time.Second
+)
+
+// ErrImportStarted est retourné quand un import a déjà été lancé
+var ErrImportStarted = errors.New("import déjà lancé")
+
+// ImportPreview montre comment les premières lignes seront importées
+type ImportPreview struct {
+	ImportID int64                `json:"import_id"`
+	Options  models.ImportOptions `json:"options"`
+	Columns  []string             `json:"columns"`
+	Rows     []PreviewRow         `json:"rows"`
+}
+
+// PreviewRow est une ligne de l'aperçu après application du mapping
+type PreviewRow struct {
+	Line   int               `json:"line"`
+	Email  string            `json:"email"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// ImportService importe les fichiers de destinataires en arrière-plan, par lots
+type ImportService struct {
+	dir       string
+	domains   *DomainChecker
+	broadcast chan<- models.ImportProgress
+}
+
+func NewImportService(dir string, domains *DomainChecker, broadcast chan<- models.ImportProgress) *ImportService {
+	return &ImportService{dir: dir, domains: domains, broadcast: broadcast}
+}
+
+// Store enregistre le fichier téléversé et crée un import en attente
+func (s *ImportService) Store(ctx context.Context, filename string, r io.Reader, createdBy string) (int64, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return 0, err
+	}
+
+	file, err := os.CreateTemp(s.dir, "import-*")
+	if err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	format := DetectFormat(filename, head)
+
+	_, err = io.Copy(file, br)
+	file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return 0, err
+	}
+
+	id, err := database.CreateImportJob(ctx, filepath.Base(filename), format, file.Name(), createdBy)
+	if err != nil {
+		os.Remove(file.Name())
+		return 0, err
+	}
+	return id, nil
+}
+
+// Preview lit les premières lignes d'un import en attente avec les options
+// données ; les options retournées contiennent les réglages détectés et le mapping
+func (s *ImportService) Preview(ctx context.Context, id int64, opts models.ImportOptions) (*ImportPreview, error) {
+	job, err := s.pendingJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	source, sample, err := s.open(job, &opts)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	preview := &ImportPreview{ImportID: id, Options: opts, Columns: source.Columns()}
+	for _, row := range sample {
+		email, fields := applyMapping(row.record, opts.Mapping)
+		line := PreviewRow{Line: row.line, Fields: fields}
+		if address, err := NormalizeEmail(email); err != nil {
+			line.Email, line.Error = email, err.Error()
+		} else {
+			line.Email = address
+		}
+		preview.Rows = append(preview.Rows, line)
+	}
+	return preview, nil
+}
+
+// Start lance en arrière-plan un import en attente et retourne un canal
+// fermé à la fin de l'import. Le fichier stocké est alors supprimé.
+func (s *ImportService) Start(ctx context.Context, id int64, opts models.ImportOptions) (<-chan struct{}, error) {
+	job, err := s.pendingJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ListID != 0 {
+		if _, err := database.GetList(ctx, opts.ListID); err != nil {
+			return nil, fmt.Errorf("liste introuvable")
+		}
+	}
+	if opts.Tags, err = database.NormalizeTags(opts.Tags); err != nil {
+		return nil, err
+	}
+
+	source, sample, err := s.open(job, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	started, err := database.StartImportJob(ctx, id, opts.Format)
+	if err != nil || !started {
+		source.Close()
+		if err == nil {
+			err = ErrImportStarted
+		}
+		return nil, err
+	}
+
+	// L'import survit à la requête : son span lui est rattaché mais n'est pas annulé avec elle
+	ctx, span := tracer.Start(context.WithoutCancel(ctx), "import.run", trace.WithAttributes(attribute.Int64("import.id", id)))
+	logger := logging.FromContext(ctx).With("import_id", id)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer span.End()
+		defer os.Remove(job.Path)
+		defer source.Close()
+
+		status, message := "done", ""
+		if err := s.run(ctx, job, source, sample, opts); err != nil {
+			status, message = "failed", err.Error()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			logger.Error("import échoué", "error", err)
+		} else {
+			logger.Info("import terminé", "inserted", job.Inserted, "updated", job.Updated,
+				"rejected", job.Rejected, "flagged", job.Flagged)
+		}
+
+		if err := database.FinishImportJob(ctx, id, status, message); err != nil {
+			logger.Error("mise à jour du statut d'import impossible", "error", err)
+		}
+		s.progress(job, status, message)
+	}()
+
+	return done, nil
+}
+
+// RemoveAll supprime les fichiers en attente d'import (après un reset de la base)
+func (s *ImportService) RemoveAll() error {
+	return os.RemoveAll(s.dir)
+}
+
+func (s *ImportService) pendingJob(ctx context.Context, id int64) (*database.ImportJob, error) {
+	job, err := database.GetImportJob(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("import introuvable")
+	}
+	if job.Status != "pending" {
+		return nil, ErrImportStarted
+	}
+	return job, nil
+}
+
+type sampleRow struct {
+	record map[string]string
+	line   int
+}
+
+// open ouvre le fichier de l'import, lit les premières lignes et complète le
+// mapping par défaut : noms de colonnes normalisés et colonne email détectée
+func (s *ImportService) open(job *database.ImportJob, opts *models.ImportOptions) (recordSource, []sampleRow, error) {
+	if opts.Format == "" {
+		opts.Format = job.Format
+	}
+	source, err := openSource(job.Path, job.Filename, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var sample []sampleRow
+	for len(sample) < importPreviewRows {
+		record, line, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			source.Close()
+			return nil, nil, err
+		}
+		sample = append(sample, sampleRow{record: record, line: line})
+	}
+
+	mapping := defaultMapping(source.Columns(), sample)
+	for column, target := range opts.Mapping {
+		if target == "email" {
+			// Une seule colonne email : celle choisie remplace celle détectée
+			for c, t := range mapping {
+				if t == "email" {
+					mapping[c] = "email_2"
+				}
+			}
+		}
+		mapping[column] = normalizeColumnName(target)
+	}
+	opts.Mapping = mapping
+
+	return source, sample, nil
+}
+
+func (s *ImportService) run(ctx context.Context, job *database.ImportJob, source recordSource, sample []sampleRow, opts models.ImportOptions) error {
+	var (
+		rows   []database.ImportRow
+		issues []database.ImportIssue
+	)
+	seen := map[string]int{}
+
+	reject := func(line int, email, reason string) {
+		issues = append(issues, database.ImportIssue{Line: line, Email: email, Kind: "rejected", Reason: reason})
+		job.Rejected++
+	}
+
+	flush := func() error {
+		if !opts.SkipVerify {
+			issues = append(issues, s.flagDomains(ctx, job, rows)...)
+		}
+		if err := database.ImportBatch(ctx, job, opts.ListID, rows, issues); err != nil {
+			return err
+		}
+		rows, issues = rows[:0], issues[:0]
+		s.progress(job, "running", "")
+		return nil
+	}
+
+	for {
+		if len(rows)+len(issues) >= importBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		// Les lignes lues pour l'aperçu passent en premier
+		var (
+			record map[string]string
+			line   int
+			err    error
+		)
+		if len(sample) > 0 {
+			record, line = sample[0].record, sample[0].line
+			sample = sample[1:]
+		} else if record, line, err = source.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		job.Processed++
+
+		raw, attributes := applyMapping(record, opts.Mapping)
+		address, err := NormalizeEmail(raw)
+		if err != nil {
+			reject(line, raw, err.Error())
+			continue
+		}
+
+		key := EmailKey(address)
+		if first, ok := seen[key]; ok {
+			reject(line, raw, fmt.Sprintf("doublon de la ligne %d", first))
+			continue
+		}
+		seen[key] = line
+
+		// Une colonne "tags" (séparés par des virgules ou points-virgules) s'ajoute aux tags de l'import
+		tags, err := database.NormalizeTags(append(splitTags(attributes["tags"]), opts.Tags...))
+		if err != nil {
+			reject(line, raw, err.Error())
+			continue
+		}
+		delete(attributes, "tags")
+
+		rows = append(rows, database.ImportRow{Line: line, Email: address, Attributes: attributes, Tags: tags})
+	}
+
+	return flush()
+}
+
+// flagDomains signale les adresses d'un lot dont le domaine n'est pas
+// délivrable ou ressemble à un domaine populaire, sans les écarter de l'import. Chaque domaine distinct n'est
+// vérifié qu'une fois, en parallèle et dans la limite de importDomainTimeout.
+func (s *ImportService) flagDomains(ctx context.Context, job *database.ImportJob, rows []database.ImportRow) []database.ImportIssue {
+	var domains []string
+	seen := map[string]bool{}
+	for _, row := range rows {
+		if domain := emailDomain(row.Email); !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, importDomainTimeout)
+	defer cancel()
+	verdicts := s.domains.CheckDomains(checkCtx, domains)
+
+	var issues []database.ImportIssue
+	for _, row := range rows {
+		// Une suggestion sur un domaine valide est signalée sans bloquer l'envoi
+		verdict := verdicts[emailDomain(row.Email)]
+		if verdict.Deliverable() && verdict.Suggestion == "" {
+			continue
+		}
+		issues = append(issues, database.ImportIssue{
+			Line:       row.Line,
+			Email:      row.Email,
+			Kind:       "flagged",
+			Status:     verdict.Status,
+			Suggestion: verdict.Suggestion,
+			Reason:     verdict.Reason(),
+		})
+		job.Flagged++
+	}
+	return issues
+}
+
+// applyMapping extrait l'adresse et les attributs d'une ligne ; une colonne
+// absente du mapping (clé JSON apparue après l'aperçu) garde son nom normalisé
+func applyMapping(record map[string]string, mapping map[string]string) (string, map[string]string) {
+	var email string
+	attributes := map[string]string{}
+	for column, value := range record {
+		value = strings.TrimSpace(value)
+		target, ok := mapping[column]
+		if !ok {
+			target = normalizeColumnName(column)
+		}
+		switch {
+		case target == "email":
+			email = value
+		case target == "" || value == "":
+		default:
+			attributes[target] = value
+		}
+	}
+	return email, attributes
+}
+
+// defaultMapping associe chaque colonne à son nom normalisé et désigne la
+// colonne email d'après son nom, ou à défaut d'après son contenu
+func defaultMapping(columns []string, sample []sampleRow) map[string]string {
+	mapping := make(map[string]string, len(columns))
+	emailColumn := ""
+	for _, column := range columns {
+		name := normalizeColumnName(column)
+		if isEmailColumn(name) && emailColumn == "" {
+			emailColumn = column
+		}
+		mapping[column] = name
+	}
+
+	if emailColumn == "" {
+		best := 0
+		for _, column := range columns {
+			valid := 0
+			for _, row := range sample {
+				if _, err := NormalizeEmail(row.record[column]); err == nil {
+					valid++
+				}
+			}
+			if valid > best {
+				emailColumn, best = column, valid
+			}
+		}
+	}
+
+	for column, name := range mapping {
+		if column == emailColumn {
+			mapping[column] = "email"
+		} else if name == "email" {
+			mapping[column] = "email_2"
+		}
+	}
+	return mapping
+}
+
+// splitTags découpe une cellule "client, vip;2024" en tags
+func splitTags(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';'
+	})
+}
+
+func (s *ImportService) progress(job *database.ImportJob, status, message string) {
+	s.broadcast <- models.ImportProgress{
+		ImportID:      job.ID,
+		Status:        status,
+		ImportSummary: SummarizeImport(job),
+		Error:         message,
+	}
+}
+
+// SummarizeImport retourne les compteurs d'un import
+func SummarizeImport(job *database.ImportJob) models.ImportSummary {
+	return models.ImportSummary{
+		Processed: job.Processed,
+		Inserted:  job.Inserted,
+		Updated:   job.Updated,
+		Rejected:  job.Rejected,
+		Flagged:   job.Flagged,
+	}
+}
+
+// normalizeColumnName transforme un en-tête CSV en nom de variable de template
+// ("Prénom " -> "prénom", "Company Name" -> "company_name")
+func normalizeColumnName(name string) string {
+	name = strings.TrimPrefix(name, "\ufeff")
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func isEmailColumn(name string) bool {
+	switch name {
+	case "email", "e_mail", "mail", "courriel", "adresse_email":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/models"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImportChecksEachDomainOnce(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	resolver := &fakeResolver{mx: map[string][]*net.MX{
+		"a.fr":     {{Host: "mx.a.fr."}},
+		"b.fr":     {{Host: "mx.b.fr."}},
+		"yahoo.gr": {{Host: "mx.yahoo.gr."}},
+	}}
+	broadcast := make(chan models.ImportProgress, 100)
+	service := NewImportService(t.TempDir(), NewDomainChecker(resolver), broadcast)
+
+	// Trois lots, les mêmes domaines dans chacun
+	var csv strings.Builder
+	csv.WriteString("email,prenom\n")
+	for i := 0; i < 1200; i++ {
+		domain := []string{"a.fr", "b.fr", "sans-mx.fr", "gmial.com", "yahoo.gr"}[i%5]
+		fmt.Fprintf(&csv, "contact%d@%s,Jean\n", i, domain)
+	}
+	csv.WriteString("pas-une-adresse,Jean\n")
+	csv.WriteString("contact0@a.fr,Doublon\n")
+
+	id, err := service.Store(ctx, "contacts.csv", strings.NewReader(csv.String()), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := service.Start(ctx, id, models.ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("import non terminé")
+	}
+
+	for _, domain := range []string{"a.fr", "b.fr", "sans-mx.fr", "gmial.com", "yahoo.gr"} {
+		if got := resolver.lookupCount(domain); got != 1 {
+			t.Errorf("%s : %d requêtes MX, attendu 1", domain, got)
+		}
+	}
+
+	want := models.ImportSummary{Processed: 1202, Inserted: 1200, Rejected: 2, Flagged: 720}
+
+	// Le message de fin porte les compteurs définitifs
+	var last models.ImportProgress
+	for len(broadcast) > 0 {
+		last = <-broadcast
+	}
+	if last.Status != "done" || last.ImportSummary != want {
+		t.Errorf("dernier message %+v, attendu done %+v", last, want)
+	}
+
+	job, err := database.GetImportJob(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != "done" || SummarizeImport(job) != want {
+		t.Errorf("import %s %+v, attendu done %+v", job.Status, SummarizeImport(job), want)
+	}
+
+	issues, err := database.GetImportIssues(ctx, id, 2000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]int{}
+	for _, issue := range issues {
+		if issue.Kind == "flagged" {
+			statuses[issue.Status]++
+		}
+	}
+	if statuses[DomainNoMX] != 240 || statuses[DomainTypo] != 240 || statuses[DomainValid] != 240 {
+		t.Errorf("adresses signalées par statut : %v", statuses)
+	}
+}
+
+func TestImportSkipVerify(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	resolver := &fakeResolver{}
+	broadcast := make(chan models.ImportProgress, 10)
+	service := NewImportService(t.TempDir(), NewDomainChecker(resolver), broadcast)
+
+	id, err := service.Store(ctx, "contacts.csv", strings.NewReader("email\njean@sans-mx.fr\njean@gmial.com\n"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := service.Start(ctx, id, models.ImportOptions{SkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	job, err := database.GetImportJob(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Inserted != 2 || job.Flagged != 0 || resolver.callCount() != 0 {
+		t.Errorf("import %+v avec %d requêtes DNS, attendu 2 insérés sans vérification", SummarizeImport(job), resolver.callCount())
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Métriques des envois, exposées sur /metrics
+var (
+	emailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "axsender_emails_sent_total",
+		Help: "Destinataires traités par les campagnes, par provider et statut (sent, failed, skipped).",
+	}, []string{"provider", "status"})
+
+	providerLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "axsender_provider_request_duration_seconds",
+		Help:    "Durée des appels d'API d'envoi des providers.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10), // 50 ms à ~25 s
+	}, []string{"provider", "result"})
+
+	sendQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "axsender_send_queue_depth",
+		Help: "Destinataires des campagnes en cours pas encore traités.",
+	})
+
+	throttleWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "axsender_send_throttle_wait_seconds",
+		Help:    "Attente imposée par la limitation de débit : place de concurrence libre (concurrency) ou délai entre envois (delay).",
+		Buckets: []float64{.001, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"provider", "reason"})
+)
+
+// observeProviderCall enregistre la durée d'un appel d'API provider
+func observeProviderCall(provider string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	providerLatency.WithLabelValues(provider, result).Observe(time.Since(start).Seconds())
+}
+
+// registerClientGauge expose le nombre de clients WebSocket connectés
+func registerClientGauge(ws *WebSocketService) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "axsender_websocket_clients",
+		Help: "Clients WebSocket connectés.",
+	}, func() float64 {
+		return float64(ws.ClientCount())
+	}))
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// openToken est le contenu signé du pixel de suivi des ouvertures
+type openToken struct {
+	Purpose     string `json:"p"`
+	ContentID   int64  `json:"c"`
+	RecipientID int64  `json:"r"`
+}
+
+// AddOpenPixel ajoute au body une image invisible dont le chargement signale l'ouverture
+func (t *TrackingService) AddOpenPixel(body string, contentID, recipientID int64) string {
+	token := t.sign(openToken{Purpose: "open", ContentID: contentID, RecipientID: recipientID})
+	pixel := fmt.Sprintf(`<img src="%s/o/%s" width="1" height="1" alt="" style="display:none">`, t.baseURL, token)
+
+	// Avant </body> si présent, sinon à la fin
+	if i := strings.LastIndex(strings.ToLower(body), "</body>"); i >= 0 {
+		return body[:i] + pixel + body[i:]
+	}
+	return body + pixel
+}
+
+// VerifyOpenToken vérifie le jeton d'un pixel et retourne le contenu et le destinataire
+func (t *TrackingService) VerifyOpenToken(token string) (contentID, recipientID int64, err error) {
+	var o openToken
+	if err := t.verify(token, &o); err != nil || o.Purpose != "open" {
+		return 0, 0, ErrInvalidClickToken
+	}
+	return o.ContentID, o.RecipientID, nil
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+)
+
+// ErrInvalidPreferencesToken est retourné pour un lien de préférences invalide
+var ErrInvalidPreferencesToken = errors.New("lien de préférences invalide")
+
+// preferencesToken est le contenu signé du lien vers le centre de préférences.
+// Il n'expire pas : le lien figure dans des emails conservés par les destinataires.
+type preferencesToken struct {
+	Purpose     string `json:"p"`
+	RecipientID int64  `json:"r"`
+}
+
+// PreferencesToken signe l'accès au centre de préférences d'un destinataire
+func (t *TrackingService) PreferencesToken(recipientID int64) string {
+	return t.sign(preferencesToken{Purpose: "prefs", RecipientID: recipientID})
+}
+
+// PreferencesURL retourne le lien public vers le centre de préférences,
+// disponible dans les templates sous {{.preferences_url}}
+func (t *TrackingService) PreferencesURL(recipientID int64) string {
+	return t.baseURL + "/preferences?token=" + url.QueryEscape(t.PreferencesToken(recipientID))
+}
+
+// VerifyPreferencesToken retourne le destinataire d'un jeton de préférences
+func (t *TrackingService) VerifyPreferencesToken(token string) (int64, error) {
+	var p preferencesToken
+	if err := t.verify(token, &p); err != nil || p.Purpose != "prefs" || p.RecipientID == 0 {
+		return 0, ErrInvalidPreferencesToken
+	}
+	return p.RecipientID, nil
+}
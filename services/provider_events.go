@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// webhookTolerance est l'écart maximal accepté entre l'horodatage signé et l'heure locale
+	webhookTolerance = 5 * time.Minute
+
+	refContentVar   = "content_id"
+	refRecipientVar = "recipient_id"
+)
+
+var (
+	// ErrWebhookSignature est retourné pour un webhook non signé, mal signé ou trop ancien
+	ErrWebhookSignature = errors.New("signature de webhook invalide")
+	// ErrWebhookDisabled est retourné quand aucune clé n'est configurée pour le provider
+	ErrWebhookDisabled = errors.New("webhook non configuré")
+)
+
+// SendRef identifie un envoi auprès du provider : les webhooks la renvoient
+// (variables Mailgun, tags Resend) pour rattacher l'événement à l'envoi
+type SendRef struct {
+	ContentID   int64
+	RecipientID int64
+}
+
+func (r SendRef) values() map[string]string {
+	if r.ContentID == 0 {
+		return nil
+	}
+	return map[string]string{
+		refContentVar:   strconv.FormatInt(r.ContentID, 10),
+		refRecipientVar: strconv.FormatInt(r.RecipientID, 10),
+	}
+}
+
+func sendRefFrom(values map[string]string) (SendRef, bool) {
+	contentID, err1 := strconv.ParseInt(values[refContentVar], 10, 64)
+	recipientID, err2 := strconv.ParseInt(values[refRecipientVar], 10, 64)
+	return SendRef{ContentID: contentID, RecipientID: recipientID}, err1 == nil && err2 == nil
+}
+
+// ProviderEvent est un événement de délivrabilité reçu d'un provider
+type ProviderEvent struct {
+	Ref    SendRef
+	Type   string // database.EventDelivered, EventBounced, ...
+	Detail string
+}
+
+// ParseMailgunWebhook vérifie et décode un webhook Mailgun. Retourne nil sans
+// erreur pour un événement ignoré (ouvertures et clics sont suivis par l'application).
+func ParseMailgunWebhook(body []byte) (*ProviderEvent, error) {
+	key := config.AppConfig.MailgunWebhookKey
+	if key == "" {
+		return nil, ErrWebhookDisabled
+	}
+
+	var payload struct {
+		Signature struct {
+			Timestamp string `json:"timestamp"`
+			Token     string `json:"token"`
+			Signature string `json:"signature"`
+		} `json:"signature"`
+		EventData struct {
+			Event         string            `json:"event"`
+			Severity      string            `json:"severity"`
+			Reason        string            `json:"reason"`
+			UserVariables map[string]string `json:"user-variables"`
+		} `json:"event-data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, ErrWebhookSignature
+	}
+
+	sig := payload.Signature
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(sig.Signature)) || !recentTimestamp(sig.Timestamp) {
+		return nil, ErrWebhookSignature
+	}
+
+	data := payload.EventData
+	eventType := ""
+	switch data.Event {
+	case "delivered":
+		eventType = database.EventDelivered
+	case "failed":
+		// Les échecs temporaires seront retentés par Mailgun
+		if data.Severity == "permanent" {
+			eventType = database.EventBounced
+		}
+	case "complained":
+		eventType = database.EventComplained
+	case "unsubscribed":
+		eventType = database.EventUnsubscribed
+	}
+	ref, ok := sendRefFrom(data.UserVariables)
+	if eventType == "" || !ok {
+		return nil, nil
+	}
+	return &ProviderEvent{Ref: ref, Type: eventType, Detail: data.Reason}, nil
+}
+
+// ParseResendWebhook vérifie (signature Svix) et décode un webhook Resend.
+// Retourne nil sans erreur pour un événement ignoré.
+func ParseResendWebhook(header http.Header, body []byte) (*ProviderEvent, error) {
+	secret := config.AppConfig.ResendWebhookSecret
+	if secret == "" {
+		return nil, ErrWebhookDisabled
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+	if err != nil {
+		return nil, ErrWebhookDisabled
+	}
+	id, timestamp := header.Get("svix-id"), header.Get("svix-timestamp")
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	valid := false
+	for _, signature := range strings.Fields(header.Get("svix-signature")) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			valid = true
+		}
+	}
+	if !valid || !recentTimestamp(timestamp) {
+		return nil, ErrWebhookSignature
+	}
+
+	var payload struct {
+		Type string `json:"type"`
+		Data struct {
+			Tags   json.RawMessage `json:"tags"`
+			Bounce struct {
+				Message string `json:"message"`
+			} `json:"bounce"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	eventType := ""
+	switch payload.Type {
+	case "email.delivered":
+		eventType = database.EventDelivered
+	case "email.bounced":
+		eventType = database.EventBounced
+	case "email.complained":
+		eventType = database.EventComplained
+	}
+	ref, ok := sendRefFrom(resendTags(payload.Data.Tags))
+	if eventType == "" || !ok {
+		return nil, nil
+	}
+	return &ProviderEvent{Ref: ref, Type: eventType, Detail: payload.Data.Bounce.Message}, nil
+}
+
+// resendTags lit les tags d'un webhook Resend, sous forme d'objet ou de liste {name, value}
+func resendTags(raw json.RawMessage) map[string]string {
+	tags := map[string]string{}
+	if json.Unmarshal(raw, &tags) == nil {
+		return tags
+	}
+	var list []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	json.Unmarshal(raw, &list)
+	for _, tag := range list {
+		tags[tag.Name] = tag.Value
+	}
+	return tags
+}
+
+// recentTimestamp refuse les webhooks rejoués : l'horodatage (secondes Unix) doit être proche de l'heure locale
+func recentTimestamp(value string) bool {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	diff := time.Since(time.Unix(seconds, 0))
+	return diff < webhookTolerance && diff > -webhookTolerance
+}
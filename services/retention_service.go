@@ -0,0 +1,149 @@
+package services
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// retentionStartDelay laisse l'application démarrer avant la première purge
+const retentionStartDelay = time.Minute
+
+// RetentionService applique les règles de conservation en arrière-plan
+type RetentionService struct {
+	mu      sync.Mutex // une seule purge à la fois
+	changed chan struct{}
+}
+
+func NewRetentionService() *RetentionService {
+	return &RetentionService{changed: make(chan struct{}, 1)}
+}
+
+// Policy retourne les règles en vigueur (celles de la configuration tant
+// qu'elles n'ont pas été modifiées)
+func (s *RetentionService) Policy(ctx context.Context) (database.RetentionPolicy, error) {
+	return database.GetRetentionPolicy(ctx, database.RetentionPolicy{
+		SendsDays:           config.AppConfig.RetentionSendsDays,
+		EventsDays:          config.AppConfig.RetentionEventsDays,
+		PurgeOrphanContents: true,
+		IntervalHours:       config.AppConfig.RetentionIntervalHours,
+	})
+}
+
+// UpdatePolicy valide et enregistre de nouvelles règles ; la planification
+// est recalculée aussitôt
+func (s *RetentionService) UpdatePolicy(ctx context.Context, p database.RetentionPolicy) error {
+	if p.SendsDays < 0 || p.EventsDays < 0 {
+		return fmt.Errorf("durée de conservation invalide")
+	}
+	if p.IntervalHours < 1 {
+		return fmt.Errorf("interval_hours doit être d'au moins 1")
+	}
+	if err := database.SaveRetentionPolicy(ctx, p); err != nil {
+		return err
+	}
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start lance la purge périodique
+func (s *RetentionService) Start() {
+	go func() {
+		timer := time.NewTimer(retentionStartDelay)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				s.Run(context.Background(), "schedule")
+			case <-s.changed:
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+			}
+			timer.Reset(s.interval())
+		}
+	}()
+}
+
+// Run applique les règles et enregistre le compte rendu de la purge
+func (s *RetentionService) Run(ctx context.Context, trigger string) (*database.RetentionRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, span := tracer.Start(ctx, "retention.run", trace.WithAttributes(attribute.String("retention.trigger", trigger)))
+	defer span.End()
+
+	run := &database.RetentionRun{Trigger: trigger, StartedAt: time.Now()}
+	err := s.purge(ctx, run)
+	finished := time.Now()
+	run.FinishedAt = &finished
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		run.Error = err.Error()
+		slog.Error("purge de conservation échouée", "trigger", trigger, "error", err)
+	} else {
+		slog.Info("purge de conservation terminée", "trigger", trigger, "sends_deleted", run.SendsDeleted,
+			"events_deleted", run.EventsDeleted, "contents_deleted", run.ContentsDeleted)
+	}
+
+	if recordErr := database.CreateRetentionRun(ctx, run); recordErr != nil {
+		slog.Error("enregistrement de la purge impossible", "error", recordErr)
+	}
+	return run, err
+}
+
+func (s *RetentionService) purge(ctx context.Context, run *database.RetentionRun) error {
+	policy, err := s.Policy(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Figer les agrégats du tableau de bord avant de supprimer envois et événements
+	if policy.SendsDays > 0 || policy.EventsDays > 0 {
+		if err := database.RefreshAnalytics(ctx, 0, policy); err != nil {
+			return err
+		}
+	}
+	if policy.SendsDays > 0 {
+		if run.SendsDeleted, err = database.DeleteOldSends(ctx, policy.SendsDays); err != nil {
+			return err
+		}
+	}
+	if policy.EventsDays > 0 {
+		if run.EventsDeleted, err = database.DeleteOldEvents(ctx, policy.EventsDays); err != nil {
+			return err
+		}
+	}
+	if policy.PurgeOrphanContents {
+		if run.ContentsDeleted, err = database.DeleteOrphanContents(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interval retourne l'écart entre deux purges selon les règles en vigueur
+func (s *RetentionService) interval() time.Duration {
+	policy, err := s.Policy(context.Background())
+	if err != nil || policy.IntervalHours < 1 {
+		return 24 * time.Hour
+	}
+	return time.Duration(policy.IntervalHours) * time.Hour
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"bulk-email-mailgun/logging"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"slices"
+	"time"
+)
+
+const (
+	// confirmationTTL est la durée de validité d'un lien de confirmation
+	confirmationTTL = 7 * 24 * time.Hour
+	// confirmationCooldown espace les emails de confirmation vers une même adresse
+	confirmationCooldown = 10 * time.Minute
+	// maxSignupFields et maxSignupValue limitent les champs libres du formulaire public
+	maxSignupFields = 10
+	maxSignupValue  = 200
+	// confirmationPath est la route publique des liens de confirmation
+	confirmationPath = "/subscribe/confirm"
+)
+
+var (
+	// ErrInvalidConfirmation est retourné pour un lien de confirmation invalide ou expiré
+	ErrInvalidConfirmation = errors.New("lien de confirmation invalide ou expiré")
+	// ErrListClosed est retourné quand la liste demandée n'accepte pas d'inscription publique
+	ErrListClosed = errors.New("liste fermée aux inscriptions")
+)
+
+// SignupRequest est une demande d'inscription reçue du formulaire public
+type SignupRequest struct {
+	Email  string            `json:"email"`
+	ListID int64             `json:"list_id,omitempty"`
+	Source string            `json:"source,omitempty"` // page ou formulaire d'origine
+	Fields map[string]string `json:"fields,omitempty"`
+	IP     string            `json:"-"`
+}
+
+// confirmationToken est le contenu signé du lien de confirmation
+type confirmationToken struct {
+	Purpose     string `json:"p"`
+	RecipientID int64  `json:"r"`
+	ListID      int64  `json:"l,omitempty"`
+	Expires     int64  `json:"x"`
+}
+
+// SubscriptionService gère l'inscription publique en double opt-in :
+// la demande est enregistrée, puis confirmée par un lien signé envoyé par email
+type SubscriptionService struct {
+	tracking *TrackingService
+	emails   *EmailService
+}
+
+func NewSubscriptionService(tracking *TrackingService, emails *EmailService) *SubscriptionService {
+	return &SubscriptionService{tracking: tracking, emails: emails}
+}
+
+// Subscribe enregistre la demande et envoie l'email de confirmation.
+// Les champs libres ne sont enregistrés que pour une nouvelle adresse, seule
+// à être écartée des envois en attendant la confirmation.
+func (s *SubscriptionService) Subscribe(ctx context.Context, req SignupRequest) error {
+	address, err := NormalizeEmail(req.Email)
+	if err != nil {
+		return err
+	}
+
+	listID, err := signupList(ctx, req.ListID)
+	if err != nil {
+		return err
+	}
+
+	recipientID, err := database.CreateSignupRecipient(ctx, address, signupFields(req.Fields))
+	if err == database.ErrSuppressed {
+		// Adresse effacée à sa demande : ne jamais la recontacter, sans le révéler
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := database.RequestConsent(ctx, recipientID, req.Source, req.IP); err != nil {
+		return err
+	}
+
+	send, err := database.ReserveConfirmation(ctx, recipientID, confirmationCooldown)
+	if err != nil || !send {
+		return err
+	}
+
+	link := s.ConfirmationURL(recipientID, listID)
+	subject := "Confirmez votre inscription"
+	body := fmt.Sprintf(`<p>Bonjour,</p>
+<p>Pour confirmer votre inscription, cliquez sur le lien ci-dessous :</p>
+<p><a href="%s">Confirmer mon inscription</a></p>
+<p>Si vous n'êtes pas à l'origine de cette demande, ignorez simplement cet email.</p>`, html.EscapeString(link))
+
+	if _, err := s.emails.SendEmailWithProvider(ctx, address, subject, body, "", config.AppConfig.Provider, config.AppConfig.SubscribeSenderName, nil); err != nil {
+		database.ReleaseConfirmation(ctx, recipientID)
+		return fmt.Errorf("envoi de la confirmation: %v", err)
+	}
+	logging.FromContext(ctx).Info("confirmation d'inscription envoyée", "recipient_id", recipientID, "list_id", listID)
+	return nil
+}
+
+// ConfirmationURL construit le lien signé de confirmation
+func (s *SubscriptionService) ConfirmationURL(recipientID, listID int64) string {
+	token := s.tracking.sign(confirmationToken{
+		Purpose:     "confirm",
+		RecipientID: recipientID,
+		ListID:      listID,
+		Expires:     time.Now().Add(confirmationTTL).Unix(),
+	})
+	return s.tracking.baseURL + confirmationPath + "?token=" + url.QueryEscape(token)
+}
+
+// Confirm vérifie le lien et enregistre la confirmation
+func (s *SubscriptionService) Confirm(ctx context.Context, token string) error {
+	var t confirmationToken
+	if err := s.tracking.verify(token, &t); err != nil || t.Purpose != "confirm" || time.Now().Unix() > t.Expires {
+		return ErrInvalidConfirmation
+	}
+
+	if err := database.ConfirmConsent(ctx, t.RecipientID, t.ListID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrInvalidConfirmation
+		}
+		return err
+	}
+	logging.FromContext(ctx).Info("inscription confirmée", "recipient_id", t.RecipientID, "list_id", t.ListID)
+	return nil
+}
+
+// signupList vérifie que la liste demandée est ouverte à l'inscription ;
+// sans liste demandée, la première liste configurée est utilisée
+func signupList(ctx context.Context, listID int64) (int64, error) {
+	lists := config.AppConfig.SubscribeLists
+	if listID == 0 {
+		if len(lists) == 0 {
+			return 0, nil
+		}
+		listID = lists[0]
+	}
+	if !slices.Contains(lists, listID) {
+		return 0, ErrListClosed
+	}
+	if _, err := database.GetList(ctx, listID); err != nil {
+		return 0, ErrListClosed
+	}
+	return listID, nil
+}
+
+// signupFields garde un nombre limité de champs courts, aux noms normalisés
+func signupFields(fields map[string]string) map[string]string {
+	kept := map[string]string{}
+	for key, value := range fields {
+		key = normalizeColumnName(key)
+		if len(kept) >= maxSignupFields || key == "" || key == "email" || key == "tags" || len(value) > maxSignupValue {
+			continue
+		}
+		kept[key] = value
+	}
+	return kept
+}
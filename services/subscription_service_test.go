@@ -0,0 +1,102 @@
+package services
+
+import (
+	"bulk-email-mailgun/config"
+	"bulk-email-mailgun/database"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newTestSubscriptions branche l'inscription sur un faux Mailgun
+func newTestSubscriptions(t *testing.T) *SubscriptionService {
+	t.Helper()
+	mailgun := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"<test@example.test>","message":"Queued. Thank you."}`))
+	}))
+	t.Cleanup(mailgun.Close)
+
+	saved := config.AppConfig
+	t.Cleanup(func() { config.AppConfig = saved })
+	config.AppConfig.Provider = "mailgun"
+	config.AppConfig.MailgunDomain = "example.test"
+	config.AppConfig.MailgunAPIKey = "key-test"
+	config.AppConfig.MailgunAPIBase = mailgun.URL + "/v3"
+	config.AppConfig.SubscribeLists = nil
+
+	tracking := newTestTracking("secret")
+	emails := NewEmailService(tracking, NewAttachmentService(t.TempDir()), NewDomainChecker(&fakeResolver{}))
+	return NewSubscriptionService(tracking, emails)
+}
+
+func TestSubscribeExistingRecipient(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	subscriptions := newTestSubscriptions(t)
+
+	id, err := database.UpsertRecipient(ctx, "jean@exemple.fr", map[string]string{"prenom": "Jean"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Une inscription anonyme à l'adresse d'un destinataire importé ne change rien à ses envois
+	req := SignupRequest{Email: "Jean@exemple.fr", Source: "formulaire", Fields: map[string]string{"prenom": "<script>"}}
+	if err := subscriptions.Subscribe(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, reason, err := database.CheckSendAllowed(ctx, id, 0); err != nil || !allowed {
+		t.Errorf("envoi refusé après une inscription anonyme : %q %v", reason, err)
+	}
+	recipient, err := database.FindRecipient(ctx, "jean@exemple.fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.Attributes["prenom"] != "Jean" {
+		t.Errorf("attributs modifiés par l'inscription : %v", recipient.Attributes)
+	}
+}
+
+func TestSubscribeNewRecipient(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+	subscriptions := newTestSubscriptions(t)
+
+	if err := subscriptions.Subscribe(ctx, SignupRequest{Email: "paul@exemple.fr", Fields: map[string]string{"Prénom": "Paul"}}); err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := database.FindRecipient(ctx, "paul@exemple.fr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := int64(recipient.ID)
+	if recipient.Attributes["prénom"] != "Paul" {
+		t.Errorf("attributs %v, attendu prénom=Paul", recipient.Attributes)
+	}
+
+	// Écarté des envois jusqu'à la confirmation
+	if allowed, reason, _ := database.CheckSendAllowed(ctx, id, 0); allowed || reason != "inscription non confirmée" {
+		t.Errorf("inscription non confirmée : allowed=%v %q", allowed, reason)
+	}
+
+	link, err := url.Parse(subscriptions.ConfirmationURL(id, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := subscriptions.Confirm(ctx, link.Query().Get("token")); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, reason, _ := database.CheckSendAllowed(ctx, id, 0); !allowed {
+		t.Errorf("envoi refusé après confirmation : %q", reason)
+	}
+
+	// Une nouvelle demande après confirmation ne remet pas l'inscription en attente
+	if err := subscriptions.Subscribe(ctx, SignupRequest{Email: "paul@exemple.fr"}); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, reason, _ := database.CheckSendAllowed(ctx, id, 0); !allowed {
+		t.Errorf("envoi refusé après une nouvelle demande : %q", reason)
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import "strings"
+
+// DiffLine est une ligne du diff entre deux versions de template
+type DiffLine struct {
+	Op   string `json:"op"` // "equal", "insert" ou "delete"
+	Text string `json:"text"`
+}
+
+// maxDiffCells borne la table de plus longue sous-séquence commune (lignes
+// modifiées de from × lignes modifiées de to), soit environ 8 Mo
+const maxDiffCells = 1 << 20
+
+// DiffLines calcule un diff ligne à ligne entre deux textes (plus longue sous-séquence commune)
+func DiffLines(from, to string) []DiffLine {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	// Les lignes communes en tête et en fin sont reprises telles quelles : seule
+	// la partie modifiée passe par la table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := []DiffLine{}
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: "equal", Text: line})
+	}
+	diff = append(diff, diffChanged(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: "equal", Text: line})
+	}
+	return diff
+}
+
+// diffChanged calcule le diff de la partie modifiée. Au-delà de maxDiffCells,
+// les lignes de from sont toutes supprimées puis celles de to insérées.
+func diffChanged(a, b []string) []DiffLine {
+	var diff []DiffLine
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			diff = append(diff, DiffLine{Op: "delete", Text: line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{Op: "insert", Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i][j] = longueur de la plus longue sous-séquence commune de a[i:] et b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: "equal", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{Op: "delete", Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: "insert", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: "delete", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: "insert", Text: b[j]})
+	}
+	return diff
+}
+
+// splitLines découpe un texte en lignes : un texte vide n'a aucune ligne, et
+// les fins de ligne Windows ou un retour final ne comptent pas comme une différence
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	eq := func(s string) DiffLine { return DiffLine{Op: "equal", Text: s} }
+	ins := func(s string) DiffLine { return DiffLine{Op: "insert", Text: s} }
+	del := func(s string) DiffLine { return DiffLine{Op: "delete", Text: s} }
+
+	cases := []struct {
+		name     string
+		from, to string
+		want     []DiffLine
+	}{
+		{"deux textes vides", "", "", []DiffLine{}},
+		{"création", "", "a\nb", []DiffLine{ins("a"), ins("b")}},
+		{"suppression totale", "a\nb", "", []DiffLine{del("a"), del("b")}},
+		{"identiques", "a\nb\nc", "a\nb\nc", []DiffLine{eq("a"), eq("b"), eq("c")}},
+		{"identiques sur une ligne", "Bonjour", "Bonjour", []DiffLine{eq("Bonjour")}},
+		{"retour final", "a\nb\n", "a\nb", []DiffLine{eq("a"), eq("b")}},
+		{"fins de ligne Windows", "a\r\nb\r\n", "a\nb", []DiffLine{eq("a"), eq("b")}},
+		{"ligne vide conservée", "a\n\nb", "a\nb", []DiffLine{eq("a"), del(""), eq("b")}},
+		{"ligne modifiée", "a\nb\nc", "a\nB\nc", []DiffLine{eq("a"), del("b"), ins("B"), eq("c")}},
+		{"ajout en fin", "a", "a\nb", []DiffLine{eq("a"), ins("b")}},
+		{"ajout en tête", "b", "a\nb", []DiffLine{ins("a"), eq("b")}},
+		{"suppression au milieu", "a\nb\nc", "a\nc", []DiffLine{eq("a"), del("b"), eq("c")}},
+		{"déplacement", "a\nb\nc", "c\na\nb", []DiffLine{ins("c"), eq("a"), eq("b"), del("c")}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := DiffLines(c.from, c.to); !reflect.DeepEqual(got, c.want) {
+				t.Errorf("DiffLines(%q, %q) =\n%v\nattendu\n%v", c.from, c.to, got, c.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLargeInput(t *testing.T) {
+	var from, to strings.Builder
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&from, "ancienne %d\n", i)
+		fmt.Fprintf(&to, "nouvelle %d\n", i)
+	}
+	head, tail := "<html>\n", "</html>\n"
+
+	// 5000 × 5000 lignes modifiées dépassent maxDiffCells : pas de table, suppressions puis insertions
+	diff := DiffLines(head+from.String()+tail, head+to.String()+tail)
+	if len(diff) != 10002 {
+		t.Fatalf("%d lignes de diff, attendu 10002", len(diff))
+	}
+	if diff[0].Op != "equal" || diff[1].Op != "delete" || diff[5000].Op != "delete" ||
+		diff[5001].Op != "insert" || diff[10000].Op != "insert" || diff[10001].Op != "equal" {
+		t.Errorf("diff inattendu : %v ... %v", diff[:2], diff[len(diff)-2:])
+	}
+
+	// Un grand texte peu modifié garde un diff ligne à ligne
+	changed := strings.Replace(from.String(), "ancienne 2500\n", "modifiée 2500\n", 1)
+	diff = DiffLines(from.String(), changed)
+	if len(diff) != 5001 || diff[2500] != (DiffLine{Op: "delete", Text: "ancienne 2500"}) || diff[2501] != (DiffLine{Op: "insert", Text: "modifiée 2500"}) {
+		t.Errorf("modification isolée mal repérée : %v", diff[2499:2503])
+	}
+}
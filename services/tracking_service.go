@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bulk-email-mailgun/config"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidClickToken est retourné quand un jeton de clic est mal formé ou mal signé
+var ErrInvalidClickToken = errors.New("jeton de clic invalide")
+
+// hrefPattern repère l'attribut href des balises <a>, entre guillemets doubles ou simples
+var hrefPattern = regexp.MustCompile(`(?is)(<a\s[^>]*?\bhref\s*=\s*)("[^"]*"|'[^']*')`)
+
+// ClickTarget représente le contenu signé d'un lien de redirection
+type ClickTarget struct {
+	ContentID   int64  `json:"c"`
+	RecipientID int64  `json:"r"`
+	LinkIndex   int    `json:"i"`
+	URL         string `json:"u"`
+}
+
+type TrackingService struct {
+	secret  []byte
+	baseURL string
+}
+
+func NewTrackingService() *TrackingService {
+	secret := []byte(config.AppConfig.TrackingSecret)
+	if len(secret) == 0 {
+		// Sans secret configuré, les liens ne survivent pas à un redémarrage
+		secret = make([]byte, 32)
+		rand.Read(secret)
+		slog.Warn("TRACKING_SECRET non défini, secret aléatoire utilisé")
+	}
+
+	return &TrackingService{
+		secret:  secret,
+		baseURL: strings.TrimRight(config.AppConfig.PublicBaseURL, "/"),
+	}
+}
+
+// RewriteLinks remplace chaque lien http(s) du body par une URL de redirection signée
+func (t *TrackingService) RewriteLinks(body string, contentID, recipientID int64) string {
+	index := 0
+	return hrefPattern.ReplaceAllStringFunc(body, func(match string) string {
+		parts := hrefPattern.FindStringSubmatch(match)
+		quoted := parts[2]
+		target := html.UnescapeString(strings.TrimSpace(quoted[1 : len(quoted)-1]))
+
+		if !isTrackableURL(target) {
+			return match
+		}
+
+		token := t.Sign(ClickTarget{
+			ContentID:   contentID,
+			RecipientID: recipientID,
+			LinkIndex:   index,
+			URL:         target,
+		})
+		index++
+
+		return fmt.Sprintf(`%s"%s/c/%s"`, parts[1], t.baseURL, token)
+	})
+}
+
+// Sign encode la cible et y ajoute une signature HMAC-SHA256
+func (t *TrackingService) Sign(target ClickTarget) string {
+	return t.sign(target)
+}
+
+// Verify vérifie la signature d'un jeton et retourne la cible associée
+func (t *TrackingService) Verify(token string) (*ClickTarget, error) {
+	var target ClickTarget
+	if err := t.verify(token, &target); err != nil {
+		return nil, ErrInvalidClickToken
+	}
+
+	// Ne jamais rediriger vers autre chose qu'une URL http(s)
+	if !isTrackableURL(target.URL) {
+		return nil, ErrInvalidClickToken
+	}
+
+	return &target, nil
+}
+
+// sign sérialise v en JSON base64 suivi de sa signature
+func (t *TrackingService) sign(v interface{}) string {
+	payload, _ := json.Marshal(v)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(t.mac(encoded))
+}
+
+// verify contrôle la signature d'un jeton produit par sign et décode son contenu dans v
+func (t *TrackingService) verify(token string, v interface{}) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidClickToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, t.mac(encoded)) {
+		return ErrInvalidClickToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidClickToken
+	}
+	return json.Unmarshal(payload, v)
+}
+
+func (t *TrackingService) mac(data string) []byte {
+	h := hmac.New(sha256.New, t.secret)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// isTrackableURL indique si l'URL est absolue en http(s) (pas de mailto:, #ancre, etc.)
+func isTrackableURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
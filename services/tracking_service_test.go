@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func newTestTracking(secret string) *TrackingService {
+	return &TrackingService{secret: []byte(secret), baseURL: "https://suivi.exemple.fr"}
+}
+
+func TestVerifyClickToken(t *testing.T) {
+	tracking := newTestTracking("secret")
+	other := newTestTracking("autre secret")
+
+	target := ClickTarget{ContentID: 3, RecipientID: 7, LinkIndex: 1, URL: "https://exemple.fr/offre?id=1"}
+	valid := tracking.Sign(target)
+	encoded, signature, _ := strings.Cut(valid, ".")
+
+	// Contenu modifié en conservant la signature d'origine
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"c":3,"r":7,"i":1,"u":"https://pirate.example"}`)) + "." + signature
+
+	// Signature correcte d'un contenu qui n'est pas du JSON base64
+	notBase64 := "!!!." + base64.RawURLEncoding.EncodeToString(tracking.mac("!!!"))
+	garbage := base64.RawURLEncoding.EncodeToString([]byte("pas du json"))
+	notJSON := garbage + "." + base64.RawURLEncoding.EncodeToString(tracking.mac(garbage))
+
+	cases := []struct {
+		name  string
+		token string
+		want  *ClickTarget
+	}{
+		{"valide", valid, &target},
+
+		// Jetons falsifiés
+		{"vide", "", nil},
+		{"sans signature", encoded, nil},
+		{"signature vide", encoded + ".", nil},
+		{"signature tronquée", valid[:len(valid)-2], nil},
+		{"signature non base64", encoded + ".***", nil},
+		{"contenu modifié", tampered, nil},
+		{"autre secret", other.Sign(target), nil},
+		{"contenu non base64", notBase64, nil},
+		{"contenu non JSON", notJSON, nil},
+
+		// Jetons d'un autre usage, correctement signés
+		{"jeton de préférences", tracking.PreferencesToken(7), nil},
+		{"jeton d'ouverture", tracking.sign(openToken{Purpose: "open", ContentID: 3, RecipientID: 7}), nil},
+		{"jeton de confirmation", tracking.sign(confirmationToken{Purpose: "confirm", RecipientID: 7, Expires: 1 << 40}), nil},
+
+		// Cibles signées mais vers lesquelles on ne redirige jamais
+		{"javascript", tracking.Sign(ClickTarget{URL: "javascript:alert(1)"}), nil},
+		{"data", tracking.Sign(ClickTarget{URL: "data:text/html,<script>alert(1)</script>"}), nil},
+		{"mailto", tracking.Sign(ClickTarget{URL: "mailto:jean@exemple.fr"}), nil},
+		{"ftp", tracking.Sign(ClickTarget{URL: "ftp://exemple.fr/fichier"}), nil},
+		{"relative au protocole", tracking.Sign(ClickTarget{URL: "//pirate.example"}), nil},
+		{"chemin relatif", tracking.Sign(ClickTarget{URL: "/admin"}), nil},
+		{"sans hôte", tracking.Sign(ClickTarget{URL: "http:///chemin"}), nil},
+		{"vide signée", tracking.Sign(ClickTarget{}), nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := tracking.Verify(c.token)
+			if c.want == nil {
+				if err != ErrInvalidClickToken || got != nil {
+					t.Fatalf("Verify = (%+v, %v), attendu ErrInvalidClickToken", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if *got != *c.want {
+				t.Errorf("Verify = %+v, attendu %+v", *got, *c.want)
+			}
+		})
+	}
+}
+
+func TestTokenPurposes(t *testing.T) {
+	tracking := newTestTracking("secret")
+	click := tracking.Sign(ClickTarget{ContentID: 3, RecipientID: 7, URL: "https://exemple.fr"})
+	open := tracking.sign(openToken{Purpose: "open", ContentID: 3, RecipientID: 7})
+	prefs := tracking.PreferencesToken(7)
+
+	if _, _, err := tracking.VerifyOpenToken(open); err != nil {
+		t.Errorf("jeton d'ouverture refusé : %v", err)
+	}
+	if id, err := tracking.VerifyPreferencesToken(prefs); err != nil || id != 7 {
+		t.Errorf("jeton de préférences = (%d, %v), attendu 7", id, err)
+	}
+
+	cases := []struct {
+		name  string
+		token string
+	}{
+		{"clic", click},
+		{"préférences", prefs},
+	}
+	for _, c := range cases {
+		if _, _, err := tracking.VerifyOpenToken(c.token); err == nil {
+			t.Errorf("VerifyOpenToken accepte un jeton de %s", c.name)
+		}
+	}
+
+	cases = []struct {
+		name  string
+		token string
+	}{
+		{"clic", click},
+		{"ouverture", open},
+		{"préférences sans destinataire", tracking.sign(preferencesToken{Purpose: "prefs"})},
+	}
+	for _, c := range cases {
+		if _, err := tracking.VerifyPreferencesToken(c.token); err == nil {
+			t.Errorf("VerifyPreferencesToken accepte un jeton de %s", c.name)
+		}
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	tracking := newTestTracking("secret")
+	body := `<p><a href="https://exemple.fr/a?x=1&amp;y=2">A</a>
+<a class="btn" href='http://exemple.fr/b'>B</a>
+<a href="mailto:jean@exemple.fr">mail</a>
+<a href="#haut">haut</a>
+<a href="/relatif">relatif</a>
+<a name="ancre">sans lien</a></p>`
+
+	got := tracking.RewriteLinks(body, 3, 7)
+
+	for _, kept := range []string{`href="mailto:jean@exemple.fr"`, `href="#haut"`, `href="/relatif"`, `<a name="ancre">`} {
+		if !strings.Contains(got, kept) {
+			t.Errorf("%s ne doit pas être réécrit :\n%s", kept, got)
+		}
+	}
+
+	prefix := `href="https://suivi.exemple.fr/c/`
+	if n := strings.Count(got, prefix); n != 2 {
+		t.Fatalf("%d liens réécrits, attendu 2 :\n%s", n, got)
+	}
+
+	want := []ClickTarget{
+		{ContentID: 3, RecipientID: 7, LinkIndex: 0, URL: "https://exemple.fr/a?x=1&y=2"},
+		{ContentID: 3, RecipientID: 7, LinkIndex: 1, URL: "http://exemple.fr/b"},
+	}
+	rest := got
+	for i, w := range want {
+		_, after, _ := strings.Cut(rest, prefix)
+		token, _, _ := strings.Cut(after, `"`)
+		rest = after
+
+		target, err := tracking.Verify(token)
+		if err != nil {
+			t.Fatalf("lien %d : %v", i, err)
+		}
+		if *target != w {
+			t.Errorf("lien %d = %+v, attendu %+v", i, *target, w)
+		}
+	}
+	if !strings.Contains(got, `<a class="btn" href="https://suivi.exemple.fr/c/`) {
+		t.Errorf("les autres attributs doivent être conservés :\n%s", got)
+	}
+}
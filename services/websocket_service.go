@@ -11,17 +11,27 @@ type WebSocketService struct {
 	clients   map[*websocket.Conn]bool
 	mu        sync.Mutex
 	broadcast chan models.ProgressUpdate
+	imports   chan models.ImportProgress
 }
 
 func NewWebSocketService() *WebSocketService {
 	ws := &WebSocketService{
 		clients:   make(map[*websocket.Conn]bool),
 		broadcast: make(chan models.ProgressUpdate, 100),
+		imports:   make(chan models.ImportProgress, 100),
 	}
 	go ws.handleBroadcasts()
+	registerClientGauge(ws)
 	return ws
 }
 
+// ClientCount retourne le nombre de clients connectés
+func (ws *WebSocketService) ClientCount() int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return len(ws.clients)
+}
+
 func (ws *WebSocketService) AddClient(conn *websocket.Conn) {
 	ws.mu.Lock()
 	defer ws.mu.Unlock()
@@ -39,19 +49,33 @@ func (ws *WebSocketService) GetBroadcastChannel() chan<- models.ProgressUpdate {
 	return ws.broadcast
 }
 
+// GetImportChannel retourne le canal de progression des imports
+func (ws *WebSocketService) GetImportChannel() chan<- models.ImportProgress {
+	return ws.imports
+}
+
 func (ws *WebSocketService) handleBroadcasts() {
-	for msg := range ws.broadcast {
-		ws.mu.Lock()
-		for client := range ws.clients {
-			err := client.WriteJSON(map[string]interface{}{
-				"type": "progress",
-				"data": msg,
-			})
-			if err != nil {
-				delete(ws.clients, client)
-				client.Close()
-			}
+	for {
+		select {
+		case msg := <-ws.broadcast:
+			ws.send("progress", msg)
+		case msg := <-ws.imports:
+			ws.send("import", msg)
+		}
+	}
+}
+
+func (ws *WebSocketService) send(kind string, data interface{}) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for client := range ws.clients {
+		err := client.WriteJSON(map[string]interface{}{
+			"type": kind,
+			"data": data,
+		})
+		if err != nil {
+			delete(ws.clients, client)
+			client.Close()
 		}
-		ws.mu.Unlock()
 	}
 }
@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporteurs disponibles (OTEL_TRACES_EXPORTER)
+const (
+	ExporterNone   = "none"   // traces désactivées
+	ExporterStdout = "stdout" // spans écrits sur la sortie standard
+	ExporterOTLP   = "otlp"   // OTLP/HTTP, configuré par OTEL_EXPORTER_OTLP_ENDPOINT
+)
+
+// Init installe le fournisseur de traces global selon l'exporteur demandé.
+// La fonction retournée vide les spans en attente à l'arrêt.
+func Init(exporter, serviceName string) (func(context.Context) error, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(context.Background())
+	default:
+		return nil, fmt.Errorf("exporteur de traces inconnu: %s (none, stdout ou otlp)", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := newProvider(serviceName, sdktrace.WithBatcher(exp))
+	return provider.Shutdown, nil
+}
+
+// UseMemory installe, pour les tests, un exporteur en mémoire et synchrone :
+// les spans terminés sont disponibles immédiatement via GetSpans()
+func UseMemory(serviceName string) *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	newProvider(serviceName, sdktrace.WithSyncer(exp))
+	return exp
+}
+
+func newProvider(serviceName string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	opts = append(opts, sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))))
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider
+}
+
+// End termine le span en le marquant en erreur si err n'est pas nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}